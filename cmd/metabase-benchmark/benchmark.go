@@ -12,6 +12,7 @@ import (
 	"go.uber.org/zap"
 	"golang.org/x/sync/errgroup"
 
+	"storj.io/benchmark/internal/openloop"
 	"storj.io/common/memory"
 	"storj.io/common/storj"
 	"storj.io/common/testrand"
@@ -31,6 +32,12 @@ type Benchmark struct {
 	Count       int
 	MaxDuration time.Duration
 
+	// Rate enables the open loop download benchmarks with the schedule,
+	// see openloop.ParseSchedule, which run for RateDuration each.
+	Rate            string
+	RateDuration    time.Duration
+	RateMaxInFlight int
+
 	ProjectID  uuid.UUID
 	BucketName string
 
@@ -48,6 +55,8 @@ func NewBenchmark(dburl string) *Benchmark {
 		Count:       50,
 		MaxDuration: 2 * time.Minute,
 
+		RateDuration: time.Minute,
+
 		ProjectID:  testrand.UUID(),
 		BucketName: "benchmark",
 
@@ -122,6 +131,16 @@ func (b *Benchmark) Run(ctx context.Context, log *zap.Logger) ([]Measurement, er
 		measurements = append(measurements, measurement)
 	}
 
+	if b.Rate != "" {
+		for _, scenario := range b.Scenarios() {
+			measurement, err := b.OpenLoopDownload(ctx, db, scenario)
+			if err != nil {
+				return nil, fmt.Errorf("open loop download failed: %w", err)
+			}
+			measurements = append(measurements, measurement)
+		}
+	}
+
 	for _, scenario := range b.Scenarios() {
 		measurement, err := b.Delete(ctx, db, scenario)
 		if err != nil {
@@ -412,6 +431,66 @@ func (b *Benchmark) Download(ctx context.Context, db *metabase.DB, scenario Scen
 	return measurement, nil
 }
 
+// OpenLoopDownload downloads the objects with given number of parts and
+// segments at the rate of the schedule, regardless of how long the downloads
+// take, and records their service time and their response time from the
+// intended start.
+func (b *Benchmark) OpenLoopDownload(ctx context.Context, db *metabase.DB, scenario Scenario) (Measurement, error) {
+	fmt.Printf("Benchmark Open Loop Download %s (Parts:%d, Segments:%d): ", b.Rate, scenario.Parts, scenario.Segments)
+	defer fmt.Println()
+
+	measurement := Measurement{Scenario: scenario}
+	objects := b.Objects[scenario]
+	if len(objects) == 0 {
+		return measurement, nil
+	}
+
+	schedule, err := openloop.ParseSchedule(b.Rate, b.RateDuration)
+	if err != nil {
+		return measurement, err
+	}
+
+	_, err = openloop.Run(ctx, openloop.Options{
+		Schedule:    schedule,
+		Duration:    b.RateDuration,
+		MaxInFlight: b.RateMaxInFlight,
+	}, func(ctx context.Context, n int) error {
+		object, err := db.GetObjectLatestVersion(ctx, metabase.GetObjectLatestVersion{
+			ObjectLocation: objects[n%len(objects)],
+		})
+		if err != nil {
+			return fmt.Errorf("get object failed: %w", err)
+		}
+
+		for p := 0; p < scenario.Parts; p++ {
+			for i := 0; i < scenario.Segments; i++ {
+				_, err = db.GetSegmentByPosition(ctx, metabase.GetSegmentByPosition{
+					StreamID: object.StreamID,
+					Position: metabase.SegmentPosition{
+						Part:  uint32(p),
+						Index: uint32(i),
+					},
+				})
+				if err != nil {
+					return fmt.Errorf("get segment failed: %w", err)
+				}
+			}
+		}
+		return nil
+	}, func(sample openloop.Sample) error {
+		if sample.Err != nil {
+			return sample.Err
+		}
+		if sample.N%10 == 0 {
+			fmt.Print(".")
+		}
+		measurement.Record("Download Service", sample.Service())
+		measurement.Record("Download Response", sample.Response())
+		return nil
+	})
+	return measurement, err
+}
+
 // Delete runs delete object benchmarks with given number of parts and segments.
 func (b *Benchmark) Delete(ctx context.Context, db *metabase.DB, scenario Scenario) (Measurement, error) {
 	fmt.Printf("Benchmark Delete (Parts:%d, Segments:%d): ", scenario.Parts, scenario.Segments)
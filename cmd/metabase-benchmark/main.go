@@ -18,6 +18,8 @@ import (
 
 	"github.com/loov/hrtime"
 	"go.uber.org/zap"
+
+	"storj.io/benchmark/internal/openloop"
 )
 
 func main() {
@@ -34,6 +36,9 @@ func main() {
 	flag.StringVar(&bench.DBURL, "database-url", bench.DBURL, "database url")
 	flag.IntVar(&bench.Count, "count", bench.Count, "benchmark count")
 	flag.DurationVar(&bench.MaxDuration, "time", bench.MaxDuration, "maximum benchmark time per scenario")
+	flag.StringVar(&bench.Rate, "rate", bench.Rate, "run open loop downloads at the rate in operations per second, \"ramp:start-end\" or \"step:rate,rate[/interval]\", empty disables them")
+	flag.DurationVar(&bench.RateDuration, "rate-time", bench.RateDuration, "duration of each open loop benchmark")
+	flag.IntVar(&bench.RateMaxInFlight, "rate-max-inflight", bench.RateMaxInFlight, "maximum number of running open loop operations, 0 is unlimited")
 
 	var loads []string
 	flag.Var(funcFlag(func(out string) error {
@@ -64,6 +69,12 @@ func main() {
 
 	flag.Parse()
 
+	if bench.Rate != "" {
+		if _, err := openloop.ParseSchedule(bench.Rate, bench.RateDuration); err != nil {
+			log.Fatal("Invalid rate.", zap.Error(err))
+		}
+	}
+
 	var results []BenchmarkResult
 
 	if len(loads) > 0 {
@@ -0,0 +1,48 @@
+// Copyright (C) 2021 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"storj.io/benchmark/internal/s3client"
+	"storj.io/common/memory"
+)
+
+// BaselineBenchmarks runs the file benchmarks on the local filesystem in dir,
+// which shows how much of the time is spent storing the data.
+func BaselineBenchmarks(dir string, fsync bool, filesizes []memory.Size, count int, duration time.Duration) (_ []Measurement, err error) {
+	client, err := s3client.NewFileSystem(s3client.Config{
+		Options: map[string]string{
+			"root":  dir,
+			"fsync": strconv.FormatBool(fsync),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	const bucket = "baseline"
+	if err := client.MakeBucket(bucket, ""); err != nil {
+		return nil, fmt.Errorf("failed to create baseline bucket: %w", err)
+	}
+	defer func() {
+		if removeErr := client.RemoveBucket(bucket); removeErr != nil && err == nil {
+			err = fmt.Errorf("failed to remove baseline bucket: %w", removeErr)
+		}
+	}()
+
+	measurements := []Measurement{}
+	for _, filesize := range filesizes {
+		measurement, err := FileBenchmark(client, bucket, filesize, count, duration)
+		measurement.Scenario = "local fs"
+		if err != nil {
+			return measurements, err
+		}
+		measurements = append(measurements, measurement)
+	}
+	return measurements, nil
+}
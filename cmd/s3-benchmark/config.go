@@ -0,0 +1,52 @@
+// Copyright (C) 2021 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package main
+
+import (
+	"flag"
+	"os"
+
+	"storj.io/benchmark/internal/s3client"
+)
+
+// loadConfig sets the fields of conf whose flags were not given on the
+// command line from the environment variables or, when they are not set,
+// from the AWS profile. An empty profile uses AWS_PROFILE or "default".
+func loadConfig(flags *flag.FlagSet, conf *s3client.Config, profile string) error {
+	credentialsFile, configFile, envProfile := s3client.ProfileFiles(os.Getenv)
+	if profile == "" {
+		profile = envProfile
+	}
+	fromProfile, err := s3client.LoadProfile(credentialsFile, configFile, profile)
+	if err != nil {
+		return err
+	}
+	fromEnv := s3client.LoadEnv(os.Getenv)
+
+	set := map[string]bool{}
+	flags.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	for _, field := range []struct {
+		flag    string
+		value   *string
+		env     string
+		profile string
+	}{
+		{"s3-gateway", &conf.S3Gateway, fromEnv.S3Gateway, fromProfile.S3Gateway},
+		{"access", &conf.Access, fromEnv.Access, fromProfile.Access},
+		{"accesskey", &conf.AccessKey, fromEnv.AccessKey, fromProfile.AccessKey},
+		{"secretkey", &conf.SecretKey, fromEnv.SecretKey, fromProfile.SecretKey},
+		{"region", &conf.Region, fromEnv.Region, fromProfile.Region},
+		{"ca-file", &conf.TLS.CAFile, fromEnv.TLS.CAFile, fromProfile.TLS.CAFile},
+	} {
+		switch {
+		case set[field.flag]:
+		case field.env != "":
+			*field.value = field.env
+		case field.profile != "":
+			*field.value = field.profile
+		}
+	}
+	return nil
+}
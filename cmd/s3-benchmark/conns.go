@@ -0,0 +1,26 @@
+// Copyright (C) 2021 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"storj.io/benchmark/internal/s3client"
+)
+
+// PrintConnStats prints the connection counts, unless the client didn't
+// use the counting transport.
+func PrintConnStats(w io.Writer, counts s3client.ConnCounts) {
+	if counts == (s3client.ConnCounts{}) {
+		return
+	}
+
+	fmt.Fprint(w, "\nConnections:\n")
+	tw := tabwriter.NewWriter(w, 0, 0, 4, ' ', 0)
+	fmt.Fprintf(tw, "%v\t%v\t%v\n", "Opened", "Reused", "Closed")
+	fmt.Fprintf(tw, "%v\t%v\t%v\n", counts.Opened, counts.Reused, counts.Closed)
+	_ = tw.Flush()
+}
@@ -0,0 +1,121 @@
+// Copyright (C) 2021 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/loov/hrtime"
+
+	"storj.io/benchmark/internal/s3client"
+	"storj.io/common/memory"
+)
+
+// CopyBenchmark runs server-side copy and move benchmarks on bucket with given filesize.
+//
+// Move is only measured when the backend supports it. When
+// only copy is unsupported, the move source is uploaded instead. When
+// neither is supported, it returns s3client.ErrUnsupported.
+func CopyBenchmark(client s3client.Client, bucket string, filesize memory.Size, count int, duration time.Duration) (_ Measurement, err error) {
+	log.Print("Benchmarking copy file size ", filesize.String(), " ")
+
+	measurement := Measurement{}
+	measurement.Size = filesize
+	measurement.Scenario = "copy"
+
+	data := make([]byte, filesize.Int())
+	for i := range data {
+		data[i] = 'a' + byte(i%26)
+	}
+
+	err = client.Upload(bucket, "copy-source", data)
+	if err != nil {
+		return measurement, fmt.Errorf("upload failed: %w", err)
+	}
+	defer func() {
+		if deleteErr := client.Delete(bucket, "copy-source"); deleteErr != nil && err == nil {
+			err = fmt.Errorf("delete failed: %w", deleteErr)
+		}
+	}()
+
+	canCopy, canMove := true, true
+
+	defer fmt.Println()
+
+	ctx := context.Background()
+	start := time.Now()
+	for k := 0; k < count; k++ {
+		if time.Since(start) > duration {
+			break
+		}
+		fmt.Print(".")
+
+		target := "copy-target"
+		if canCopy { // copying
+			start := hrtime.Now()
+			err := client.Copy(ctx, bucket, "copy-source", bucket, target)
+			finish := hrtime.Now()
+			switch {
+			case errors.Is(err, s3client.ErrUnsupported):
+				canCopy = false
+			case err != nil:
+				return measurement, fmt.Errorf("copy failed: %w", err)
+			default:
+				measurement.Record("Copy", finish-start)
+			}
+		}
+
+		if canMove { // moving
+			if !canCopy {
+				// the source of the move is consumed, hence it's uploaded every time
+				if err := client.Upload(bucket, target, data); err != nil {
+					return measurement, fmt.Errorf("upload failed: %w", err)
+				}
+			}
+
+			start := hrtime.Now()
+			err := s3client.Move(ctx, client, bucket, target, bucket, "move-target")
+			finish := hrtime.Now()
+			switch {
+			case errors.Is(err, s3client.ErrUnsupported):
+				canMove = false
+				if !canCopy {
+					_ = client.Delete(bucket, target)
+				}
+			case err != nil:
+				return measurement, fmt.Errorf("move failed: %w", err)
+			default:
+				measurement.Record("Move", finish-start)
+				target = "move-target"
+			}
+		}
+
+		if !canCopy && !canMove {
+			return measurement, fmt.Errorf("copy and move failed: %w", s3client.ErrUnsupported)
+		}
+
+		{ // checking
+			info, err := client.Stat(ctx, bucket, target)
+			if err != nil {
+				return measurement, fmt.Errorf("stat failed: %w", err)
+			}
+			if info.Size != filesize.Int64() {
+				return measurement, fmt.Errorf("copied size wrong: %d, expected %d", info.Size, filesize.Int64())
+			}
+		}
+
+		{ // cleanup
+			err := client.Delete(bucket, target)
+			if err != nil {
+				return measurement, fmt.Errorf("delete failed: %w", err)
+			}
+		}
+	}
+
+	return measurement, nil
+}
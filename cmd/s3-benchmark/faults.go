@@ -0,0 +1,75 @@
+// Copyright (C) 2021 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+
+	"storj.io/benchmark/internal/s3client"
+)
+
+// ErrIntegrity is returned when the downloaded data doesn't match the uploaded data.
+var ErrIntegrity = errors.New("integrity check failed")
+
+// FailureClass returns how the benchmark classifies a failed iteration.
+func FailureClass(err error) string {
+	if errors.Is(err, ErrIntegrity) {
+		return "integrity"
+	}
+	return s3client.ErrorClass(err)
+}
+
+// parseErrorRates parses operation=rate pairs.
+func parseErrorRates(values map[string]string) (map[string]float64, error) {
+	rates := map[string]float64{}
+	for op, value := range values {
+		rate, err := strconv.ParseFloat(value, 64)
+		if err != nil || rate < 0 || rate > 1 {
+			return nil, fmt.Errorf("invalid error rate %q for %q, expected a value between 0 and 1", value, op)
+		}
+		rates[op] = rate
+	}
+	return rates, nil
+}
+
+// PrintFaultStats prints the number of injected faults per operation.
+//
+// stats is called when printing, so that it includes operations done after deferring the call.
+func PrintFaultStats(w io.Writer, stats func() []s3client.FaultStats) {
+	fmt.Fprint(w, "\n\nInjected faults:\n")
+	tw := tabwriter.NewWriter(w, 0, 0, 4, ' ', 0)
+	fmt.Fprintf(tw, "%v\t%v\t%v\n", "Operation", "Fault", "Count")
+	for _, fault := range stats() {
+		fmt.Fprintf(tw, "%v\t%v\t%v\n", fault.Op, fault.Kind, fault.Count)
+	}
+	_ = tw.Flush()
+}
+
+// PrintFailures prints how the failed iterations of the measurements were classified.
+func PrintFailures(w io.Writer, measurements []Measurement) {
+	tw := tabwriter.NewWriter(w, 0, 0, 4, ' ', 0)
+	printed := false
+	for _, m := range measurements {
+		classes := make([]string, 0, len(m.Failures))
+		for class := range m.Failures {
+			classes = append(classes, class)
+		}
+		sort.Strings(classes)
+
+		for _, class := range classes {
+			if !printed {
+				fmt.Fprint(w, "\nFailures:\n")
+				fmt.Fprintf(tw, "%v\t%v\t%v\n", "Size", "Class", "Count")
+				printed = true
+			}
+			fmt.Fprintf(tw, "%v\t%v\t%v\n", m.Label(), class, m.Failures[class])
+		}
+	}
+	_ = tw.Flush()
+}
@@ -5,17 +5,24 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"crypto/md5"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"log"
 	"os"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
 	"text/tabwriter"
 	"time"
 
-	"github.com/loov/hrtime"
+	"github.com/zeebo/errs"
 
+	"storj.io/benchmark/internal/openloop"
 	"storj.io/benchmark/internal/s3client"
 	"storj.io/common/memory"
 )
@@ -27,10 +34,45 @@ func main() {
 	flag.StringVar(&conf.Access, "access", "access-grant", "access grant")
 	flag.StringVar(&conf.AccessKey, "accesskey", "insecure-dev-access-key", "access key")
 	flag.StringVar(&conf.SecretKey, "secretkey", "insecure-dev-secret-key", "secret key")
-	flag.BoolVar(&conf.NoSSL, "no-ssl", false, "disable ssl")
+	flag.BoolVar(&conf.NoSSL, "no-ssl", false, "use plain http when the gateway address has no scheme")
 	flag.StringVar(&conf.ConfigDir, "config-dir", "", "path of config dir to use. If empty, a config will be created.")
-
-	clientName := flag.String("client", "minio", "client to use for requests (supported: minio, aws-cli, uplink)")
+	flag.StringVar(&conf.Region, "region", "", "signing region, empty uses the client default")
+	flag.StringVar(&conf.Addressing, "addressing", "", "bucket addressing style \"path\" or \"virtual\", empty uses the client default")
+	flag.StringVar(&conf.TLS.CAFile, "ca-file", "", "PEM file of the trusted certificate authorities")
+	flag.StringVar(&conf.TLS.CertFile, "cert-file", "", "PEM file of the client certificate")
+	flag.StringVar(&conf.TLS.KeyFile, "key-file", "", "PEM file of the client certificate key")
+	flag.BoolVar(&conf.TLS.InsecureSkipVerify, "insecure-skip-verify", false, "don't verify the gateway certificate")
+	flag.IntVar(&conf.Transport.MaxIdleConns, "max-idle-conns", 0, "maximum number of idle connections, 0 uses the client default")
+	flag.IntVar(&conf.Transport.MaxIdleConnsPerHost, "max-idle-conns-per-host", 0, "maximum number of idle connections to the gateway, 0 uses the client default")
+	flag.IntVar(&conf.Transport.MaxConnsPerHost, "max-conns-per-host", 0, "maximum number of connections to the gateway, 0 is unlimited")
+	flag.DurationVar(&conf.Transport.IdleConnTimeout, "idle-conn-timeout", 0, "close connections idle for the duration, 0 uses the client default")
+	flag.BoolVar(&conf.Transport.DisableKeepAlives, "no-keep-alive", false, "use a new connection for every request")
+	flag.BoolVar(&conf.Transport.DisableHTTP2, "no-http2", false, "don't use HTTP/2")
+	profile := flag.String("profile", "", "AWS profile used for the settings that are not given as flags or environment variables, empty uses AWS_PROFILE or \"default\"")
+
+	clientName := flag.String("client", "minio", "client to use for requests, \"list\" prints the available clients")
+	clientOptions := optionsFlag{}
+	flag.Var(clientOptions, "client-opt", "client specific option as key=value, can be repeated")
+
+	retryAttempts := flag.Int("retry-attempts", 3, "maximum number of attempts of idempotent requests, 1 disables retries")
+	retryBackoff := flag.Duration("retry-backoff", 100*time.Millisecond, "delay before the first retry, doubled after each retry")
+	retryMaxBackoff := flag.Duration("retry-max-backoff", 5*time.Second, "maximum delay between retries")
+	retryJitter := flag.Float64("retry-jitter", 0.2, "fraction of random variation of the retry delays")
+
+	oplogPath := flag.String("oplog", "", "write every client operation as CSV to the file")
+
+	faultLatency := flag.String("fault-latency", "", "inject latency before each request, e.g. \"50ms\", \"uniform:10ms-100ms\", \"normal:50ms,10ms\" or \"exp:50ms\"")
+	faultErrors := optionsFlag{}
+	flag.Var(faultErrors, "fault-error", "inject errors as operation=rate, e.g. Upload=0.1, \"*\" matches all operations, can be repeated")
+	faultTruncate := flag.Float64("fault-truncate", 0, "fraction of downloads to truncate")
+	faultCorrupt := flag.Float64("fault-corrupt", 0, "fraction of downloads to corrupt")
+	faultSeed := flag.Int64("fault-seed", 1, "random seed of the injected faults")
+	maxFailures := flag.Int("max-failures", 0, "number of failed iterations tolerated per benchmark")
+
+	var throttleUpload, throttleDownload memory.Size
+	flag.Var(&throttleUpload, "throttle-upload", "limit upload bandwidth per second, e.g. 100MiB, 0 is unlimited")
+	flag.Var(&throttleDownload, "throttle-download", "limit download bandwidth per second, e.g. 100MiB, 0 is unlimited")
+	throttleOps := flag.Float64("throttle-ops", 0, "limit requests per second, 0 is unlimited")
 
 	location := flag.String("location", "", "bucket location")
 	count := flag.Int("count", 50, "benchmark count")
@@ -51,35 +93,186 @@ func main() {
 		},
 	}
 	flag.Var(filesizes, "filesize", "filesizes to test with")
+	concurrency := intsFlag{1}
+	flag.Var(&concurrency, "concurrency", "number of concurrent workers of the file benchmarks, a comma separated list tests each")
 	listsize := flag.Int("listsize", 1000, "listsize to test with")
+	listpage := flag.Int("listpage", 0, "maximum number of entries in a list page, 0 uses the client default")
+
+	multipart := flag.Bool("multipart", false, "benchmark multipart uploads")
+	partsizes := &memory.Sizes{
+		Default: []memory.Size{
+			5 * memory.MiB,
+			16 * memory.MiB,
+			64 * memory.MiB,
+		},
+	}
+	flag.Var(partsizes, "partsize", "multipart part sizes to test with")
+	partConcurrency := intsFlag{1, 4, 8}
+	flag.Var(&partConcurrency, "part-concurrency", "number of concurrently uploaded parts to test with")
+
+	baselineDir := flag.String("baseline", "", "directory for running the file benchmarks on the local filesystem as a baseline, empty disables it")
+	baselineFsync := flag.Bool("baseline-fsync", false, "sync the baseline files to the disk")
+
+	workload := flag.String("workload", "", "run a mixed workload with the operation weights, e.g. \"get=70,put=20,list=5,delete=5\", empty disables it")
+	workloadSize := 1 * memory.MiB
+	flag.Var(&workloadSize, "workload-filesize", "size of the workload objects")
+	workloadObjects := flag.Int("workload-objects", 100, "number of objects uploaded before the workload")
+	workloadConcurrency := flag.Int("workload-concurrency", 8, "number of concurrent workers of the workload")
+	workloadDuration := flag.Duration("workload-time", time.Minute, "duration of the workload")
+	workloadSeed := flag.Int64("workload-seed", 1, "random seed of the workload")
+
+	rate := flag.String("rate", "", "run open loop file and list benchmarks at the rate in operations per second, \"ramp:start-end\" or \"step:rate,rate[/interval]\", empty disables them")
+	rateDuration := flag.Duration("rate-time", time.Minute, "duration of each open loop benchmark")
+	rateMaxInFlight := flag.Int("rate-max-inflight", 0, "maximum number of running open loop operations, 0 is unlimited")
+
+	verifyMethod := flag.String("verify", "bytes", "how to verify the file benchmark data: bytes compares buffered copies, md5, sha256 or blake3 compare hashes while streaming")
+	verifyETag := flag.Bool("verify-etag", true, "compare MD5 ETags reported by the backend with the uploaded data")
+
+	copyObjects := flag.Bool("copy", false, "benchmark server-side copy and move")
+
+	rangeReads := flag.Bool("range", false, "benchmark ranged reads at random offsets")
+	rangeObjectSize := 256 * memory.MiB
+	flag.Var(&rangeObjectSize, "range-objectsize", "size of the object used for ranged reads")
+	rangesizes := &memory.Sizes{
+		Default: []memory.Size{
+			4 * memory.KiB,
+			64 * memory.KiB,
+			1 * memory.MiB,
+			16 * memory.MiB,
+		},
+	}
+	flag.Var(rangesizes, "rangesize", "ranged read sizes to test with")
 
 	flag.Parse()
 
-	var client s3client.Client
-	var err error
+	if err := checkVerifyMethod(*verifyMethod); err != nil {
+		log.Fatal(err)
+	}
+	fileOpts := FileOptions{
+		Verify:      *verifyMethod,
+		VerifyETag:  *verifyETag,
+		MaxFailures: *maxFailures,
+	}
+	var rateSchedule openloop.Schedule
+	if *rate != "" {
+		var err error
+		rateSchedule, err = openloop.ParseSchedule(*rate, *rateDuration)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	for _, workers := range concurrency {
+		if workers < 1 {
+			log.Fatalf("invalid concurrency %d", workers)
+		}
+	}
+	if *workloadConcurrency < 1 {
+		log.Fatalf("invalid workload concurrency %d", *workloadConcurrency)
+	}
 
-	switch *clientName {
-	default:
-		log.Println("unknown client name ", *clientName, " defaulting to minio")
-		fallthrough
-	case "minio":
-		client, err = s3client.NewMinio(conf)
-	case "aws-cli":
-		client, err = s3client.NewAWSCLI(conf)
-	case "uplink":
-		client, err = s3client.NewUplink(conf)
+	if *clientName == "list" {
+		for _, name := range s3client.Names() {
+			fmt.Println(name)
+		}
+		return
+	}
+
+	if err := loadConfig(flag.CommandLine, &conf, *profile); err != nil {
+		log.Fatal(err)
 	}
+	conf.Options = clientOptions
+	conf.Transport.Stats = &s3client.ConnStats{}
+	// the timings are only collected during the file benchmarks
+	fileOpts.Timings = &s3client.RequestTimings{}
+	fileOpts.Timings.SetEnabled(false)
+	conf.Transport.Timings = fileOpts.Timings
+	client, err := s3client.New(*clientName, conf)
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	// the exit on a failure is deferred, so the operation log is flushed
+	// and the reports are printed before
+	failed := false
+	defer func() {
+		if failed {
+			os.Exit(1)
+		}
+	}()
+	if closer, ok := client.(io.Closer); ok {
+		defer func() { _ = closer.Close() }()
+	}
+
+	if throttleUpload > 0 || throttleDownload > 0 || *throttleOps > 0 {
+		client = s3client.NewThrottle(client, s3client.ThrottleOptions{
+			UploadBandwidth:   throttleUpload.Int64(),
+			DownloadBandwidth: throttleDownload.Int64(),
+			OpsPerSecond:      *throttleOps,
+		})
+	}
+
+	if *faultLatency != "" || len(faultErrors) > 0 || *faultTruncate > 0 || *faultCorrupt > 0 {
+		opts := s3client.FaultOptions{
+			Seed:         *faultSeed,
+			TruncateRate: *faultTruncate,
+			CorruptRate:  *faultCorrupt,
+		}
+		if *faultLatency != "" {
+			opts.Latency, err = s3client.ParseLatency(*faultLatency)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+		opts.ErrorRates, err = parseErrorRates(faultErrors)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		faults := s3client.NewFaults(client, opts)
+		client = faults
+		defer PrintFaultStats(os.Stdout, faults.Stats)
+	}
+
+	if *oplogPath != "" {
+		file, err := os.Create(*oplogPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		oplog := NewOperationLog(file)
+		defer func() {
+			if err := errs.Combine(oplog.Flush(), file.Close()); err != nil {
+				log.Printf("failed to write operation log: %v", err)
+				failed = true
+			}
+		}()
+		// instrumenting below retries logs every attempt
+		client = s3client.NewInstrumented(client, *clientName, oplog)
+	}
+
+	retry := s3client.NewRetry(client, s3client.RetryOptions{
+		MaxAttempts:    *retryAttempts,
+		InitialBackoff: *retryBackoff,
+		MaxBackoff:     *retryMaxBackoff,
+		Jitter:         *retryJitter,
+		OnRetry: func(op string, attempt int, err error, backoff time.Duration) {
+			log.Printf("%s attempt %d failed, retrying in %v: %v", op, attempt, backoff, err)
+		},
+	})
+	client = retry
+
+	if *retryAttempts > 1 {
+		defer PrintRetryStats(os.Stdout, retry.Stats)
+	}
+
 	bucket := "benchmark" + suffix
 	log.Println("Creating bucket", bucket)
 
 	// 1 bucket for file up and downloads
 	err = client.MakeBucket(bucket, *location)
 	if err != nil {
-		log.Fatalf("failed to create bucket %q: %+v\n", bucket, err)
+		log.Printf("failed to create bucket %q: %+v\n", bucket, err)
+		failed = true
+		return
 	}
 
 	data := make([]byte, 1)
@@ -88,7 +281,9 @@ func main() {
 	for k := 0; k < *listsize; k++ {
 		err := client.Upload(bucket, "folder/data"+strconv.Itoa(k), data)
 		if err != nil {
-			log.Fatalf("failed to create file %q: %+v\n", "folder/data"+strconv.Itoa(k), err)
+			log.Printf("failed to create file %q: %+v\n", "folder/data"+strconv.Itoa(k), err)
+			failed = true
+			return
 		}
 	}
 
@@ -97,7 +292,9 @@ func main() {
 	for k := 0; k < *listsize-1; k++ {
 		err := client.Upload(bucket, "folder"+strconv.Itoa(k)+"/data", data)
 		if err != nil {
-			log.Fatalf("failed to create folder %q: %+v\n", "folder"+strconv.Itoa(k)+"/data", err)
+			log.Printf("failed to create folder %q: %+v\n", "folder"+strconv.Itoa(k)+"/data", err)
+			failed = true
+			return
 		}
 	}
 
@@ -106,7 +303,9 @@ func main() {
 		for k := 0; k < *listsize; k++ {
 			err := client.Delete(bucket, "folder/data"+strconv.Itoa(k))
 			if err != nil {
-				log.Fatalf("failed to delete file %q: %+v\n", "folder/data"+strconv.Itoa(k), err)
+				log.Printf("failed to delete file %q: %+v\n", "folder/data"+strconv.Itoa(k), err)
+				failed = true
+				return
 			}
 		}
 
@@ -114,53 +313,165 @@ func main() {
 		for k := 0; k < *listsize-1; k++ {
 			err := client.Delete(bucket, "folder"+strconv.Itoa(k)+"/data")
 			if err != nil {
-				log.Fatalf("failed to delete folder %q: %+v\n", "folder"+strconv.Itoa(k)+"/data", err)
+				log.Printf("failed to delete folder %q: %+v\n", "folder"+strconv.Itoa(k)+"/data", err)
+				failed = true
+				return
 			}
 		}
 
 		log.Println("Removing bucket")
 		err := client.RemoveBucket(bucket)
 		if err != nil {
-			log.Fatalf("failed to remove bucket %q", bucket)
+			log.Printf("failed to remove bucket %q", bucket)
+			failed = true
 		}
-
 	}()
 
 	measurements := []Measurement{}
-	measurement, err := ListBenchmark(client, bucket, *listsize, *count, *duration)
+	measurement, err := ListBenchmark(client, bucket, *listsize, *listpage, *count, *duration)
 	if err != nil {
 		fmt.Println(err)
 		return
 	}
 	measurements = append(measurements, measurement)
 	for _, filesize := range filesizes.Sizes() {
-		measurement, err := FileBenchmark(client, bucket, filesize, *count, *duration)
+		for _, workers := range concurrency {
+			measurement, err := ConcurrentFileBenchmark(client, bucket, filesize, workers, *count, *duration, fileOpts)
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			measurements = append(measurements, measurement)
+		}
+	}
+	if *baselineDir != "" {
+		baseline, err := BaselineBenchmarks(*baselineDir, *baselineFsync, filesizes.Sizes(), *count, *duration)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		measurements = append(measurements, baseline...)
+	}
+	if *multipart {
+	multipartSizes:
+		for _, filesize := range filesizes.Sizes() {
+			for _, partsize := range partsizes.Sizes() {
+				if partsize > filesize {
+					continue
+				}
+				for _, concurrency := range partConcurrency {
+					measurement, err := MultipartBenchmark(client, bucket, filesize, partsize, concurrency, *count, *duration)
+					if errors.Is(err, s3client.ErrUnsupported) {
+						log.Printf("client %q does not support multipart uploads, skipping", *clientName)
+						break multipartSizes
+					}
+					if err != nil {
+						fmt.Println(err)
+						return
+					}
+					measurements = append(measurements, measurement)
+				}
+			}
+		}
+	}
+	if *copyObjects {
+		for _, filesize := range filesizes.Sizes() {
+			measurement, err := CopyBenchmark(client, bucket, filesize, *count, *duration)
+			if errors.Is(err, s3client.ErrUnsupported) {
+				log.Printf("client %q does not support copy or move, skipping", *clientName)
+				break
+			}
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			measurements = append(measurements, measurement)
+		}
+	}
+	if *rangeReads {
+		ranged, err := RangeBenchmarks(client, bucket, rangeObjectSize, rangesizes.Sizes(), *count, *duration, *maxFailures)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		measurements = append(measurements, ranged...)
+	}
+
+	if *workload != "" {
+		weights, err := parseWeights(*workload)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		measurement, err := WorkloadBenchmark(client, bucket, workloadSize, WorkloadOptions{
+			Weights:     weights,
+			Objects:     *workloadObjects,
+			Concurrency: *workloadConcurrency,
+			Duration:    *workloadDuration,
+			Seed:        *workloadSeed,
+			MaxFailures: *maxFailures,
+		})
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		measurements = append(measurements, measurement)
+	}
+
+	if *rate != "" {
+		opts := openloop.Options{
+			Schedule:    rateSchedule,
+			Duration:    *rateDuration,
+			MaxInFlight: *rateMaxInFlight,
+		}
+
+		measurement, err := OpenLoopListBenchmark(client, bucket, *listsize, *listpage, *maxFailures, *rate, opts)
 		if err != nil {
 			fmt.Println(err)
 			return
 		}
 		measurements = append(measurements, measurement)
+		for _, filesize := range filesizes.Sizes() {
+			measurement, err := OpenLoopFileBenchmark(client, bucket, filesize, fileOpts, *rate, opts)
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			measurements = append(measurements, measurement)
+		}
 	}
 
 	fmt.Print("\n\n")
 	w := tabwriter.NewWriter(os.Stdout, 0, 0, 4, ' ', 0)
-	fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\n",
+	var phaseNames, phaseUnits string
+	if hasPhases(measurements) {
+		phaseNames, phaseUnits = phaseHeaders()
+	}
+	fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v%v\n",
 		"Size", "",
 		"Avg", "",
 		"Max", "",
 		"P50", "", "P90", "", "P99", "",
+		phaseNames,
 	)
-	fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\n",
+	fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v%v\n",
 		"", "",
 		"s", "MB/s",
 		"s", "MB/s",
 		"s", "MB/s", "s", "MB/s", "s", "MB/s",
+		phaseUnits,
 	)
 	for _, m := range measurements {
 		m.PrintStats(w)
 	}
 	_ = w.Flush()
 
+	PrintThroughput(os.Stdout, measurements)
+	PrintWorkers(os.Stdout, measurements)
+	PrintOpenLoop(os.Stdout, measurements)
+	PrintConnStats(os.Stdout, conf.Transport.Stats.Counts())
+	PrintFailures(os.Stdout, measurements)
+
 	if *plotname != "" {
 		err := Plot(*plotname, measurements)
 		if err != nil {
@@ -170,193 +481,377 @@ func main() {
 	}
 }
 
-// Measurement contains measurements for different requests.
-type Measurement struct {
-	Size    memory.Size
-	Results []*Result
+// FileOptions configures the file benchmarks.
+type FileOptions struct {
+	// Verify is how the data is verified. "bytes" compares buffered copies
+	// of the data, the others compare hashes of the streams.
+	Verify string
+	// VerifyETag compares the MD5 ETags reported by the backend with the uploaded data.
+	VerifyETag bool
+	// Timings collects the HTTP request phases of the client, nil disables
+	// recording them. It's only enabled while a file benchmark runs, so the
+	// requests of the other benchmarks don't accumulate.
+	Timings *s3client.RequestTimings
+	// MaxFailures is the number of failed iterations tolerated before the
+	// benchmark stops.
+	MaxFailures int
 }
 
-// Result contains durations for specific tests.
-type Result struct {
-	Name      string
-	WithSpeed bool
-	Durations []time.Duration
+// FileBenchmark runs file upload, head, download and delete benchmarks on bucket with given filesize.
+// The data and the ETags are compared with the uploaded data.
+func FileBenchmark(client s3client.Client, bucket string, filesize memory.Size, count int, duration time.Duration) (Measurement, error) {
+	return ConcurrentFileBenchmark(client, bucket, filesize, 1, count, duration, FileOptions{
+		Verify:     "bytes",
+		VerifyETag: true,
+	})
 }
 
-// Result finds or creates a result with the specified name.
-func (m *Measurement) Result(name string) *Result {
-	for _, x := range m.Results {
-		if x.Name == name {
-			return x
-		}
+// ConcurrentFileBenchmark runs the file benchmarks with concurrency workers,
+// each using a distinct key. count limits the iterations of all workers together.
+//
+// The HTTP request phases are only recorded without concurrency, because
+// concurrent requests can't be attributed to the operations.
+func ConcurrentFileBenchmark(client s3client.Client, bucket string, filesize memory.Size, concurrency, count int, duration time.Duration, opts FileOptions) (Measurement, error) {
+	if concurrency > 1 {
+		log.Print("Benchmarking file size ", filesize.String(), " with ", concurrency, " workers ")
+	} else {
+		log.Print("Benchmarking file size ", filesize.String(), " ")
 	}
 
-	r := &Result{}
-	r.Name = name
-	m.Results = append(m.Results, r)
-	return r
-}
+	defer fmt.Println()
 
-// Record records a time measurement.
-func (m *Measurement) Record(name string, duration time.Duration) {
-	r := m.Result(name)
-	r.WithSpeed = false
-	r.Durations = append(r.Durations, duration)
-}
+	measurement := Measurement{}
+	measurement.Size = filesize
+	measurement.Concurrency = concurrency
+	measurement.MaxFailures = opts.MaxFailures
+	if concurrency > 1 {
+		measurement.Scenario = fmt.Sprintf("%d workers", concurrency)
+	}
 
-// RecordSpeed records a time measurement that can be expressed in speed.
-func (m *Measurement) RecordSpeed(name string, duration time.Duration) {
-	r := m.Result(name)
-	r.WithSpeed = true
-	r.Durations = append(r.Durations, duration)
-}
+	// collect the requests of the benchmark only
+	_ = opts.Timings.Take()
+	opts.Timings.SetEnabled(true)
+	defer func() {
+		opts.Timings.SetEnabled(false)
+		_ = opts.Timings.Take()
+	}()
 
-// PrintStats prints important valueas about the measurement.
-func (m *Measurement) PrintStats(w io.Writer) {
-	type Hist struct {
-		*Result
-		*hrtime.Histogram
-	}
-
-	hists := []Hist{}
-	for _, result := range m.Results {
-		hists = append(hists, Hist{
-			Result: result,
-			Histogram: hrtime.NewDurationHistogram(result.Durations, &hrtime.HistogramOptions{
-				BinCount:        10,
-				NiceRange:       true,
-				ClampMaximum:    0,
-				ClampPercentile: 0.999,
-			}),
-		})
-	}
+	var mu sync.Mutex
+	var failure error
+	started := 0
+	start := time.Now()
 
-	sec := func(ns float64) string {
-		return fmt.Sprintf("%.2f", ns/1e9)
-	}
-	speed := func(ns float64) string {
-		return fmt.Sprintf("%.2f", m.Size.MB()/(ns/1e9))
+	// next reserves the next iteration unless the benchmark is done.
+	next := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		if failure != nil || started >= count || time.Since(start) > duration {
+			return false
+		}
+		started++
+		fmt.Print(".")
+		return true
 	}
 
-	for _, hist := range hists {
-		if !hist.WithSpeed {
-			fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\n",
-				m.Size, hist.Name,
-				sec(hist.Average), "",
-				sec(hist.Maximum), "",
-				sec(hist.P50), "",
-				sec(hist.P90), "",
-				sec(hist.P99), "",
-			)
-			continue
+	var wg sync.WaitGroup
+	for worker := 0; worker < concurrency; worker++ {
+		worker := worker
+		key := "data"
+		if concurrency > 1 {
+			key = "data-" + strconv.Itoa(worker)
 		}
-		fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\n",
-			m.Size, hist.Name,
-			sec(hist.Average), speed(hist.Average),
-			sec(hist.Maximum), speed(hist.Maximum),
-			sec(hist.P50), speed(hist.P50),
-			sec(hist.P90), speed(hist.P90),
-			sec(hist.P99), speed(hist.P99),
-		)
+
+		recorder := &s3client.MemoryRecorder{}
+		iteration := fileIterator(s3client.NewInstrumented(client, "", recorder), bucket, key, filesize, opts)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for next() {
+				err := iteration()
+				if err != nil {
+					// the object may be left behind by the failed iteration
+					_ = client.Delete(bucket, key)
+				}
+
+				mu.Lock()
+				timings := opts.Timings.Take()
+				ops := recorder.Take()
+				if err != nil {
+					if err := measurement.RecordFailure(err); err != nil && failure == nil {
+						failure = err
+					}
+					mu.Unlock()
+					continue
+				}
+				recordFileOps(&measurement, worker, ops, timings, opts.Timings != nil && concurrency == 1)
+				mu.Unlock()
+			}
+		}()
 	}
+	wg.Wait()
+
+	measurement.Elapsed = time.Since(start)
+	return measurement, failure
 }
 
-// FileBenchmark runs file upload, download and delete benchmarks on bucket with given filesize.
-func FileBenchmark(client s3client.Client, bucket string, filesize memory.Size, count int, duration time.Duration) (Measurement, error) {
-	log.Print("Benchmarking file size ", filesize.String(), " ")
+// fileIterator returns a function running a single iteration of the file benchmark on key.
+func fileIterator(client s3client.Client, bucket, key string, filesize memory.Size, opts FileOptions) func() error {
+	ctx := context.Background()
+
+	if _, ok := hashes[opts.Verify]; ok {
+		buffer := make([]byte, 32*memory.KiB.Int())
+		return func() error {
+			return streamIteration(ctx, client, bucket, key, filesize.Int64(), opts, buffer)
+		}
+	}
 
 	data := make([]byte, filesize.Int())
 	result := make([]byte, filesize.Int())
 
-	defer fmt.Println()
+	// rand.Read(data[:])
+	for i := range data {
+		data[i] = 'a' + byte(i%26)
+	}
 
-	measurement := Measurement{}
-	measurement.Size = filesize
-	start := time.Now()
-	for k := 0; k < count; k++ {
-		if time.Since(start) > duration {
-			break
-		}
-		fmt.Print(".")
+	var md5sum []byte
+	if opts.VerifyETag {
+		sum := md5.Sum(data)
+		md5sum = sum[:]
+	}
+
+	return func() (err error) {
+		result, err = fileIteration(ctx, client, bucket, key, data, result, md5sum)
+		return err
+	}
+}
 
-		// rand.Read(data[:])
-		for i := range data {
-			data[i] = 'a' + byte(i%26)
+// recordFileOps records the operations of a successful file benchmark iteration of worker.
+func recordFileOps(measurement *Measurement, worker int, ops []s3client.Operation, timings []s3client.RequestTiming, phases bool) {
+	for _, op := range ops {
+		var name string
+		switch op.Op {
+		case "Upload", "Put":
+			name = "Upload"
+			measurement.RecordSpeed(name, op.Duration)
+		case "Stat":
+			name = "Head"
+			measurement.Record(name, op.Duration)
+		case "Download", "Get":
+			name = "Download"
+			measurement.RecordSpeed(name, op.Duration)
+			recordStreaming(measurement, worker, op)
+		case "Delete":
+			name = "Delete"
+			measurement.Record(name, op.Duration)
+		default:
+			continue
+		}
+		measurement.RecordWorker(name, worker)
+		measurement.Ops++
+		measurement.Bytes += op.Bytes
+		if phases {
+			measurement.RecordPhases(name, s3client.PhasesBetween(timings, op.Start, op.End))
 		}
+	}
+}
 
-		{ // uploading
-			start := hrtime.Now()
-			err := client.Upload(bucket, "data", data)
-			finish := hrtime.Now()
-			if err != nil {
-				return measurement, fmt.Errorf("upload failed: %w", err)
-			}
+// recordStreaming records the time to the first and last byte of a streamed
+// download when any data was read. The throughput after the first byte is
+// only recorded when the data took more than one read.
+func recordStreaming(measurement *Measurement, worker int, op s3client.Operation) {
+	if op.FirstByte <= 0 {
+		return
+	}
+	measurement.Record("Download TTFB", op.FirstByte)
+	measurement.RecordWorker("Download TTFB", worker)
+	measurement.RecordSizedSpeed("Download TTLB", memory.Size(op.Bytes), op.LastByte)
+	measurement.RecordWorker("Download TTLB", worker)
+	if op.LastByte > op.FirstByte {
+		measurement.RecordSizedSpeed("Download After First Byte", memory.Size(op.Bytes), op.LastByte-op.FirstByte)
+		measurement.RecordWorker("Download After First Byte", worker)
+	}
+}
 
-			measurement.RecordSpeed("Upload", finish-start)
+// fileIteration uploads, checks, downloads and deletes data at key.
+// The ETag is compared with md5sum unless it's nil.
+func fileIteration(ctx context.Context, client s3client.Client, bucket, key string, data, result, md5sum []byte) ([]byte, error) {
+	{ // uploading
+		err := client.Upload(bucket, key, data)
+		if err != nil {
+			return result, fmt.Errorf("upload failed: %w", err)
 		}
+	}
 
-		{ // downloading
-			start := hrtime.Now()
-			var err error
-			result, err = client.Download(bucket, "data", result)
-			if err != nil {
-				return measurement, fmt.Errorf("get object failed: %w", err)
-			}
-			finish := hrtime.Now()
-
-			if !bytes.Equal(data, result) {
-				return measurement, fmt.Errorf("upload/download do not match: lengths %d and %d", len(data), len(result))
-			}
+	{ // metadata only
+		info, err := client.Stat(ctx, bucket, key)
+		if err != nil {
+			return result, fmt.Errorf("head object failed: %w", err)
+		}
+		if info.Size != int64(len(data)) {
+			return result, fmt.Errorf("head object size does not match: %d and %d: %w", len(data), info.Size, ErrIntegrity)
+		}
+		if err := checkETag(info.ETag, md5sum); err != nil {
+			return result, fmt.Errorf("head object: %w", err)
+		}
+	}
 
-			measurement.RecordSpeed("Download", finish-start)
+	{ // downloading, streamed to time the first and last byte
+		reader, _, err := client.Get(ctx, bucket, key)
+		if err != nil {
+			return result, fmt.Errorf("get object failed: %w", err)
+		}
+		result, err = s3client.ReadInto(reader, result)
+		if closeErr := reader.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return result, fmt.Errorf("get object failed: %w", err)
 		}
 
-		{ // deleting
-			start := hrtime.Now()
-			err := client.Delete(bucket, "data")
-			if err != nil {
-				return measurement, fmt.Errorf("delete failed: %w", err)
-			}
-			finish := hrtime.Now()
+		if !bytes.Equal(data, result) {
+			return result, fmt.Errorf("upload/download do not match: lengths %d and %d: %w", len(data), len(result), ErrIntegrity)
+		}
+	}
 
-			measurement.Record("Delete", finish-start)
+	{ // deleting
+		err := client.Delete(bucket, key)
+		if err != nil {
+			return result, fmt.Errorf("delete failed: %w", err)
 		}
 	}
 
-	return measurement, nil
+	return result, nil
 }
 
 // ListBenchmark runs list buckets, folders and files benchmarks on bucket.
-func ListBenchmark(client s3client.Client, bucket string, listsize int, count int, duration time.Duration) (Measurement, error) {
+//
+// pagesize limits the number of entries requested per page, 0 uses the client default.
+func ListBenchmark(client s3client.Client, bucket string, listsize, pagesize int, count int, duration time.Duration) (Measurement, error) {
 	log.Print("Benchmarking list")
 	defer fmt.Println()
+
+	folders := map[string]bool{"folder/": true}
+	for k := 0; k < listsize-1; k++ {
+		folders["folder"+strconv.Itoa(k)+"/"] = true
+	}
+	files := map[string]bool{}
+	for k := 0; k < listsize; k++ {
+		files["folder/data"+strconv.Itoa(k)] = true
+	}
+
+	recorder := &s3client.MemoryRecorder{}
+	client = s3client.NewInstrumented(client, "", recorder)
+
+	ctx := context.Background()
 	measurement := Measurement{}
 	// measurement.Size = listsize
 	for k := 0; k < count; k++ {
 		{ // list folders
-			start := hrtime.Now()
-			result, err := client.ListObjects(bucket, "")
+			result, err := s3client.ListAll(ctx, client, bucket, s3client.ListOptions{
+				MaxKeys: pagesize,
+			})
 			if err != nil {
 				return measurement, fmt.Errorf("list folders failed: %w", err)
 			}
-			finish := hrtime.Now()
-			if len(result) != listsize {
-				return measurement, fmt.Errorf("list folders result wrong: %+v", len(result))
+			if err := checkListing(result, folders, true); err != nil {
+				return measurement, fmt.Errorf("list folders result wrong: %w", err)
 			}
-			measurement.Record("List Folders", finish-start)
+			measurement.Record("List Folders", totalDuration(recorder.Take()))
 		}
 		{ // list files
-			start := hrtime.Now()
-			result, err := client.ListObjects(bucket, "folder")
+			result, err := s3client.ListAll(ctx, client, bucket, s3client.ListOptions{
+				Prefix:  "folder/",
+				MaxKeys: pagesize,
+			})
 			if err != nil {
 				return measurement, fmt.Errorf("list files failed: %w", err)
 			}
-			finish := hrtime.Now()
-			if len(result) != listsize {
-				return measurement, fmt.Errorf("list files result to low: %+v", len(result))
+			if err := checkListing(result, files, false); err != nil {
+				return measurement, fmt.Errorf("list files result wrong: %w", err)
 			}
-			measurement.Record("List Files", finish-start)
+			measurement.Record("List Files", totalDuration(recorder.Take()))
 		}
 	}
 	return measurement, nil
 }
+
+// totalDuration returns the time spent in the operations.
+func totalDuration(ops []s3client.Operation) time.Duration {
+	var total time.Duration
+	for _, op := range ops {
+		total += op.Duration
+	}
+	return total
+}
+
+// checkListing verifies that entries contain exactly the expected keys, once each,
+// and that they are all prefixes or all objects.
+func checkListing(entries []s3client.ListEntry, expected map[string]bool, prefixes bool) error {
+	seen := map[string]bool{}
+	for _, entry := range entries {
+		if !expected[entry.Key] {
+			return fmt.Errorf("unexpected key %q", entry.Key)
+		}
+		if seen[entry.Key] {
+			return fmt.Errorf("duplicate key %q", entry.Key)
+		}
+		if entry.IsPrefix != prefixes {
+			return fmt.Errorf("key %q: expected prefix %v, got %v", entry.Key, prefixes, entry.IsPrefix)
+		}
+		seen[entry.Key] = true
+	}
+	if len(seen) != len(expected) {
+		return fmt.Errorf("expected %d keys, got %d", len(expected), len(seen))
+	}
+	return nil
+}
+
+// optionsFlag collects repeated key=value options.
+type optionsFlag map[string]string
+
+// String returns the options formatted as flag values.
+func (opts optionsFlag) String() string {
+	var values []string
+	for key, value := range opts {
+		values = append(values, key+"="+value)
+	}
+	sort.Strings(values)
+	return strings.Join(values, ",")
+}
+
+// Set adds a key=value option.
+func (opts optionsFlag) Set(s string) error {
+	tokens := strings.SplitN(s, "=", 2)
+	if len(tokens) != 2 || tokens[0] == "" {
+		return fmt.Errorf("expected key=value, got %q", s)
+	}
+	opts[tokens[0]] = tokens[1]
+	return nil
+}
+
+// intsFlag is a comma separated list of integers.
+type intsFlag []int
+
+// String returns the list formatted as a flag value.
+func (ints *intsFlag) String() string {
+	var values []string
+	for _, value := range *ints {
+		values = append(values, strconv.Itoa(value))
+	}
+	return strings.Join(values, ",")
+}
+
+// Set replaces the list with the parsed value.
+func (ints *intsFlag) Set(s string) error {
+	var values []int
+	for _, token := range strings.Split(s, ",") {
+		value, err := strconv.Atoi(strings.TrimSpace(token))
+		if err != nil {
+			return err
+		}
+		values = append(values, value)
+	}
+	*ints = values
+	return nil
+}
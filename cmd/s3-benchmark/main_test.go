@@ -0,0 +1,309 @@
+// Copyright (C) 2021 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"storj.io/benchmark/internal/s3client"
+	"storj.io/benchmark/internal/s3fake"
+	"storj.io/common/memory"
+)
+
+// newTestClient creates a client with newClient for a fake gateway. The
+// bucket is created unless it's empty.
+func newTestClient(t *testing.T, bucket string, newClient func(s3client.Config) (s3client.Client, error)) (s3client.Client, func()) {
+	server := s3fake.NewServer()
+
+	client, err := newClient(s3client.Config{
+		S3Gateway: server.Addr(),
+		AccessKey: "access",
+		SecretKey: "secret",
+		NoSSL:     true,
+	})
+	if err != nil {
+		server.Close()
+		t.Fatal(err)
+	}
+
+	if bucket != "" {
+		if err := client.MakeBucket(bucket, ""); err != nil {
+			server.Close()
+			t.Fatal(err)
+		}
+	}
+
+	return client, server.Close
+}
+
+func TestFileBenchmark(t *testing.T) {
+	client, cleanup := newTestClient(t, "bucket", s3client.NewMinio)
+	defer cleanup()
+
+	measurement, err := FileBenchmark(client, "bucket", 10*memory.KiB, 3, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"Upload", "Head", "Download", "Delete"} {
+		if got := len(measurement.Result(name).Durations); got != 3 {
+			t.Errorf("%s: expected 3 durations, got %d", name, got)
+		}
+	}
+}
+
+func TestFileBenchmarkStreaming(t *testing.T) {
+	client, cleanup := newTestClient(t, "bucket", s3client.NewMinio)
+	defer cleanup()
+
+	measurement, err := FileBenchmark(client, "bucket", 1*memory.MiB, 3, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	download := measurement.Result("Download")
+	ttfb := measurement.Result("Download TTFB")
+	ttlb := measurement.Result("Download TTLB")
+	if len(ttfb.Durations) != 3 || len(ttlb.Durations) != 3 || !ttlb.WithSpeed || ttfb.WithSpeed {
+		t.Fatalf("unexpected results %+v and %+v", ttfb, ttlb)
+	}
+	for i := range ttfb.Durations {
+		if ttfb.Durations[i] <= 0 || ttfb.Durations[i] > ttlb.Durations[i] || ttlb.Durations[i] > download.Durations[i] {
+			t.Errorf("unexpected timing: first byte %v, last byte %v, download %v", ttfb.Durations[i], ttlb.Durations[i], download.Durations[i])
+		}
+	}
+	if len(measurement.Result("Download After First Byte").Durations) == 0 {
+		t.Error("expected the throughput after the first byte")
+	}
+}
+
+func TestListBenchmark(t *testing.T) {
+	client, cleanup := newTestClient(t, "bucket", s3client.NewMinio)
+	defer cleanup()
+
+	const listsize = 5
+	data := make([]byte, 1)
+	for k := 0; k < listsize; k++ {
+		if err := client.Upload("bucket", "folder/data"+strconv.Itoa(k), data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for k := 0; k < listsize-1; k++ {
+		if err := client.Upload("bucket", "folder"+strconv.Itoa(k)+"/data", data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, pagesize := range []int{0, 2} {
+		measurement, err := ListBenchmark(client, "bucket", listsize, pagesize, 2, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range []string{"List Folders", "List Files"} {
+			if got := len(measurement.Result(name).Durations); got != 2 {
+				t.Errorf("%s: expected 2 durations, got %d", name, got)
+			}
+		}
+	}
+
+	// an extra object must be detected
+	if err := client.Upload("bucket", "folder/extra", data); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ListBenchmark(client, "bucket", listsize, 0, 1, time.Minute); err == nil {
+		t.Fatal("expected listing validation to fail")
+	}
+}
+
+func TestFileBenchmarkFailures(t *testing.T) {
+	client, cleanup := newTestClient(t, "bucket", s3client.NewMinio)
+	defer cleanup()
+
+	faults := s3client.NewFaults(client, s3client.FaultOptions{
+		ErrorRates:  map[string]float64{"Upload": 0.5},
+		CorruptRate: 0.5,
+	})
+
+	opts := FileOptions{Verify: "bytes", VerifyETag: true, MaxFailures: 100}
+	measurement, err := ConcurrentFileBenchmark(faults, "bucket", 1*memory.KiB, 1, 20, time.Minute, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	injected := map[string]int{}
+	for _, fault := range faults.Stats() {
+		injected[fault.Kind] += fault.Count
+	}
+	if injected["error"] == 0 || injected["corrupt"] == 0 {
+		t.Fatalf("expected injected errors and corruptions, got %+v", faults.Stats())
+	}
+	if measurement.Failures["injected"] != injected["error"] || measurement.Failures["integrity"] != injected["corrupt"] {
+		t.Fatalf("failures %v do not match injected faults %v", measurement.Failures, injected)
+	}
+	if got := len(measurement.Result("Upload").Durations); got != 20-injected["error"]-injected["corrupt"] {
+		t.Fatalf("unexpected number of successful iterations %d", got)
+	}
+
+	opts.MaxFailures = 0
+	if _, err := ConcurrentFileBenchmark(faults, "bucket", 1*memory.KiB, 1, 20, time.Minute, opts); err == nil {
+		t.Fatal("expected the benchmark to stop at the first failure")
+	}
+}
+
+func TestBaselineBenchmarks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "baseline")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	measurements, err := BaselineBenchmarks(dir, false, []memory.Size{1 * memory.KiB, 10 * memory.KiB}, 2, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(measurements) != 2 {
+		t.Fatalf("expected 2 measurements, got %d", len(measurements))
+	}
+	if label := measurements[0].Label(); label != (1*memory.KiB).String()+" local fs" {
+		t.Errorf("unexpected label %q", label)
+	}
+	for _, measurement := range measurements {
+		if got := len(measurement.Result("Download").Durations); got != 2 {
+			t.Errorf("%s: expected 2 durations, got %d", measurement.Label(), got)
+		}
+	}
+}
+
+func TestFileBenchmarkPhases(t *testing.T) {
+	opts := FileOptions{
+		Verify:     "bytes",
+		VerifyETag: true,
+		Timings:    &s3client.RequestTimings{},
+	}
+
+	client, cleanup := newTestClient(t, "bucket", func(conf s3client.Config) (s3client.Client, error) {
+		conf.Transport = s3client.TransportConfig{Timings: opts.Timings}
+		return s3client.NewMinio(conf)
+	})
+	defer cleanup()
+
+	measurement, err := ConcurrentFileBenchmark(client, "bucket", 10*memory.KiB, 1, 3, time.Minute, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"Upload", "Head", "Download", "Delete"} {
+		result := measurement.Result(name)
+		if len(result.Phases) != 3 {
+			t.Fatalf("%s: expected 3 phases, got %d", name, len(result.Phases))
+		}
+		for _, phases := range result.Phases {
+			if phases.Requests == 0 || phases.FirstByte <= 0 {
+				t.Errorf("%s: unexpected phases %+v", name, phases)
+			}
+		}
+		if phaseColumns(result) == "" {
+			t.Errorf("%s: expected phase columns", name)
+		}
+	}
+	if !hasPhases([]Measurement{measurement}) {
+		t.Error("expected the measurement to have phases")
+	}
+}
+
+func TestConcurrentFileBenchmark(t *testing.T) {
+	client, cleanup := newTestClient(t, "bucket", s3client.NewMinio)
+	defer cleanup()
+
+	const filesize = 10 * memory.KiB
+	measurement, err := ConcurrentFileBenchmark(client, "bucket", filesize, 4, 20, time.Minute, FileOptions{Verify: "bytes", VerifyETag: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"Upload", "Head", "Download", "Delete"} {
+		result := measurement.Result(name)
+		if len(result.Durations) != 20 || len(result.Workers) != 20 {
+			t.Fatalf("%s: expected 20 samples, got %d and %d workers", name, len(result.Durations), len(result.Workers))
+		}
+		for _, worker := range result.Workers {
+			if worker < 0 || worker >= 4 {
+				t.Fatalf("%s: unexpected worker %d", name, worker)
+			}
+		}
+	}
+	if measurement.Ops != 80 || measurement.Bytes != 20*2*filesize.Int64() || measurement.Elapsed <= 0 {
+		t.Fatalf("unexpected totals: %d ops, %d bytes in %v", measurement.Ops, measurement.Bytes, measurement.Elapsed)
+	}
+	if label := measurement.Label(); label != filesize.String()+" 4 workers" {
+		t.Errorf("unexpected label %q", label)
+	}
+
+	var output strings.Builder
+	PrintThroughput(&output, []Measurement{measurement})
+	PrintWorkers(&output, []Measurement{measurement})
+	if !strings.Contains(output.String(), "Throughput:") || !strings.Contains(output.String(), "Workers:") {
+		t.Errorf("unexpected output %q", output.String())
+	}
+}
+
+// moveOnly is a client that supports moving but not copying, like uplink-lib.
+type moveOnly struct {
+	s3client.Client
+}
+
+func (client moveOnly) Copy(ctx context.Context, srcBucket, srcKey, dstBucket, dstKey string) error {
+	return s3client.ErrUnsupported
+}
+
+func (client moveOnly) Move(ctx context.Context, srcBucket, srcKey, dstBucket, dstKey string) error {
+	if err := client.Client.Copy(ctx, srcBucket, srcKey, dstBucket, dstKey); err != nil {
+		return err
+	}
+	return client.Client.Delete(srcBucket, srcKey)
+}
+
+func TestCopyBenchmark(t *testing.T) {
+	client, cleanup := newTestClient(t, "bucket", s3client.NewMinio)
+	defer cleanup()
+
+	measurement, err := CopyBenchmark(client, "bucket", 1*memory.KiB, 3, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(measurement.Result("Copy").Durations); got != 3 {
+		t.Errorf("expected 3 copies, got %d", got)
+	}
+
+	measurement, err = CopyBenchmark(moveOnly{client}, "bucket", 1*memory.KiB, 3, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if copies, moves := len(measurement.Result("Copy").Durations), len(measurement.Result("Move").Durations); copies != 0 || moves != 3 {
+		t.Errorf("expected only 3 moves, got %d copies and %d moves", copies, moves)
+	}
+
+	// a client that supports neither is skipped, even when it's wrapped
+	unsupported := struct{ s3client.Client }{moveOnly{client}}
+	for _, unsupported := range []s3client.Client{unsupported, s3client.NewInstrumented(unsupported, "", &s3client.MemoryRecorder{})} {
+		if _, err := CopyBenchmark(unsupported, "bucket", 1*memory.KiB, 3, time.Minute); !errors.Is(err, s3client.ErrUnsupported) {
+			t.Fatalf("%T: expected an unsupported error, got %v", unsupported, err)
+		}
+	}
+
+	entries, err := s3client.ListAll(context.Background(), client, "bucket", s3client.ListOptions{Recursive: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("expected the objects to be deleted, got %d", len(entries))
+	}
+}
@@ -0,0 +1,192 @@
+// Copyright (C) 2019 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/loov/hrtime"
+
+	"storj.io/benchmark/internal/openloop"
+	"storj.io/benchmark/internal/s3client"
+	"storj.io/common/memory"
+)
+
+// Measurement contains measurements for different requests.
+type Measurement struct {
+	Size memory.Size
+	// Scenario describes additional parameters of the measurement.
+	Scenario string
+	Results  []*Result
+	// Failures counts the failed iterations by FailureClass.
+	Failures map[string]int
+	// MaxFailures is the number of failed iterations tolerated before the
+	// benchmark stops.
+	MaxFailures int
+
+	// Concurrency is the number of workers and Elapsed the wall time of
+	// the benchmark. Ops and Bytes are the totals of the recorded samples.
+	Concurrency int
+	Elapsed     time.Duration
+	Ops         int
+	Bytes       int64
+	// OpenLoop summarizes the run of an open loop measurement.
+	OpenLoop *openloop.Stats
+}
+
+// Result contains durations for specific tests.
+type Result struct {
+	Name      string
+	WithSpeed bool
+	// Size overrides the measurement size for calculating speed.
+	Size      memory.Size
+	Durations []time.Duration
+	// Phases are the HTTP request phases of the samples, when they are collected.
+	Phases []s3client.Phases
+	// Workers are the workers that recorded the samples.
+	Workers []int
+}
+
+// Label returns the name of the measurement.
+func (m *Measurement) Label() string {
+	if m.Scenario == "" {
+		return m.Size.String()
+	}
+	return m.Size.String() + " " + m.Scenario
+}
+
+// Result finds or creates a result with the specified name.
+func (m *Measurement) Result(name string) *Result {
+	for _, x := range m.Results {
+		if x.Name == name {
+			return x
+		}
+	}
+
+	r := &Result{}
+	r.Name = name
+	m.Results = append(m.Results, r)
+	return r
+}
+
+// Record records a time measurement.
+func (m *Measurement) Record(name string, duration time.Duration) {
+	r := m.Result(name)
+	r.WithSpeed = false
+	r.Durations = append(r.Durations, duration)
+}
+
+// RecordSpeed records a time measurement that can be expressed in speed.
+func (m *Measurement) RecordSpeed(name string, duration time.Duration) {
+	r := m.Result(name)
+	r.WithSpeed = true
+	r.Durations = append(r.Durations, duration)
+}
+
+// RecordSizedSpeed records a time measurement that can be expressed in speed,
+// where the transferred size differs from the measurement size.
+func (m *Measurement) RecordSizedSpeed(name string, size memory.Size, duration time.Duration) {
+	r := m.Result(name)
+	r.WithSpeed = true
+	r.Size = size
+	r.Durations = append(r.Durations, duration)
+}
+
+// RecordPhases adds the HTTP request phases of the last sample of the named result.
+func (m *Measurement) RecordPhases(name string, phases s3client.Phases) {
+	r := m.Result(name)
+	r.Phases = append(r.Phases, phases)
+}
+
+// RecordWorker sets the worker of the last sample of the named result.
+func (m *Measurement) RecordWorker(name string, worker int) {
+	r := m.Result(name)
+	r.Workers = append(r.Workers, worker)
+}
+
+// RecordFailure records a failed iteration. It returns err when
+// the benchmark has failed more than MaxFailures times. Integrity
+// failures are only counted, they don't stop the benchmark.
+func (m *Measurement) RecordFailure(err error) error {
+	if m.Failures == nil {
+		m.Failures = map[string]int{}
+	}
+	m.Failures[FailureClass(err)]++
+
+	total := 0
+	for class, count := range m.Failures {
+		if class != "integrity" {
+			total += count
+		}
+	}
+	if total > m.MaxFailures {
+		return err
+	}
+	return nil
+}
+
+// SpeedSize returns the size used for calculating speed of result.
+func (m *Measurement) SpeedSize(result *Result) memory.Size {
+	if result.Size != 0 {
+		return result.Size
+	}
+	return m.Size
+}
+
+// PrintStats prints important valueas about the measurement.
+func (m *Measurement) PrintStats(w io.Writer) {
+	type Hist struct {
+		*Result
+		*hrtime.Histogram
+	}
+
+	hists := []Hist{}
+	for _, result := range m.Results {
+		hists = append(hists, Hist{
+			Result: result,
+			Histogram: hrtime.NewDurationHistogram(result.Durations, &hrtime.HistogramOptions{
+				BinCount:        10,
+				NiceRange:       true,
+				ClampMaximum:    0,
+				ClampPercentile: 0.999,
+			}),
+		})
+	}
+
+	sec := func(ns float64) string {
+		return fmt.Sprintf("%.2f", ns/1e9)
+	}
+
+	for _, hist := range hists {
+		if !hist.WithSpeed {
+			fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v%v\n",
+				m.Label(), hist.Name,
+				sec(hist.Average), "",
+				sec(hist.Maximum), "",
+				sec(hist.P50), "",
+				sec(hist.P90), "",
+				sec(hist.P99), "",
+				phaseColumns(hist.Result),
+			)
+			continue
+		}
+
+		size := m.SpeedSize(hist.Result)
+		speed := func(ns float64) string {
+			return fmt.Sprintf("%.2f", size.MB()/(ns/1e9))
+		}
+
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v%v\n",
+			m.Label(), hist.Name,
+			sec(hist.Average), speed(hist.Average),
+			sec(hist.Maximum), speed(hist.Maximum),
+			sec(hist.P50), speed(hist.P50),
+			sec(hist.P90), speed(hist.P90),
+			sec(hist.P99), speed(hist.P99),
+			phaseColumns(hist.Result),
+		)
+	}
+}
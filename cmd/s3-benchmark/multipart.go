@@ -0,0 +1,84 @@
+// Copyright (C) 2021 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/loov/hrtime"
+
+	"storj.io/benchmark/internal/s3client"
+	"storj.io/common/memory"
+)
+
+// MultipartBenchmark runs multipart upload benchmarks on bucket with given filesize,
+// part size and number of concurrently uploaded parts. It returns
+// s3client.ErrUnsupported when the backend doesn't support multipart uploads.
+func MultipartBenchmark(client s3client.Client, bucket string, filesize, partsize memory.Size, concurrency int, count int, duration time.Duration) (Measurement, error) {
+	log.Print("Benchmarking multipart file size ", filesize.String(), " part size ", partsize.String(), " concurrency ", concurrency, " ")
+
+	measurement := Measurement{}
+	measurement.Size = filesize
+	measurement.Scenario = fmt.Sprintf("part=%v x%d", partsize, concurrency)
+
+	uploader := s3client.Multipart(client)
+
+	data := make([]byte, filesize.Int())
+	for i := range data {
+		data[i] = 'a' + byte(i%26)
+	}
+
+	defer fmt.Println()
+
+	var mu sync.Mutex
+	options := s3client.MultipartOptions{
+		PartSize:    partsize.Int64(),
+		Concurrency: concurrency,
+		OnPart: func(part s3client.Part, duration time.Duration) {
+			// the last part may be smaller, which would skew the speed
+			if part.Size != partsize.Int64() {
+				return
+			}
+			mu.Lock()
+			measurement.RecordSizedSpeed("Upload Part", partsize, duration)
+			mu.Unlock()
+		},
+	}
+
+	ctx := context.Background()
+	start := time.Now()
+	for k := 0; k < count; k++ {
+		if time.Since(start) > duration {
+			break
+		}
+		fmt.Print(".")
+
+		{ // uploading
+			start := hrtime.Now()
+			err := s3client.UploadMultipart(ctx, uploader, bucket, "data", bytes.NewReader(data), int64(len(data)), options)
+			finish := hrtime.Now()
+			if err != nil {
+				return measurement, fmt.Errorf("multipart upload failed: %w", err)
+			}
+
+			mu.Lock()
+			measurement.RecordSpeed("Multipart Upload", finish-start)
+			mu.Unlock()
+		}
+
+		{ // cleanup
+			err := client.Delete(bucket, "data")
+			if err != nil {
+				return measurement, fmt.Errorf("delete failed: %w", err)
+			}
+		}
+	}
+
+	return measurement, nil
+}
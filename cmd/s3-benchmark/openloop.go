@@ -0,0 +1,160 @@
+// Copyright (C) 2021 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package main
+
+import (
+	"context"
+	"crypto/md5"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"sync"
+	"text/tabwriter"
+
+	"storj.io/benchmark/internal/openloop"
+	"storj.io/benchmark/internal/s3client"
+	"storj.io/common/memory"
+)
+
+// OpenLoopFileBenchmark starts file benchmark iterations, each on its own
+// key, at the rate of the schedule regardless of how long they take. Besides
+// the operations it records the service time of the iterations and their
+// response time from the intended start, which includes queueing.
+func OpenLoopFileBenchmark(client s3client.Client, bucket string, filesize memory.Size, file FileOptions, schedule string, opts openloop.Options) (Measurement, error) {
+	log.Print("Benchmarking file size ", filesize.String(), " with open loop ", schedule, " ")
+
+	measurement := Measurement{}
+	measurement.Size = filesize
+	measurement.Scenario = "open loop " + schedule
+	measurement.MaxFailures = file.MaxFailures
+
+	data := make([]byte, filesize.Int())
+	for i := range data {
+		data[i] = 'a' + byte(i%26)
+	}
+	var md5sum []byte
+	if file.VerifyETag {
+		sum := md5.Sum(data)
+		md5sum = sum[:]
+	}
+
+	iteration := func(ctx context.Context, client s3client.Client, n int) error {
+		key := "open-data-" + strconv.Itoa(n)
+		var err error
+		if _, ok := hashes[file.Verify]; ok {
+			err = streamIteration(ctx, client, bucket, key, filesize.Int64(), file, make([]byte, 32*memory.KiB.Int()))
+		} else {
+			_, err = fileIteration(ctx, client, bucket, key, data, nil, md5sum)
+		}
+		if err != nil {
+			// the object may be left behind by the failed iteration
+			_ = client.Delete(bucket, key)
+		}
+		return err
+	}
+
+	err := runOpenLoop(&measurement, client, opts, "Iteration", iteration, func(ops []s3client.Operation) {
+		recordFileOps(&measurement, 0, ops, nil, false)
+	})
+	return measurement, err
+}
+
+// OpenLoopListBenchmark lists the listsize files created for ListBenchmark
+// at the rate of the schedule and records the service and response times.
+// It tolerates maxFailures failed listings.
+func OpenLoopListBenchmark(client s3client.Client, bucket string, listsize, pagesize, maxFailures int, schedule string, opts openloop.Options) (Measurement, error) {
+	log.Print("Benchmarking list with open loop ", schedule, " ")
+
+	measurement := Measurement{}
+	measurement.Scenario = "open loop " + schedule
+	measurement.MaxFailures = maxFailures
+
+	files := map[string]bool{}
+	for k := 0; k < listsize; k++ {
+		files["folder/data"+strconv.Itoa(k)] = true
+	}
+
+	iteration := func(ctx context.Context, client s3client.Client, n int) error {
+		result, err := s3client.ListAll(ctx, client, bucket, s3client.ListOptions{
+			Prefix:  "folder/",
+			MaxKeys: pagesize,
+		})
+		if err != nil {
+			return fmt.Errorf("list files failed: %w", err)
+		}
+		if err := checkListing(result, files, false); err != nil {
+			return fmt.Errorf("list files result wrong: %w", err)
+		}
+		return nil
+	}
+
+	err := runOpenLoop(&measurement, client, opts, "List Files", iteration, func(ops []s3client.Operation) {
+		measurement.Ops += len(ops)
+	})
+	return measurement, err
+}
+
+// runOpenLoop runs iteration with opts and records the service and response
+// times of the successful iterations as name. The client operations of each
+// successful iteration are passed to record.
+func runOpenLoop(measurement *Measurement, client s3client.Client, opts openloop.Options, name string,
+	iteration func(ctx context.Context, client s3client.Client, n int) error, record func(ops []s3client.Operation)) error {
+	defer fmt.Println()
+
+	// the operations of the iterations by sequence number
+	var mu sync.Mutex
+	operations := map[int][]s3client.Operation{}
+
+	stats, err := openloop.Run(context.Background(), opts, func(ctx context.Context, n int) error {
+		recorder := &s3client.MemoryRecorder{}
+		err := iteration(ctx, s3client.NewInstrumented(client, "", recorder), n)
+
+		mu.Lock()
+		operations[n] = recorder.Take()
+		mu.Unlock()
+		return err
+	}, func(sample openloop.Sample) error {
+		mu.Lock()
+		ops := operations[sample.N]
+		delete(operations, sample.N)
+		mu.Unlock()
+
+		if sample.Err != nil {
+			return measurement.RecordFailure(sample.Err)
+		}
+		record(ops)
+		measurement.Record(name+" Service", sample.Service())
+		measurement.Record(name+" Response", sample.Response())
+		if sample.N%10 == 0 {
+			fmt.Print(".")
+		}
+		return nil
+	})
+
+	measurement.Elapsed = stats.Elapsed
+	measurement.OpenLoop = &stats
+	return err
+}
+
+// PrintOpenLoop prints the operations of the open loop measurements and
+// how late they started, which shows whether the schedule was kept.
+func PrintOpenLoop(w io.Writer, measurements []Measurement) {
+	tw := tabwriter.NewWriter(w, 0, 0, 4, ' ', 0)
+	printed := false
+	for _, m := range measurements {
+		if m.OpenLoop == nil {
+			continue
+		}
+		if !printed {
+			fmt.Fprint(w, "\nOpen loop:\n")
+			fmt.Fprintf(tw, "%v\t%v\t%v\t%v\t%v\n", "Size", "Started", "Completed", "Max in flight", "Max delay")
+			fmt.Fprintf(tw, "%v\t%v\t%v\t%v\t%v\n", "", "", "", "", "s")
+			printed = true
+		}
+		stats := m.OpenLoop
+		fmt.Fprintf(tw, "%v\t%v\t%v\t%v\t%.3f\n", m.Label(), stats.Started, stats.Completed, stats.MaxInFlight, stats.MaxDelay.Seconds())
+	}
+	_ = tw.Flush()
+}
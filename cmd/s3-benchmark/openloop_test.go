@@ -0,0 +1,55 @@
+// Copyright (C) 2021 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"storj.io/benchmark/internal/openloop"
+	"storj.io/benchmark/internal/s3client"
+	"storj.io/common/memory"
+)
+
+func TestOpenLoopFileBenchmark(t *testing.T) {
+	client, cleanup := newTestClient(t, "bucket", s3client.NewMinio)
+	defer cleanup()
+
+	measurement, err := OpenLoopFileBenchmark(client, "bucket", 1*memory.KiB, FileOptions{Verify: "bytes", VerifyETag: true}, "50", openloop.Options{
+		Schedule: openloop.Fixed(50),
+		Duration: 200 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stats := measurement.OpenLoop; stats == nil || stats.Started != 10 || stats.Completed != 10 {
+		t.Fatalf("expected 10 iterations, got %+v", stats)
+	}
+	for _, name := range []string{"Upload", "Head", "Download", "Delete", "Iteration Service", "Iteration Response"} {
+		if got := len(measurement.Result(name).Durations); got != 10 {
+			t.Errorf("%s: expected 10 durations, got %d", name, got)
+		}
+	}
+	if measurement.Ops != 40 || measurement.Bytes != 2*memory.KiB.Int64()*10 {
+		t.Errorf("unexpected totals: %d ops, %d bytes", measurement.Ops, measurement.Bytes)
+	}
+
+	entries, err := s3client.ListAll(context.Background(), client, "bucket", s3client.ListOptions{Recursive: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("expected the objects to be deleted, got %d", len(entries))
+	}
+
+	var out bytes.Buffer
+	PrintOpenLoop(&out, []Measurement{measurement})
+	if !strings.Contains(out.String(), measurement.Label()) {
+		t.Fatalf("missing open loop summary:\n%s", out.String())
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright (C) 2021 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package main
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+
+	"storj.io/benchmark/internal/s3client"
+)
+
+// OperationLog writes every recorded operation as a CSV row.
+type OperationLog struct {
+	mu     sync.Mutex
+	writer *csv.Writer
+}
+
+// NewOperationLog creates an operation log writing to w.
+func NewOperationLog(w io.Writer) *OperationLog {
+	oplog := &OperationLog{writer: csv.NewWriter(w)}
+	_ = oplog.writer.Write([]string{
+		"start", "end", "duration_ns", "backend", "op",
+		"bucket", "key", "bytes", "error_class", "error",
+		"first_byte_ns", "last_byte_ns",
+	})
+	return oplog
+}
+
+// Record writes the operation.
+func (oplog *OperationLog) Record(op s3client.Operation) {
+	errText := ""
+	if op.Err != nil {
+		errText = op.Err.Error()
+	}
+
+	oplog.mu.Lock()
+	defer oplog.mu.Unlock()
+	_ = oplog.writer.Write([]string{
+		op.Start.Format(time.RFC3339Nano),
+		op.End.Format(time.RFC3339Nano),
+		strconv.FormatInt(op.Duration.Nanoseconds(), 10),
+		op.Backend,
+		op.Op,
+		op.Bucket,
+		op.Key,
+		strconv.FormatInt(op.Bytes, 10),
+		op.ErrClass,
+		errText,
+		strconv.FormatInt(op.FirstByte.Nanoseconds(), 10),
+		strconv.FormatInt(op.LastByte.Nanoseconds(), 10),
+	})
+}
+
+// Flush writes buffered rows and returns the first write error.
+func (oplog *OperationLog) Flush() error {
+	oplog.mu.Lock()
+	defer oplog.mu.Unlock()
+	oplog.writer.Flush()
+	return oplog.writer.Error()
+}
@@ -0,0 +1,66 @@
+// Copyright (C) 2021 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"storj.io/benchmark/internal/s3client"
+)
+
+// phaseNames are the headers of the phase columns.
+var phaseNames = []string{"DNS", "Connect", "TLS", "Write", "TTFB", "Transfer"}
+
+// hasPhases returns whether any of the measurements contains request phases.
+func hasPhases(measurements []Measurement) bool {
+	for _, m := range measurements {
+		for _, result := range m.Results {
+			if len(result.Phases) > 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// phaseHeaders returns the header rows of the phase columns.
+func phaseHeaders() (names, units string) {
+	for _, name := range phaseNames {
+		names += "\t" + name
+		units += "\tms"
+	}
+	return names, units
+}
+
+// phaseColumns returns the average request phases of the result's samples
+// as columns. Samples without HTTP requests are not included.
+func phaseColumns(result *Result) string {
+	var total s3client.Phases
+	samples := 0
+	for _, phases := range result.Phases {
+		if phases.Requests == 0 {
+			continue
+		}
+		samples++
+		total.DNS += phases.DNS
+		total.Connect += phases.Connect
+		total.TLS += phases.TLS
+		total.Write += phases.Write
+		total.FirstByte += phases.FirstByte
+		total.Transfer += phases.Transfer
+	}
+	if samples == 0 {
+		return ""
+	}
+
+	ms := func(d time.Duration) string {
+		return fmt.Sprintf("%.1f", float64(d)/float64(samples)/1e6)
+	}
+	return "\t" + strings.Join([]string{
+		ms(total.DNS), ms(total.Connect), ms(total.TLS),
+		ms(total.Write), ms(total.FirstByte), ms(total.Transfer),
+	}, "\t")
+}
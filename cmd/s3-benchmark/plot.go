@@ -41,7 +41,7 @@ func Plot(filename string, measurements []Measurement) error {
 	for _, m := range measurements {
 		row := plot.NewHFlex()
 		rows.Add(row)
-		row.Add(35, plot.NewTextbox(m.Size.String()))
+		row.Add(35, plot.NewTextbox(m.Label()))
 
 		plots := plot.NewVStack()
 		row.Add(0, plots)
@@ -71,8 +71,9 @@ func Plot(filename string, measurements []Measurement) error {
 					continue
 				}
 
-				speed := plot.NewDensity("MB/s", asSpeed(result.Durations, m.Size.Int64()))
-				speed.Stroke = palette[i%len(palette)]
+				density := plot.NewDensity("MB/s", asSpeed(result.Durations, m.SpeedSize(result).Int64()))
+				density.Stroke = palette[i%len(palette)]
+				group = append(group, density)
 			}
 
 			group = append(group, plot.NewTickLabels())
@@ -0,0 +1,104 @@
+// Copyright (C) 2021 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"math/rand"
+	"time"
+
+	"github.com/loov/hrtime"
+
+	"storj.io/benchmark/internal/s3client"
+	"storj.io/common/memory"
+)
+
+// RangeBenchmarks uploads an object of objectsize and runs random-offset ranged read
+// benchmarks on it for each of the rangesizes. Each benchmark tolerates maxFailures
+// failed reads.
+func RangeBenchmarks(client s3client.Client, bucket string, objectsize memory.Size, rangesizes []memory.Size, count int, duration time.Duration, maxFailures int) (_ []Measurement, err error) {
+	const objectName = "range-data"
+
+	log.Print("Uploading ", objectsize.String(), " object for ranged reads")
+
+	data := make([]byte, objectsize.Int())
+	for i := range data {
+		data[i] = 'a' + byte(i%26)
+	}
+
+	err = client.Upload(bucket, objectName, data)
+	if err != nil {
+		return nil, fmt.Errorf("upload failed: %w", err)
+	}
+	defer func() {
+		if deleteErr := client.Delete(bucket, objectName); deleteErr != nil && err == nil {
+			err = fmt.Errorf("delete failed: %w", deleteErr)
+		}
+	}()
+
+	measurements := []Measurement{}
+	for _, rangesize := range rangesizes {
+		if rangesize > objectsize {
+			continue
+		}
+
+		measurement, err := RangeBenchmark(client, bucket, objectName, data, rangesize, count, duration, maxFailures)
+		if err != nil {
+			return measurements, err
+		}
+		measurements = append(measurements, measurement)
+	}
+
+	return measurements, nil
+}
+
+// RangeBenchmark runs ranged reads of rangesize at random offsets of the object with the given data.
+func RangeBenchmark(client s3client.Client, bucket, objectName string, data []byte, rangesize memory.Size, count int, duration time.Duration, maxFailures int) (Measurement, error) {
+	log.Print("Benchmarking range size ", rangesize.String(), " ")
+
+	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+	result := make([]byte, rangesize.Int())
+
+	defer fmt.Println()
+
+	measurement := Measurement{}
+	measurement.Size = rangesize
+	measurement.Scenario = fmt.Sprintf("of %v", memory.Size(len(data)))
+	measurement.MaxFailures = maxFailures
+	start := time.Now()
+	for k := 0; k < count; k++ {
+		if time.Since(start) > duration {
+			break
+		}
+		fmt.Print(".")
+
+		offset := rng.Int63n(int64(len(data)) - rangesize.Int64() + 1)
+
+		start := hrtime.Now()
+		var err error
+		result, err = client.DownloadRange(bucket, objectName, offset, rangesize.Int64(), result)
+		if err != nil {
+			if err := measurement.RecordFailure(fmt.Errorf("ranged read failed: %w", err)); err != nil {
+				return measurement, err
+			}
+			continue
+		}
+		finish := hrtime.Now()
+
+		expected := data[offset : offset+rangesize.Int64()]
+		if !bytes.Equal(expected, result) {
+			err := fmt.Errorf("ranged read at %d does not match: lengths %d and %d: %w", offset, len(expected), len(result), ErrIntegrity)
+			if err := measurement.RecordFailure(err); err != nil {
+				return measurement, err
+			}
+			continue
+		}
+
+		measurement.RecordSpeed("Range Read", finish-start)
+	}
+
+	return measurement, nil
+}
@@ -0,0 +1,43 @@
+// Copyright (C) 2021 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+
+	"storj.io/benchmark/internal/s3client"
+)
+
+// PrintRetryStats prints the number of attempts per operation and the causes of retries.
+//
+// stats is called when printing, so that it includes operations done after deferring the call.
+func PrintRetryStats(w io.Writer, stats func() []s3client.RetryStats) {
+	fmt.Fprint(w, "\n\n")
+	tw := tabwriter.NewWriter(w, 0, 0, 4, ' ', 0)
+	fmt.Fprintf(tw, "%v\t%v\t%v\t%v\t%v\n", "Operation", "Calls", "Attempts", "Attempts/Call", "Failures")
+
+	var causes []string
+	for _, op := range stats() {
+		fmt.Fprintf(tw, "%v\t%v\t%v\t%.2f\t%v\n", op.Op, op.Calls, op.Attempts, op.AttemptsPerCall(), op.Failures)
+		for cause, count := range op.Causes {
+			causes = append(causes, fmt.Sprintf("%v\t%v\t%v", op.Op, count, cause))
+		}
+	}
+	_ = tw.Flush()
+
+	if len(causes) == 0 {
+		return
+	}
+	sort.Strings(causes)
+
+	fmt.Fprint(w, "\nRetry causes:\n")
+	tw = tabwriter.NewWriter(w, 0, 0, 4, ' ', 0)
+	for _, cause := range causes {
+		fmt.Fprintln(tw, cause)
+	}
+	_ = tw.Flush()
+}
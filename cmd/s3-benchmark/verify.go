@@ -0,0 +1,204 @@
+// Copyright (C) 2021 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+
+	"github.com/zeebo/blake3"
+
+	"storj.io/benchmark/internal/s3client"
+)
+
+// hashes are the hash methods for streaming verification.
+var hashes = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha256": sha256.New,
+	"blake3": func() hash.Hash { return blake3.New() },
+}
+
+// checkVerifyMethod returns an error when method is not a known verification method.
+func checkVerifyMethod(method string) error {
+	if _, ok := hashes[method]; ok || method == "bytes" {
+		return nil
+	}
+	return fmt.Errorf("unknown verification method %q, expected bytes, md5, sha256 or blake3", method)
+}
+
+// checkETag compares etag with the MD5 sum of the uploaded data, a nil sum
+// skips the check. ETags that aren't MD5 sums, e.g. of multipart uploads,
+// can't be checked.
+func checkETag(etag string, md5sum []byte) error {
+	if md5sum == nil {
+		return nil
+	}
+	etag = strings.Trim(etag, `"`)
+	sum, err := hex.DecodeString(etag)
+	if err != nil || len(sum) != md5.Size {
+		return nil
+	}
+	if !bytes.Equal(sum, md5sum) {
+		return fmt.Errorf("etag %s does not match the uploaded md5 %x: %w", etag, md5sum, ErrIntegrity)
+	}
+	return nil
+}
+
+// streamIteration uploads, checks, downloads and deletes size bytes of
+// generated data at key without buffering it. The downloaded data is
+// verified by comparing its hash using opts.Verify with the hash of the
+// uploaded data.
+func streamIteration(ctx context.Context, client s3client.Client, bucket, key string, size int64, opts FileOptions, buffer []byte) error {
+	method := opts.Verify
+	newHash := hashes[method]
+	uploaded := newHash()
+
+	var md5sum []byte
+	{ // uploading
+		data := &hashingReader{reader: &patternReader{size: size}, hashes: []hash.Hash{uploaded}}
+		etagHash := uploaded
+		if opts.VerifyETag && method != "md5" {
+			etagHash = md5.New()
+			data.hashes = append(data.hashes, etagHash)
+		}
+
+		err := client.Put(ctx, bucket, key, data, size, s3client.PutOptions{})
+		if err != nil {
+			return fmt.Errorf("upload failed: %w", err)
+		}
+		if opts.VerifyETag {
+			md5sum = etagHash.Sum(nil)
+		}
+	}
+
+	{ // metadata only
+		info, err := client.Stat(ctx, bucket, key)
+		if err != nil {
+			return fmt.Errorf("head object failed: %w", err)
+		}
+		if info.Size != size {
+			return fmt.Errorf("head object size does not match: %d and %d: %w", size, info.Size, ErrIntegrity)
+		}
+		if err := checkETag(info.ETag, md5sum); err != nil {
+			return fmt.Errorf("head object: %w", err)
+		}
+	}
+
+	{ // downloading
+		reader, info, err := client.Get(ctx, bucket, key)
+		if err != nil {
+			return fmt.Errorf("get object failed: %w", err)
+		}
+		downloaded := newHash()
+		n, err := io.CopyBuffer(downloaded, reader, buffer)
+		if closeErr := reader.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return fmt.Errorf("get object failed: %w", err)
+		}
+
+		if n != size {
+			return fmt.Errorf("upload/download do not match: lengths %d and %d: %w", size, n, ErrIntegrity)
+		}
+		if err := checkETag(info.ETag, md5sum); err != nil {
+			return fmt.Errorf("get object: %w", err)
+		}
+		if !bytes.Equal(uploaded.Sum(nil), downloaded.Sum(nil)) {
+			return fmt.Errorf("upload/download do not match: %s %x and %x: %w", method, uploaded.Sum(nil), downloaded.Sum(nil), ErrIntegrity)
+		}
+	}
+
+	{ // deleting
+		err := client.Delete(bucket, key)
+		if err != nil {
+			return fmt.Errorf("delete failed: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// patternReader generates size bytes of the data used by FileBenchmark.
+type patternReader struct {
+	size   int64
+	offset int64
+}
+
+// Read generates the next bytes of the data.
+func (reader *patternReader) Read(p []byte) (int, error) {
+	if reader.offset >= reader.size {
+		return 0, io.EOF
+	}
+	if remaining := reader.size - reader.offset; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+	for i := range p {
+		p[i] = 'a' + byte((reader.offset+int64(i))%26)
+	}
+	reader.offset += int64(len(p))
+	return len(p), nil
+}
+
+// Seek sets the offset of the next Read.
+func (reader *patternReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += reader.offset
+	case io.SeekEnd:
+		offset += reader.size
+	}
+	if offset < 0 {
+		return 0, errors.New("negative offset")
+	}
+	reader.offset = offset
+	return offset, nil
+}
+
+// hashingReader hashes the data read from reader once, in order. Data that
+// is read again after seeking back, e.g. when retrying an upload, isn't
+// hashed again.
+type hashingReader struct {
+	reader io.ReadSeeker
+	hashes []hash.Hash
+	// offset is the position of the next Read and hashed the number of
+	// bytes hashed so far.
+	offset int64
+	hashed int64
+}
+
+// Read reads from the underlying reader and hashes the data that hasn't been hashed yet.
+func (reader *hashingReader) Read(p []byte) (int, error) {
+	if reader.offset > reader.hashed {
+		return 0, errors.New("hashing reader can't skip data")
+	}
+	n, err := reader.reader.Read(p)
+	if end := reader.offset + int64(n); end > reader.hashed {
+		for _, h := range reader.hashes {
+			_, _ = h.Write(p[reader.hashed-reader.offset : n])
+		}
+		reader.hashed = end
+	}
+	reader.offset += int64(n)
+	return n, err
+}
+
+// Seek seeks the underlying reader, e.g. for determining the size or
+// rewinding for a retry.
+func (reader *hashingReader) Seek(offset int64, whence int) (int64, error) {
+	offset, err := reader.reader.Seek(offset, whence)
+	if err != nil {
+		return offset, err
+	}
+	reader.offset = offset
+	return offset, nil
+}
@@ -0,0 +1,123 @@
+// Copyright (C) 2021 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package main
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"errors"
+	"hash"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"storj.io/benchmark/internal/s3client"
+	"storj.io/common/memory"
+)
+
+func TestFileBenchmarkVerify(t *testing.T) {
+	for name, newClient := range map[string]func(s3client.Config) (s3client.Client, error){
+		"minio":   s3client.NewMinio,
+		"aws-sdk": s3client.NewAWSSDK,
+	} {
+		newClient := newClient
+		t.Run(name, func(t *testing.T) {
+			client, cleanup := newTestClient(t, "bucket", newClient)
+			defer cleanup()
+			testFileBenchmarkVerify(t, client)
+		})
+	}
+}
+
+func testFileBenchmarkVerify(t *testing.T, client s3client.Client) {
+	for _, method := range []string{"bytes", "md5", "sha256", "blake3"} {
+		opts := FileOptions{Verify: method, VerifyETag: true}
+
+		measurement, err := ConcurrentFileBenchmark(client, "bucket", 100*memory.KiB, 1, 2, time.Minute, opts)
+		if err != nil {
+			t.Fatalf("%s: %v", method, err)
+		}
+		for _, name := range []string{"Upload", "Head", "Download", "Delete"} {
+			if got := len(measurement.Result(name).Durations); got != 2 {
+				t.Errorf("%s: %s: expected 2 durations, got %d", method, name, got)
+			}
+		}
+
+		// integrity failures are recorded without stopping the benchmark
+		corrupting := s3client.NewFaults(client, s3client.FaultOptions{CorruptRate: 1})
+		measurement, err = ConcurrentFileBenchmark(corrupting, "bucket", 100*memory.KiB, 1, 2, time.Minute, opts)
+		if err != nil {
+			t.Fatalf("%s: %v", method, err)
+		}
+		if measurement.Failures["integrity"] != 2 || len(measurement.Failures) != 1 {
+			t.Errorf("%s: expected 2 integrity failures, got %v", method, measurement.Failures)
+		}
+	}
+}
+
+func TestHashingReader(t *testing.T) {
+	const size = 1000
+	expected := sha256.New()
+	_, _ = io.Copy(expected, &patternReader{size: size})
+
+	hashed := sha256.New()
+	reader := &hashingReader{reader: &patternReader{size: size}, hashes: []hash.Hash{hashed}}
+
+	// determine the size like aws.SeekerLen
+	if _, err := reader.Seek(0, io.SeekCurrent); err != nil {
+		t.Fatal(err)
+	}
+	end, err := reader.Seek(0, io.SeekEnd)
+	if err != nil || end != size {
+		t.Fatalf("unexpected end %d: %v", end, err)
+	}
+	if _, err := reader.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+
+	// read partially and retry from the start
+	if _, err := io.CopyN(ioutil.Discard, reader, 300); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reader.Seek(100, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.Copy(ioutil.Discard, reader); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(hashed.Sum(nil), expected.Sum(nil)) {
+		t.Fatal("hash does not match the data")
+	}
+
+	// skipping data can't be hashed
+	reader = &hashingReader{reader: &patternReader{size: size}, hashes: []hash.Hash{sha256.New()}}
+	if _, err := reader.Seek(10, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reader.Read(make([]byte, 10)); err == nil {
+		t.Fatal("expected an error when skipping data")
+	}
+}
+
+func TestCheckETag(t *testing.T) {
+	sum := md5.Sum([]byte("data"))
+
+	for _, etag := range []string{`"8d777f385d3dfec8815d20f7496026dc"`, "8d777f385d3dfec8815d20f7496026dc", "8d777f385d3dfec8815d20f7496026dc-2", "", "not-md5"} {
+		if err := checkETag(etag, sum[:]); err != nil {
+			t.Errorf("%q: unexpected error %v", etag, err)
+		}
+	}
+
+	err := checkETag(`"00000000000000000000000000000000"`, sum[:])
+	if !errors.Is(err, ErrIntegrity) {
+		t.Errorf("expected an integrity failure, got %v", err)
+	}
+
+	if err := checkVerifyMethod("crc32"); err == nil {
+		t.Error("expected an error for an unknown method")
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright (C) 2021 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"storj.io/common/memory"
+)
+
+// PrintThroughput prints the aggregate throughput and operation rate of
+// the measurements that were timed as a whole.
+func PrintThroughput(w io.Writer, measurements []Measurement) {
+	tw := tabwriter.NewWriter(w, 0, 0, 4, ' ', 0)
+	printed := false
+	for _, m := range measurements {
+		if m.Elapsed <= 0 {
+			continue
+		}
+		if !printed {
+			fmt.Fprint(w, "\nThroughput:\n")
+			fmt.Fprintf(tw, "%v\t%v\t%v\t%v\t%v\n", "Size", "Workers", "Elapsed", "MB/s", "Ops/s")
+			fmt.Fprintf(tw, "%v\t%v\t%v\t%v\t%v\n", "", "", "s", "", "")
+			printed = true
+		}
+		seconds := m.Elapsed.Seconds()
+		fmt.Fprintf(tw, "%v\t%v\t%.2f\t%.2f\t%.2f\n",
+			m.Label(), m.Concurrency, seconds,
+			memory.Size(m.Bytes).MB()/seconds, float64(m.Ops)/seconds,
+		)
+	}
+	_ = tw.Flush()
+}
+
+// PrintWorkers prints the samples and average durations per worker of the
+// concurrent measurements, which shows how fairly the streams were served.
+func PrintWorkers(w io.Writer, measurements []Measurement) {
+	tw := tabwriter.NewWriter(w, 0, 0, 4, ' ', 0)
+	printed := false
+	for _, m := range measurements {
+		if m.Concurrency <= 1 {
+			continue
+		}
+		if !printed {
+			fmt.Fprint(w, "\nWorkers:\n")
+			fmt.Fprintf(tw, "%v\t%v\t%v\t%v\t%v\n", "Size", "", "Worker", "Samples", "Avg")
+			fmt.Fprintf(tw, "%v\t%v\t%v\t%v\t%v\n", "", "", "", "", "s")
+			printed = true
+		}
+
+		for _, result := range m.Results {
+			samples := make([]int, m.Concurrency)
+			totals := make([]time.Duration, m.Concurrency)
+			for i, worker := range result.Workers {
+				samples[worker]++
+				totals[worker] += result.Durations[i]
+			}
+			for worker := range samples {
+				avg := ""
+				if samples[worker] > 0 {
+					avg = fmt.Sprintf("%.2f", totals[worker].Seconds()/float64(samples[worker]))
+				}
+				fmt.Fprintf(tw, "%v\t%v\t%v\t%v\t%v\n", m.Label(), result.Name, worker, samples[worker], avg)
+			}
+		}
+	}
+	_ = tw.Flush()
+}
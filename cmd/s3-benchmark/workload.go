@@ -0,0 +1,345 @@
+// Copyright (C) 2021 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/loov/hrtime"
+
+	"storj.io/benchmark/internal/s3client"
+	"storj.io/common/memory"
+)
+
+// workloadOps are the operations of a workload and their result names.
+var workloadOps = map[string]string{
+	"get":    "Get",
+	"put":    "Put",
+	"head":   "Head",
+	"list":   "List",
+	"delete": "Delete",
+}
+
+// WorkloadOptions configures a mixed workload.
+type WorkloadOptions struct {
+	// Weights are the relative frequencies of the operations get, put,
+	// head, list and delete.
+	Weights map[string]int
+	// Objects is the number of keys, which are uploaded before the workload.
+	Objects     int
+	Concurrency int
+	Duration    time.Duration
+	Seed        int64
+	// MaxFailures is the number of failed operations tolerated before the
+	// workload stops.
+	MaxFailures int
+}
+
+// parseWeights parses a comma separated list of operation=weight pairs.
+func parseWeights(s string) (map[string]int, error) {
+	weights := map[string]int{}
+	total := 0
+	for _, pair := range strings.Split(s, ",") {
+		tokens := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+		if len(tokens) != 2 {
+			return nil, fmt.Errorf("invalid weight %q, expected operation=weight", pair)
+		}
+		op := strings.ToLower(tokens[0])
+		if _, ok := workloadOps[op]; !ok {
+			return nil, fmt.Errorf("unknown workload operation %q, expected get, put, head, list or delete", tokens[0])
+		}
+		weight, err := strconv.Atoi(tokens[1])
+		if err != nil || weight < 0 {
+			return nil, fmt.Errorf("invalid weight %q for %q", tokens[1], op)
+		}
+		weights[op] += weight
+		total += weight
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("workload %q has no operations", s)
+	}
+	return weights, nil
+}
+
+// WorkloadBenchmark runs randomly chosen operations on a pool of objects
+// with filesize for the duration and records the latency per operation.
+func WorkloadBenchmark(client s3client.Client, bucket string, filesize memory.Size, opts WorkloadOptions) (_ Measurement, err error) {
+	log.Print("Benchmarking workload with file size ", filesize.String(), " and ", opts.Concurrency, " workers ")
+
+	measurement := Measurement{}
+	measurement.Size = filesize
+	measurement.Scenario = "workload"
+	measurement.Concurrency = opts.Concurrency
+	measurement.MaxFailures = opts.MaxFailures
+
+	if opts.Concurrency < 1 {
+		return measurement, fmt.Errorf("invalid workload concurrency %d", opts.Concurrency)
+	}
+
+	data := make([]byte, filesize.Int())
+	for i := range data {
+		data[i] = 'a' + byte(i%26)
+	}
+
+	// the cleanup deletes the objects uploaded before a failure as well
+	pool := newObjectPool(opts.Objects)
+	defer func() {
+		if cleanupErr := pool.cleanup(client, bucket); cleanupErr != nil && err == nil {
+			err = cleanupErr
+		}
+	}()
+	if err := pool.populate(client, bucket, data, opts.Concurrency); err != nil {
+		return measurement, err
+	}
+
+	ops := make([]string, 0, len(opts.Weights))
+	for op := range opts.Weights {
+		ops = append(ops, op)
+	}
+	sort.Strings(ops)
+
+	defer fmt.Println()
+
+	var mu sync.Mutex
+	var failure error
+	start := time.Now()
+
+	var wg sync.WaitGroup
+	for worker := 0; worker < opts.Concurrency; worker++ {
+		worker := worker
+		rng := rand.New(rand.NewSource(opts.Seed + int64(worker)))
+		buffer := make([]byte, filesize.Int())
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for time.Since(start) < opts.Duration {
+				mu.Lock()
+				done := failure != nil
+				mu.Unlock()
+				if done {
+					return
+				}
+
+				op := chooseOp(rng, ops, opts.Weights)
+				duration, n, err := runWorkloadOp(client, bucket, pool, rng, op, data, buffer)
+				if duration < 0 {
+					// no object was available for the operation, wait for
+					// the other workers to release or create one
+					time.Sleep(time.Millisecond)
+					continue
+				}
+
+				mu.Lock()
+				if err != nil {
+					if err := measurement.RecordFailure(fmt.Errorf("%s failed: %w", op, err)); err != nil && failure == nil {
+						failure = err
+					}
+				} else {
+					name := workloadOps[op]
+					if n > 0 {
+						measurement.RecordSpeed(name, duration)
+					} else {
+						measurement.Record(name, duration)
+					}
+					measurement.RecordWorker(name, worker)
+					measurement.Ops++
+					measurement.Bytes += n
+					if measurement.Ops%100 == 0 {
+						fmt.Print(".")
+					}
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	measurement.Elapsed = time.Since(start)
+	return measurement, failure
+}
+
+// chooseOp returns a random operation according to the weights.
+func chooseOp(rng *rand.Rand, ops []string, weights map[string]int) string {
+	total := 0
+	for _, op := range ops {
+		total += weights[op]
+	}
+	n := rng.Intn(total)
+	for _, op := range ops {
+		if n < weights[op] {
+			return op
+		}
+		n -= weights[op]
+	}
+	return ops[len(ops)-1]
+}
+
+// runWorkloadOp runs op on a random object of the pool. It returns a
+// negative duration when no object was available.
+func runWorkloadOp(client s3client.Client, bucket string, pool *objectPool, rng *rand.Rand, op string, data, buffer []byte) (time.Duration, int64, error) {
+	ctx := context.Background()
+
+	if op == "list" {
+		start := hrtime.Now()
+		_, err := client.ListObjects(ctx, bucket, s3client.ListOptions{Prefix: workloadPrefix, Recursive: true})
+		return hrtime.Since(start), 0, err
+	}
+
+	// put creates or replaces any object, the others need an existing one
+	index, ok := pool.acquire(rng, op != "put")
+	if !ok {
+		return -1, 0, nil
+	}
+	key := pool.key(index)
+	exists := true
+	defer func() { pool.release(index, exists) }()
+
+	start := hrtime.Now()
+	switch op {
+	case "get":
+		result, err := client.Download(bucket, key, buffer)
+		duration := hrtime.Since(start)
+		if err == nil && !bytes.Equal(result, data) {
+			err = fmt.Errorf("%q does not match: lengths %d and %d: %w", key, len(data), len(result), ErrIntegrity)
+		}
+		return duration, int64(len(result)), err
+	case "put":
+		err := client.Upload(bucket, key, data)
+		duration := hrtime.Since(start)
+		// a failed upload may have replaced the object
+		exists = err == nil || pool.exists(index)
+		return duration, int64(len(data)), err
+	case "head":
+		_, err := client.Stat(ctx, bucket, key)
+		return hrtime.Since(start), 0, err
+	case "delete":
+		err := client.Delete(bucket, key)
+		exists = err != nil
+		return hrtime.Since(start), 0, err
+	}
+	panic("unknown workload operation " + op)
+}
+
+// workloadPrefix is the prefix of the workload objects.
+const workloadPrefix = "workload/"
+
+// objectPool tracks which keys of the workload exist and which are in use,
+// so that concurrent operations don't interfere.
+type objectPool struct {
+	mu    sync.Mutex
+	exist []bool
+	inUse []bool
+}
+
+// newObjectPool creates a pool of n keys, which don't exist yet.
+func newObjectPool(n int) *objectPool {
+	return &objectPool{
+		exist: make([]bool, n),
+		inUse: make([]bool, n),
+	}
+}
+
+// key returns the object key of index.
+func (pool *objectPool) key(index int) string {
+	return fmt.Sprintf("%s%08d", workloadPrefix, index)
+}
+
+// exists returns whether the object of index exists.
+func (pool *objectPool) exists(index int) bool {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	return pool.exist[index]
+}
+
+// acquire reserves a random unused key, which must exist when mustExist is set.
+func (pool *objectPool) acquire(rng *rand.Rand, mustExist bool) (int, bool) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	candidates := make([]int, 0, len(pool.exist))
+	for index, exists := range pool.exist {
+		if !pool.inUse[index] && (exists || !mustExist) {
+			candidates = append(candidates, index)
+		}
+	}
+	if len(candidates) == 0 {
+		return 0, false
+	}
+	index := candidates[rng.Intn(len(candidates))]
+	pool.inUse[index] = true
+	return index, true
+}
+
+// release makes the key available again and records whether the object exists.
+func (pool *objectPool) release(index int, exists bool) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	pool.inUse[index] = false
+	pool.exist[index] = exists
+}
+
+// populate uploads all objects of the pool with concurrency uploads at a time.
+func (pool *objectPool) populate(client s3client.Client, bucket string, data []byte, concurrency int) error {
+	indexes := make(chan int)
+	failures := make(chan error, concurrency)
+
+	var wg sync.WaitGroup
+	for worker := 0; worker < concurrency; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range indexes {
+				if err := client.Upload(bucket, pool.key(index), data); err != nil {
+					failures <- fmt.Errorf("populating failed: %w", err)
+					return
+				}
+				pool.release(index, true)
+			}
+		}()
+	}
+
+	var err error
+feed:
+	for index := range pool.exist {
+		select {
+		case indexes <- index:
+		case err = <-failures:
+			break feed
+		}
+	}
+	close(indexes)
+	wg.Wait()
+
+	if err == nil {
+		select {
+		case err = <-failures:
+		default:
+		}
+	}
+	return err
+}
+
+// cleanup deletes the existing objects of the pool.
+func (pool *objectPool) cleanup(client s3client.Client, bucket string) error {
+	for index := range pool.exist {
+		if !pool.exists(index) {
+			continue
+		}
+		if err := client.Delete(bucket, pool.key(index)); err != nil {
+			return fmt.Errorf("delete failed: %w", err)
+		}
+		pool.release(index, false)
+	}
+	return nil
+}
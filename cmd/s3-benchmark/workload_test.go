@@ -0,0 +1,115 @@
+// Copyright (C) 2021 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"storj.io/benchmark/internal/s3client"
+	"storj.io/common/memory"
+)
+
+func TestParseWeights(t *testing.T) {
+	weights, err := parseWeights("get=70, put=20,LIST=5,delete=5,head=0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if weights["get"] != 70 || weights["put"] != 20 || weights["list"] != 5 || weights["delete"] != 5 || weights["head"] != 0 {
+		t.Fatalf("unexpected weights %v", weights)
+	}
+
+	for _, invalid := range []string{"", "get", "get=-1", "copy=1", "get=0"} {
+		if _, err := parseWeights(invalid); err == nil {
+			t.Errorf("%q: expected an error", invalid)
+		}
+	}
+}
+
+func TestWorkloadBenchmark(t *testing.T) {
+	client, cleanup := newTestClient(t, "bucket", s3client.NewMinio)
+	defer cleanup()
+
+	measurement, err := WorkloadBenchmark(client, "bucket", 1*memory.KiB, WorkloadOptions{
+		Weights:     map[string]int{"get": 50, "put": 20, "head": 10, "list": 10, "delete": 10},
+		Objects:     10,
+		Concurrency: 4,
+		Duration:    200 * time.Millisecond,
+		Seed:        1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	total := 0
+	for _, name := range []string{"Get", "Put", "Head", "List", "Delete"} {
+		samples := len(measurement.Result(name).Durations)
+		if samples == 0 {
+			t.Errorf("%s: expected samples", name)
+		}
+		total += samples
+	}
+	if total != measurement.Ops || measurement.Elapsed < 200*time.Millisecond || len(measurement.Failures) != 0 {
+		t.Fatalf("unexpected totals: %d samples, %d ops in %v, failures %v", total, measurement.Ops, measurement.Elapsed, measurement.Failures)
+	}
+
+	entries, err := s3client.ListAll(context.Background(), client, "bucket", s3client.ListOptions{Recursive: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("expected the objects to be deleted, got %d", len(entries))
+	}
+
+	_, err = WorkloadBenchmark(client, "bucket", 1*memory.KiB, WorkloadOptions{
+		Weights:  map[string]int{"get": 1},
+		Objects:  10,
+		Duration: time.Second,
+	})
+	if err == nil {
+		t.Fatal("expected an error without workers")
+	}
+}
+
+func TestWorkloadBenchmarkPopulateFailure(t *testing.T) {
+	client, cleanup := newTestClient(t, "bucket", s3client.NewMinio)
+	defer cleanup()
+
+	_, err := WorkloadBenchmark(&failingUploads{Client: client, remaining: 3}, "bucket", 1*memory.KiB, WorkloadOptions{
+		Weights:     map[string]int{"get": 1},
+		Objects:     10,
+		Concurrency: 1,
+		Duration:    time.Second,
+	})
+	if !errors.Is(err, errUploadFailed) {
+		t.Fatalf("expected the upload error, got %v", err)
+	}
+
+	entries, err := s3client.ListAll(context.Background(), client, "bucket", s3client.ListOptions{Recursive: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("expected the populated objects to be deleted, got %d", len(entries))
+	}
+}
+
+var errUploadFailed = errors.New("upload failed")
+
+// failingUploads fails the uploads after the remaining ones.
+type failingUploads struct {
+	s3client.Client
+	remaining int
+}
+
+// Upload uploads object data until the remaining uploads are used up.
+func (client *failingUploads) Upload(bucket, objectName string, data []byte) error {
+	if client.remaining == 0 {
+		return errUploadFailed
+	}
+	client.remaining--
+	return client.Client.Upload(bucket, objectName, data)
+}
@@ -3,14 +3,16 @@ module storj.io/benchmark
 go 1.14
 
 require (
-	github.com/go-ini/ini v1.62.0 // indirect
+	github.com/aws/aws-sdk-go v1.38.40
+	github.com/go-ini/ini v1.62.0
 	github.com/loov/hrtime v1.0.3
 	github.com/loov/plot v0.0.0-20210121121947-1165ff277fe2
 	github.com/minio/minio-go v6.0.14+incompatible
+	github.com/zeebo/blake3 v0.2.3
 	github.com/zeebo/errs v1.2.2
 	go.uber.org/zap v1.16.0
 	golang.org/x/sync v0.0.0-20210220032951-036812b2e83c
 	storj.io/common v0.0.0-20210504141454-bcb03a80052f
 	storj.io/storj v0.12.1-0.20210517133731-10372afbe423
-	storj.io/uplink v1.5.0-rc.1.0.20210517064255-08afeb09f8a4 // indirect
+	storj.io/uplink v1.5.0-rc.1.0.20210517064255-08afeb09f8a4
 )
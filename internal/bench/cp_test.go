@@ -6,6 +6,7 @@ package bench_test
 import (
 	"encoding/hex"
 	"errors"
+	"io/ioutil"
 	"log"
 	"os"
 	"sync"
@@ -64,6 +65,26 @@ func uplinkSetup(bucket string) s3client.Client {
 	return client
 }
 
+// fileSystemSetup setups a local filesystem client, which is the baseline for the other clients.
+func fileSystemSetup(bucket string) (s3client.Client, func()) {
+	root, err := ioutil.TempDir("", "benchmark")
+	if err != nil {
+		log.Fatalf("failed to create directory: %+v\n", err)
+	}
+
+	client, err := s3client.NewFileSystem(s3client.Config{
+		Options: map[string]string{"root": root},
+	})
+	if err != nil {
+		log.Fatalf("failed to create s3client NewFileSystem: %+v\n", err)
+	}
+	err = client.MakeBucket(bucket, "")
+	if err != nil {
+		log.Fatalf("failed to create bucket with s3client %q: %+v\n", bucket, err)
+	}
+	return client, func() { _ = os.RemoveAll(root) }
+}
+
 func getEnvOrDefault(key, fallback string) string {
 	if value, exists := os.LookupEnv(key); exists {
 		return value
@@ -84,6 +105,18 @@ func BenchmarkUpload_Uplink(b *testing.B) {
 	teardown(client, bucket, uploadedObjects)
 }
 
+func BenchmarkUpload_FileSystem(b *testing.B) {
+	bucket := "testbucket"
+	client, cleanup := fileSystemSetup(bucket)
+	defer cleanup()
+
+	var uploadedObjects = map[string][]string{}
+
+	uploadedObjects = benchmarkUpload(b, client, bucket, uploadedObjects)
+
+	teardown(client, bucket, uploadedObjects)
+}
+
 func teardown(client s3client.Client, bucket string, uploadedObjects map[string][]string) {
 	for _, bm := range benchmarkCases {
 		for _, objectPath := range uploadedObjects[bm.name] {
@@ -112,6 +145,18 @@ func BenchmarkDownload_Uplink(b *testing.B) {
 	teardownTestObjects(client, bucket)
 }
 
+func BenchmarkDownload_FileSystem(b *testing.B) {
+	bucket := "testbucket"
+	client, cleanup := fileSystemSetup(bucket)
+	defer cleanup()
+
+	uploadTestObjects(client, bucket)
+
+	benchmarkDownload(b, bucket, client)
+
+	teardownTestObjects(client, bucket)
+}
+
 func uploadTestObjects(client s3client.Client, bucket string) {
 	for name, data := range testObjects() {
 		objectName := "folder/data_" + name
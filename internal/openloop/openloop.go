@@ -0,0 +1,274 @@
+// Copyright (C) 2021 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+// Package openloop issues operations at a target rate independent of how
+// long the operations take.
+//
+// Closed loops, which start the next operation when the previous one has
+// finished, slow down together with the server and hide the time requests
+// would have spent queueing. An open loop keeps the schedule, so the
+// response time measured from the intended start includes that time.
+package openloop
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Schedule returns the target rate in operations per second after elapsed.
+type Schedule func(elapsed time.Duration) float64
+
+// Fixed returns a schedule with a constant rate.
+func Fixed(rate float64) Schedule {
+	return func(time.Duration) float64 { return rate }
+}
+
+// Ramp returns a schedule changing the rate linearly from start to end over duration.
+func Ramp(start, end float64, duration time.Duration) Schedule {
+	return func(elapsed time.Duration) float64 {
+		if elapsed >= duration {
+			return end
+		}
+		return start + (end-start)*float64(elapsed)/float64(duration)
+	}
+}
+
+// Steps returns a schedule using each of the rates for interval,
+// the last rate is kept afterwards.
+func Steps(rates []float64, interval time.Duration) Schedule {
+	return func(elapsed time.Duration) float64 {
+		step := int(elapsed / interval)
+		if step >= len(rates) {
+			step = len(rates) - 1
+		}
+		return rates[step]
+	}
+}
+
+// ParseSchedule parses a schedule for a run of duration:
+//
+//	100             100 operations per second
+//	ramp:10-100     10 to 100 operations per second over duration
+//	step:10,20,50   each rate for an equal part of duration
+//	step:10,20/30s  each rate for 30 seconds
+func ParseSchedule(s string, duration time.Duration) (Schedule, error) {
+	kind, spec := "fixed", s
+	if tokens := strings.SplitN(s, ":", 2); len(tokens) == 2 {
+		kind, spec = tokens[0], tokens[1]
+	}
+
+	switch kind {
+	case "fixed":
+		rate, err := parseRate(spec)
+		if err != nil {
+			return nil, err
+		}
+		return Fixed(rate), nil
+	case "ramp":
+		tokens := strings.SplitN(spec, "-", 2)
+		if len(tokens) != 2 {
+			return nil, fmt.Errorf("invalid ramp %q, expected start-end", spec)
+		}
+		start, err := parseRate(tokens[0])
+		if err != nil {
+			return nil, err
+		}
+		end, err := parseRate(tokens[1])
+		if err != nil {
+			return nil, err
+		}
+		return Ramp(start, end, duration), nil
+	case "step":
+		var interval time.Duration
+		if i := strings.LastIndex(spec, "/"); i >= 0 {
+			var err error
+			interval, err = time.ParseDuration(spec[i+1:])
+			if err != nil || interval <= 0 {
+				return nil, fmt.Errorf("invalid step interval %q", spec[i+1:])
+			}
+			spec = spec[:i]
+		}
+		var rates []float64
+		for _, token := range strings.Split(spec, ",") {
+			rate, err := parseRate(token)
+			if err != nil {
+				return nil, err
+			}
+			rates = append(rates, rate)
+		}
+		if interval == 0 {
+			interval = duration / time.Duration(len(rates))
+			if interval <= 0 {
+				return nil, errors.New("step schedule requires a duration or an interval")
+			}
+		}
+		return Steps(rates, interval), nil
+	}
+	return nil, fmt.Errorf("unknown schedule %q, expected a rate, ramp:start-end or step:rates", kind)
+}
+
+// parseRate parses a positive rate in operations per second.
+func parseRate(s string) (float64, error) {
+	rate, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || rate <= 0 {
+		return 0, fmt.Errorf("invalid rate %q, expected operations per second", s)
+	}
+	return rate, nil
+}
+
+// Options configures a run.
+type Options struct {
+	Schedule Schedule
+	// Duration is the time during which operations are started.
+	Duration time.Duration
+	// MaxInFlight limits the number of running operations, 0 is unlimited.
+	// Operations over the limit wait for a slot, which is included in their
+	// response time.
+	MaxInFlight int
+}
+
+// Sample is the timing of a single operation.
+type Sample struct {
+	// N is the sequence number of the operation.
+	N int
+	// Intended is when the operation was scheduled to start.
+	Intended time.Time
+	// Start and End are when the operation actually started and finished.
+	Start time.Time
+	End   time.Time
+	Err   error
+}
+
+// Service returns the time the operation took.
+func (sample Sample) Service() time.Duration { return sample.End.Sub(sample.Start) }
+
+// Response returns the time from the intended start until the operation
+// finished, which includes waiting behind earlier operations.
+func (sample Sample) Response() time.Duration { return sample.End.Sub(sample.Intended) }
+
+// Stats summarizes a run.
+type Stats struct {
+	// Started is the number of operations started and Completed the number
+	// of operations that finished before the run was stopped.
+	Started   int
+	Completed int
+	// MaxInFlight is the highest number of concurrently running operations.
+	MaxInFlight int
+	// MaxDelay is the longest time an operation started after it was
+	// scheduled, e.g. waiting for a slot.
+	MaxDelay time.Duration
+	// Elapsed is the time from the first scheduled operation until the
+	// last operation finished.
+	Elapsed time.Duration
+}
+
+// Run starts op at the times given by the schedule until the duration
+// has passed and waits for the started operations to finish.
+//
+// record is called with the sample of every finished operation, one call
+// at a time. When record returns an error, no further operations are
+// started and Run returns that error.
+func Run(ctx context.Context, opts Options, op func(ctx context.Context, n int) error, record func(Sample) error) (Stats, error) {
+	var stats Stats
+	if opts.Schedule == nil {
+		return stats, errors.New("missing schedule")
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var slots chan struct{}
+	if opts.MaxInFlight > 0 {
+		slots = make(chan struct{}, opts.MaxInFlight)
+	}
+
+	var mu sync.Mutex
+	var failure error
+	inFlight := 0
+
+	finish := func(sample Sample) {
+		mu.Lock()
+		defer mu.Unlock()
+		inFlight--
+		stats.Completed++
+		if delay := sample.Start.Sub(sample.Intended); delay > stats.MaxDelay {
+			stats.MaxDelay = delay
+		}
+		if failure != nil {
+			return
+		}
+		if err := record(sample); err != nil {
+			failure = err
+			cancel()
+		}
+	}
+
+	var wg sync.WaitGroup
+	var err error
+	start := time.Now()
+	intended := start
+	timer := time.NewTimer(time.Hour)
+	timer.Stop()
+
+schedule:
+	for n := 0; intended.Sub(start) < opts.Duration; n++ {
+		rate := opts.Schedule(intended.Sub(start))
+		if rate <= 0 {
+			err = fmt.Errorf("invalid rate %v after %v", rate, intended.Sub(start))
+			break schedule
+		}
+
+		if wait := time.Until(intended); wait > 0 {
+			timer.Reset(wait)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				break schedule
+			}
+		}
+		if slots != nil {
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				break schedule
+			}
+		}
+
+		mu.Lock()
+		inFlight++
+		if inFlight > stats.MaxInFlight {
+			stats.MaxInFlight = inFlight
+		}
+		stats.Started++
+		mu.Unlock()
+
+		wg.Add(1)
+		go func(sample Sample) {
+			defer wg.Done()
+			sample.Start = time.Now()
+			sample.Err = op(ctx, sample.N)
+			sample.End = time.Now()
+			if slots != nil {
+				<-slots
+			}
+			finish(sample)
+		}(Sample{N: n, Intended: intended})
+
+		intended = intended.Add(time.Duration(float64(time.Second) / rate))
+	}
+	wg.Wait()
+
+	stats.Elapsed = time.Since(start)
+	if failure != nil {
+		return stats, failure
+	}
+	if err == nil {
+		err = ctx.Err()
+	}
+	return stats, err
+}
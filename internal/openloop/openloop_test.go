@@ -0,0 +1,125 @@
+// Copyright (C) 2021 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package openloop_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"storj.io/benchmark/internal/openloop"
+)
+
+func TestParseSchedule(t *testing.T) {
+	for _, test := range []struct {
+		schedule string
+		elapsed  []time.Duration
+		rates    []float64
+	}{
+		{"100", []time.Duration{0, time.Minute}, []float64{100, 100}},
+		{"ramp:10-110", []time.Duration{0, 5 * time.Second, 10 * time.Second, time.Minute}, []float64{10, 60, 110, 110}},
+		{"step:10,20", []time.Duration{0, 4 * time.Second, 5 * time.Second, time.Minute}, []float64{10, 10, 20, 20}},
+		{"step:1,2,3/2s", []time.Duration{0, 2 * time.Second, 4 * time.Second, 10 * time.Second}, []float64{1, 2, 3, 3}},
+	} {
+		schedule, err := openloop.ParseSchedule(test.schedule, 10*time.Second)
+		if err != nil {
+			t.Fatalf("%q: %v", test.schedule, err)
+		}
+		for i, elapsed := range test.elapsed {
+			if rate := schedule(elapsed); rate != test.rates[i] {
+				t.Errorf("%q after %v: expected %v, got %v", test.schedule, elapsed, test.rates[i], rate)
+			}
+		}
+	}
+
+	for _, invalid := range []string{"", "0", "-5", "ramp:10", "step:1,x", "step:1/0s", "poisson:10"} {
+		if _, err := openloop.ParseSchedule(invalid, time.Second); err == nil {
+			t.Errorf("%q: expected an error", invalid)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	var samples []openloop.Sample
+	stats, err := openloop.Run(context.Background(), openloop.Options{
+		Schedule: openloop.Fixed(200),
+		Duration: 250 * time.Millisecond,
+	}, func(ctx context.Context, n int) error {
+		time.Sleep(time.Millisecond)
+		return nil
+	}, func(sample openloop.Sample) error {
+		samples = append(samples, sample)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stats.Started != 50 || stats.Completed != 50 || len(samples) != 50 {
+		t.Fatalf("expected 50 operations, got %+v with %d samples", stats, len(samples))
+	}
+	for _, sample := range samples {
+		expected := samples[0].Intended.Add(time.Duration(sample.N) * 5 * time.Millisecond)
+		if d := sample.Intended.Sub(expected); d < -time.Millisecond || d > time.Millisecond {
+			t.Errorf("operation %d: scheduled %v off", sample.N, d)
+		}
+		if sample.Response() < sample.Service() {
+			t.Errorf("operation %d: response %v shorter than service %v", sample.N, sample.Response(), sample.Service())
+		}
+	}
+}
+
+func TestRunQueueing(t *testing.T) {
+	// the operations take three times as long as the interval
+	var maxService, maxResponse time.Duration
+	stats, err := openloop.Run(context.Background(), openloop.Options{
+		Schedule:    openloop.Fixed(100),
+		Duration:    100 * time.Millisecond,
+		MaxInFlight: 1,
+	}, func(ctx context.Context, n int) error {
+		time.Sleep(30 * time.Millisecond)
+		return nil
+	}, func(sample openloop.Sample) error {
+		if sample.Service() > maxService {
+			maxService = sample.Service()
+		}
+		if sample.Response() > maxResponse {
+			maxResponse = sample.Response()
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stats.Started != 10 || stats.MaxInFlight != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+	// the last operation waits for the nine before it
+	if maxResponse < 9*30*time.Millisecond-90*time.Millisecond || maxService > maxResponse/2 {
+		t.Fatalf("expected queueing in the response time, got service %v and response %v", maxService, maxResponse)
+	}
+}
+
+func TestRunRecordError(t *testing.T) {
+	failed := errors.New("failed")
+	stats, err := openloop.Run(context.Background(), openloop.Options{
+		Schedule: openloop.Fixed(1000),
+		Duration: time.Minute,
+	}, func(ctx context.Context, n int) error {
+		return nil
+	}, func(sample openloop.Sample) error {
+		if sample.N == 5 {
+			return failed
+		}
+		return nil
+	})
+	if !errors.Is(err, failed) {
+		t.Fatalf("expected the record error, got %v", err)
+	}
+	if stats.Elapsed > 10*time.Second || stats.Started != stats.Completed {
+		t.Fatalf("expected the run to stop, got %+v", stats)
+	}
+}
@@ -5,12 +5,16 @@ package s3client
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
 	"os/exec"
-	"strings"
+	"strconv"
+	"time"
 
 	"github.com/zeebo/errs"
 )
@@ -20,43 +24,95 @@ var AWSCLIError = errs.Class("aws-cli error")
 
 // AWSCLI implements basic S3 Client with aws-cli.
 type AWSCLI struct {
-	conf Config
+	conf   Config
+	binary string
+	env    []string
+	// configFile sets the addressing style, which aws-cli only reads from a config file.
+	configFile string
 }
 
+func init() { Register("aws-cli", NewAWSCLI) }
+
 // NewAWSCLI creates new Client.
+//
+// The "binary" option sets the path of the aws executable.
 func NewAWSCLI(conf Config) (Client, error) {
-	if !strings.HasPrefix(conf.S3Gateway, "https://") &&
-		!strings.HasPrefix(conf.S3Gateway, "http://") {
-		conf.S3Gateway = "http://" + conf.S3Gateway
+	opts := ParseOptions(conf.Options)
+	binary := opts.String("binary", "aws")
+	if err := opts.Err(); err != nil {
+		return nil, AWSCLIError.Wrap(err)
+	}
+	if err := conf.checkAddressing(); err != nil {
+		return nil, AWSCLIError.Wrap(err)
+	}
+	if conf.TLS.CertFile != "" || conf.TLS.KeyFile != "" {
+		return nil, AWSCLIError.New("client certificates are not supported")
+	}
+
+	conf.S3Gateway = conf.Endpoint()
+	client := &AWSCLI{
+		conf:   conf,
+		binary: binary,
+		env: []string{
+			"AWS_ACCESS_KEY_ID=" + conf.AccessKey,
+			"AWS_SECRET_ACCESS_KEY=" + conf.SecretKey,
+		},
+	}
+	if conf.Region != "" {
+		client.env = append(client.env, "AWS_DEFAULT_REGION="+conf.Region)
+	}
+
+	if conf.Addressing != AddressingAuto {
+		file, err := ioutil.TempFile("", "aws-cli-config")
+		if err != nil {
+			return nil, AWSCLIError.Wrap(err)
+		}
+		_, err = fmt.Fprintf(file, "[default]\ns3 =\n    addressing_style = %s\n", conf.Addressing)
+		err = errs.Combine(err, file.Close())
+		if err != nil {
+			return nil, AWSCLIError.Wrap(errs.Combine(err, os.Remove(file.Name())))
+		}
+
+		client.configFile = file.Name()
+		client.env = append(client.env, "AWS_CONFIG_FILE="+file.Name(), "AWS_PROFILE=default")
+	}
+
+	return client, nil
+}
+
+// Close removes the generated config file.
+func (client *AWSCLI) Close() error {
+	if client.configFile == "" {
+		return nil
 	}
-	return &AWSCLI{conf}, nil
+	return AWSCLIError.Wrap(os.Remove(client.configFile))
 }
 
-func (client *AWSCLI) cmd(subargs ...string) *exec.Cmd {
+func (client *AWSCLI) cmd(ctx context.Context, subargs ...string) *exec.Cmd {
 	args := []string{
 		"--endpoint", client.conf.S3Gateway,
 	}
 
-	if client.conf.NoSSL {
+	if client.conf.TLS.InsecureSkipVerify {
 		args = append(args, "--no-verify-ssl")
 	}
+	if client.conf.TLS.CAFile != "" {
+		args = append(args, "--ca-bundle", client.conf.TLS.CAFile)
+	}
 	args = append(args, subargs...)
 
 	/* #nosec G204 */ // Go exec.Command doesn't allow to execute more than one
 	// command it passes the arguments to the command properly escaped which are
 	// only interpreted by the OS as the arguments of the indicated program (.i.e
 	// aws).
-	cmd := exec.Command("aws", args...)
-	cmd.Env = append(os.Environ(),
-		"AWS_ACCESS_KEY_ID="+client.conf.AccessKey,
-		"AWS_SECRET_ACCESS_KEY="+client.conf.SecretKey,
-	)
+	cmd := exec.CommandContext(ctx, client.binary, args...)
+	cmd.Env = append(os.Environ(), client.env...)
 	return cmd
 }
 
 // MakeBucket makes a new bucket.
 func (client *AWSCLI) MakeBucket(bucket, location string) error {
-	cmd := client.cmd("s3", "mb", "s3://"+bucket, "--region", location)
+	cmd := client.cmd(context.Background(), "s3", "mb", "s3://"+bucket, "--region", location)
 	out, err := cmd.Output()
 	if err != nil {
 		return AWSCLIError.Wrap(fullExitError(err, string(out)))
@@ -66,7 +122,7 @@ func (client *AWSCLI) MakeBucket(bucket, location string) error {
 
 // RemoveBucket removes a bucket.
 func (client *AWSCLI) RemoveBucket(bucket string) error {
-	cmd := client.cmd("s3", "rb", "s3://"+bucket)
+	cmd := client.cmd(context.Background(), "s3", "rb", "s3://"+bucket)
 	out, err := cmd.Output()
 	if err != nil {
 		return AWSCLIError.Wrap(fullExitError(err, string(out)))
@@ -76,7 +132,7 @@ func (client *AWSCLI) RemoveBucket(bucket string) error {
 
 // ListBuckets lists all buckets.
 func (client *AWSCLI) ListBuckets() ([]string, error) {
-	cmd := client.cmd("s3api", "list-buckets", "--output", "json")
+	cmd := client.cmd(context.Background(), "s3api", "list-buckets", "--output", "json")
 	jsondata, err := cmd.Output()
 	if err != nil {
 		return nil, AWSCLIError.Wrap(fullExitError(err, string(jsondata)))
@@ -103,9 +159,26 @@ func (client *AWSCLI) ListBuckets() ([]string, error) {
 
 // Upload uploads object data to the specified path.
 func (client *AWSCLI) Upload(bucket, objectName string, data []byte) error {
-	// TODO: add upload threshold
-	cmd := client.cmd("s3", "cp", "-", "s3://"+bucket+"/"+objectName)
-	cmd.Stdin = bytes.NewReader(data)
+	return putBytes(client, bucket, objectName, data)
+}
+
+// Put uploads object data from the reader to the specified path.
+func (client *AWSCLI) Put(ctx context.Context, bucket, objectName string, data io.Reader, size int64, opts PutOptions) error {
+	args := []string{"s3", "cp", "-", "s3://" + bucket + "/" + objectName,
+		"--content-type", opts.contentType()}
+	if size > 0 {
+		args = append(args, "--expected-size", strconv.FormatInt(size, 10))
+	}
+	if len(opts.Metadata) > 0 {
+		metadata, err := json.Marshal(opts.Metadata)
+		if err != nil {
+			return AWSCLIError.Wrap(err)
+		}
+		args = append(args, "--metadata", string(metadata))
+	}
+
+	cmd := client.cmd(ctx, args...)
+	cmd.Stdin = data
 	out, err := cmd.Output()
 	if err != nil {
 		return AWSCLIError.Wrap(fullExitError(err, string(out)))
@@ -113,11 +186,113 @@ func (client *AWSCLI) Upload(bucket, objectName string, data []byte) error {
 	return nil
 }
 
-// UploadMultipart uses multipart uploads, has hardcoded threshold.
-func (client *AWSCLI) UploadMultipart(bucket, objectName string, data []byte, threshold int) error {
-	// TODO: add upload threshold
-	cmd := client.cmd("s3", "cp", "-", "s3://"+bucket+"/"+objectName)
-	cmd.Stdin = bytes.NewReader(data)
+// InitiateMultipart starts a new multipart upload.
+func (client *AWSCLI) InitiateMultipart(ctx context.Context, bucket, objectName string) (string, error) {
+	cmd := client.cmd(ctx, "s3api", "create-multipart-upload",
+		"--output", "json",
+		"--bucket", bucket,
+		"--key", objectName)
+	jsondata, err := cmd.Output()
+	if err != nil {
+		return "", AWSCLIError.Wrap(fullExitError(err, string(jsondata)))
+	}
+
+	var response struct {
+		UploadID string `json:"UploadId"`
+	}
+	err = json.Unmarshal(jsondata, &response)
+	if err != nil {
+		return "", AWSCLIError.Wrap(err)
+	}
+
+	return response.UploadID, nil
+}
+
+// UploadPart uploads a single part of a multipart upload.
+//
+// aws-cli requires a file for the part body, hence the data is first written
+// to a temporary file.
+func (client *AWSCLI) UploadPart(ctx context.Context, bucket, objectName, uploadID string, partNumber int, data io.Reader, size int64) (_ Part, err error) {
+	file, err := ioutil.TempFile("", "aws-cli-part")
+	if err != nil {
+		return Part{}, AWSCLIError.Wrap(err)
+	}
+	defer func() {
+		err = errs.Combine(err, AWSCLIError.Wrap(os.Remove(file.Name())))
+	}()
+
+	written, err := io.Copy(file, data)
+	err = errs.Combine(err, file.Close())
+	if err != nil {
+		return Part{}, AWSCLIError.Wrap(err)
+	}
+
+	cmd := client.cmd(ctx, "s3api", "upload-part",
+		"--output", "json",
+		"--bucket", bucket,
+		"--key", objectName,
+		"--upload-id", uploadID,
+		"--part-number", strconv.Itoa(partNumber),
+		"--body", file.Name())
+	jsondata, err := cmd.Output()
+	if err != nil {
+		return Part{}, AWSCLIError.Wrap(fullExitError(err, string(jsondata)))
+	}
+
+	var response struct {
+		ETag string `json:"ETag"`
+	}
+	err = json.Unmarshal(jsondata, &response)
+	if err != nil {
+		return Part{}, AWSCLIError.Wrap(err)
+	}
+
+	return Part{
+		Number: partNumber,
+		ETag:   response.ETag,
+		Size:   written,
+	}, nil
+}
+
+// CompleteMultipart finishes a multipart upload.
+func (client *AWSCLI) CompleteMultipart(ctx context.Context, bucket, objectName, uploadID string, parts []Part) error {
+	type completedPart struct {
+		ETag       string `json:"ETag"`
+		PartNumber int    `json:"PartNumber"`
+	}
+	var upload struct {
+		Parts []completedPart `json:"Parts"`
+	}
+	for _, part := range parts {
+		upload.Parts = append(upload.Parts, completedPart{
+			ETag:       part.ETag,
+			PartNumber: part.Number,
+		})
+	}
+
+	jsonupload, err := json.Marshal(upload)
+	if err != nil {
+		return AWSCLIError.Wrap(err)
+	}
+
+	cmd := client.cmd(ctx, "s3api", "complete-multipart-upload",
+		"--bucket", bucket,
+		"--key", objectName,
+		"--upload-id", uploadID,
+		"--multipart-upload", string(jsonupload))
+	out, err := cmd.Output()
+	if err != nil {
+		return AWSCLIError.Wrap(fullExitError(err, string(out)))
+	}
+	return nil
+}
+
+// AbortMultipart aborts a multipart upload.
+func (client *AWSCLI) AbortMultipart(ctx context.Context, bucket, objectName, uploadID string) error {
+	cmd := client.cmd(ctx, "s3api", "abort-multipart-upload",
+		"--bucket", bucket,
+		"--key", objectName,
+		"--upload-id", uploadID)
 	out, err := cmd.Output()
 	if err != nil {
 		return AWSCLIError.Wrap(fullExitError(err, string(out)))
@@ -127,32 +302,218 @@ func (client *AWSCLI) UploadMultipart(bucket, objectName string, data []byte, th
 
 // Download downloads object data.
 func (client *AWSCLI) Download(bucket, objectName string, buffer []byte) ([]byte, error) {
-	cmd := client.cmd("s3", "cp", "s3://"+bucket+"/"+objectName, "-")
+	return getBytes(client, bucket, objectName, buffer)
+}
+
+// Get returns a reader for the object data.
+func (client *AWSCLI) Get(ctx context.Context, bucket, objectName string) (io.ReadCloser, ObjectInfo, error) {
+	cmd := client.cmd(ctx, "s3", "cp", "s3://"+bucket+"/"+objectName, "-")
+	reader, err := startProcessReader(cmd, &AWSCLIError)
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+	return reader, ObjectInfo{Key: objectName, Size: -1}, nil
+}
+
+// DownloadRange downloads length bytes of object data starting at offset.
+func (client *AWSCLI) DownloadRange(bucket, objectName string, offset, length int64, buffer []byte) ([]byte, error) {
+	return getRangeBytes(client, bucket, objectName, offset, length, buffer)
+}
+
+// GetRange returns a reader for length bytes of object data starting at offset.
+//
+// aws-cli can only write ranged reads into a file, hence the data is first
+// downloaded to a temporary file.
+func (client *AWSCLI) GetRange(ctx context.Context, bucket, objectName string, offset, length int64) (_ io.ReadCloser, _ ObjectInfo, err error) {
+	file, err := ioutil.TempFile("", "aws-cli-range")
+	if err != nil {
+		return nil, ObjectInfo{}, AWSCLIError.Wrap(err)
+	}
+	path := file.Name()
+	if err := file.Close(); err != nil {
+		return nil, ObjectInfo{}, AWSCLIError.Wrap(errs.Combine(err, os.Remove(path)))
+	}
+	defer func() {
+		if err != nil {
+			err = errs.Combine(err, AWSCLIError.Wrap(os.Remove(path)))
+		}
+	}()
+
+	cmd := client.cmd(ctx, "s3api", "get-object",
+		"--output", "json",
+		"--bucket", bucket,
+		"--key", objectName,
+		"--range", httpRange(offset, length),
+		path)
+	jsondata, err := cmd.Output()
+	if err != nil {
+		return nil, ObjectInfo{}, AWSCLIError.Wrap(fullExitError(err, string(jsondata)))
+	}
 
-	buf := &bufferWriter{buffer[:0]}
-	cmd.Stdout = buf
-	cmd.Stderr = os.Stderr
+	var response struct {
+		ContentLength int64 `json:"ContentLength"`
+	}
+	err = json.Unmarshal(jsondata, &response)
+	if err != nil {
+		return nil, ObjectInfo{}, AWSCLIError.Wrap(err)
+	}
 
-	err := cmd.Run()
+	file, err = os.Open(path)
 	if err != nil {
-		return nil, AWSCLIError.Wrap(fullExitError(err, string(buf.data)))
+		return nil, ObjectInfo{}, AWSCLIError.Wrap(err)
 	}
 
-	return buf.data, nil
+	return &tempFileReader{file, &AWSCLIError}, ObjectInfo{
+		Key:  objectName,
+		Size: response.ContentLength,
+	}, nil
 }
 
-type bufferWriter struct {
-	data []byte
+// tempFileReader reads a file and removes it on close.
+type tempFileReader struct {
+	*os.File
+	class *errs.Class
 }
 
-func (b *bufferWriter) Write(data []byte) (n int, err error) {
-	b.data = append(b.data, data...)
-	return len(data), nil
+// Close closes and removes the file.
+func (reader *tempFileReader) Close() error {
+	return reader.class.Wrap(errs.Combine(reader.File.Close(), os.Remove(reader.File.Name())))
+}
+
+// Stat returns information about the object.
+func (client *AWSCLI) Stat(ctx context.Context, bucket, objectName string) (ObjectInfo, error) {
+	cmd := client.cmd(ctx, "s3api", "head-object",
+		"--output", "json",
+		"--bucket", bucket,
+		"--key", objectName)
+	jsondata, err := cmd.Output()
+	if err != nil {
+		return ObjectInfo{}, AWSCLIError.Wrap(fullExitError(err, string(jsondata)))
+	}
+
+	var response struct {
+		ContentLength int64             `json:"ContentLength"`
+		ETag          string            `json:"ETag"`
+		ContentType   string            `json:"ContentType"`
+		LastModified  string            `json:"LastModified"`
+		Metadata      map[string]string `json:"Metadata"`
+	}
+	err = json.Unmarshal(jsondata, &response)
+	if err != nil {
+		return ObjectInfo{}, AWSCLIError.Wrap(err)
+	}
+
+	lastModified, err := parseAWSCLITime(response.LastModified)
+	if err != nil {
+		return ObjectInfo{}, AWSCLIError.Wrap(err)
+	}
+
+	return ObjectInfo{
+		Key:          objectName,
+		Size:         response.ContentLength,
+		ETag:         response.ETag,
+		ContentType:  response.ContentType,
+		LastModified: lastModified,
+		Metadata:     response.Metadata,
+	}, nil
+}
+
+// parseAWSCLITime parses timestamps in the formats used by different aws-cli versions.
+func parseAWSCLITime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC1123, value)
+}
+
+// processReader streams the standard output of a running process.
+type processReader struct {
+	cmd    *exec.Cmd
+	stdout io.ReadCloser
+	stderr bytes.Buffer
+	class  *errs.Class
+
+	exited bool
+	err    error
+}
+
+// startProcessReader starts cmd and returns a reader for its output.
+func startProcessReader(cmd *exec.Cmd, class *errs.Class) (*processReader, error) {
+	reader := &processReader{cmd: cmd, class: class}
+	cmd.Stderr = &reader.stderr
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, class.Wrap(err)
+	}
+	reader.stdout = stdout
+
+	if err := cmd.Start(); err != nil {
+		return nil, class.Wrap(err)
+	}
+	return reader, nil
+}
+
+// Read reads the output of the process, failing when the process exits with an error.
+func (reader *processReader) Read(p []byte) (int, error) {
+	if reader.exited {
+		if reader.err != nil {
+			return 0, reader.err
+		}
+		return 0, io.EOF
+	}
+
+	n, err := reader.stdout.Read(p)
+	if errors.Is(err, io.EOF) {
+		reader.wait()
+		if reader.err != nil {
+			return n, reader.err
+		}
+		return n, io.EOF
+	}
+	return n, reader.class.Wrap(err)
+}
+
+// wait waits for the process to exit.
+func (reader *processReader) wait() {
+	if reader.exited {
+		return
+	}
+	reader.exited = true
+
+	err := reader.cmd.Wait()
+	if err != nil {
+		reader.err = reader.class.Wrap(fullExitError(err, reader.stderr.String()))
+	}
+}
+
+// Close stops the process when the output hasn't been fully read.
+func (reader *processReader) Close() error {
+	if !reader.exited {
+		// the process would otherwise block on writing to stdout.
+		_ = reader.cmd.Process.Kill()
+		reader.wait()
+		return nil
+	}
+	return reader.err
 }
 
 // Delete deletes object.
 func (client *AWSCLI) Delete(bucket, objectName string) error {
-	cmd := client.cmd("s3", "rm", "s3://"+bucket+"/"+objectName)
+	cmd := client.cmd(context.Background(), "s3", "rm", "s3://"+bucket+"/"+objectName)
+	out, err := cmd.Output()
+	if err != nil {
+		return AWSCLIError.Wrap(fullExitError(err, string(out)))
+	}
+	return nil
+}
+
+// Copy copies an object on the server.
+func (client *AWSCLI) Copy(ctx context.Context, srcBucket, srcKey, dstBucket, dstKey string) error {
+	cmd := client.cmd(ctx, "s3", "cp", "s3://"+srcBucket+"/"+srcKey, "s3://"+dstBucket+"/"+dstKey)
 	out, err := cmd.Output()
 	if err != nil {
 		return AWSCLIError.Wrap(fullExitError(err, string(out)))
@@ -160,52 +521,84 @@ func (client *AWSCLI) Delete(bucket, objectName string) error {
 	return nil
 }
 
-// ListObjects lists objects.
-func (client *AWSCLI) ListObjects(bucket, prefix string) ([]string, error) {
-	cmd := client.cmd("s3api", "list-objects",
+// ListObjects lists a single page of objects and prefixes.
+//
+// aws-cli fetches all pages when MaxKeys is not set.
+func (client *AWSCLI) ListObjects(ctx context.Context, bucket string, opts ListOptions) (ListPage, error) {
+	args := []string{"s3api", "list-objects-v2",
 		"--output", "json",
 		"--bucket", bucket,
-		"--prefix", prefix,
-		"--delimiter", "/")
+		"--prefix", opts.Prefix,
+	}
+	if !opts.Recursive {
+		args = append(args, "--delimiter", "/")
+	}
+	if opts.MaxKeys > 0 {
+		args = append(args, "--max-items", strconv.Itoa(opts.MaxKeys))
+	}
+	if opts.ContinuationToken != "" {
+		args = append(args, "--starting-token", opts.ContinuationToken)
+	}
 
+	cmd := client.cmd(ctx, args...)
 	jsondata, err := cmd.Output()
 	if err != nil {
-		return nil, AWSCLIError.Wrap(fullExitError(err, string(jsondata)))
+		return ListPage{}, AWSCLIError.Wrap(fullExitError(err, string(jsondata)))
 	}
 
 	var response struct {
 		Contents []struct {
-			Key string `json:"Key"`
+			Key          string `json:"Key"`
+			Size         int64  `json:"Size"`
+			LastModified string `json:"LastModified"`
 		} `json:"Contents"`
 		CommonPrefixes []struct {
 			Key string `json:"Prefix"`
 		} `json:"CommonPrefixes"`
+		NextToken string `json:"NextToken"`
 	}
 
-	err = json.Unmarshal(jsondata, &response)
-	if err != nil {
-		return nil, AWSCLIError.Wrap(fullExitError(err, ""))
+	// an empty listing produces no output
+	if len(bytes.TrimSpace(jsondata)) > 0 {
+		err = json.Unmarshal(jsondata, &response)
+		if err != nil {
+			return ListPage{}, AWSCLIError.Wrap(fullExitError(err, ""))
+		}
 	}
 
-	names := []string{}
+	page := ListPage{NextContinuationToken: response.NextToken}
 	for _, object := range response.Contents {
-		names = append(names, object.Key)
+		lastModified, err := parseAWSCLITime(object.LastModified)
+		if err != nil {
+			return ListPage{}, AWSCLIError.Wrap(err)
+		}
+		page.Entries = append(page.Entries, ListEntry{
+			Key:          object.Key,
+			Size:         object.Size,
+			LastModified: lastModified,
+		})
 	}
 	for _, object := range response.CommonPrefixes {
-		names = append(names, object.Key)
+		page.Entries = append(page.Entries, ListEntry{
+			Key:      object.Key,
+			IsPrefix: true,
+		})
 	}
 
-	return names, nil
+	return page, nil
 }
 
 // fullExitError returns error string with the Stderr output.
+//
+// The error is marked with the kind of error found in the output, see ErrorKind.
 func fullExitError(err error, msg string) error {
 	if err == nil {
 		return nil
 	}
 	var exitErr *exec.ExitError
 	if errors.As(err, &exitErr) {
-		return fmt.Errorf("%w\n%v\n%s", exitErr, string(exitErr.Stderr), msg)
+		stderr := string(exitErr.Stderr)
+		return withKind(fmt.Errorf("%w\n%v\n%s", exitErr, stderr, msg), outputKind(stderr+"\n"+msg))
 	}
 	return err
 }
@@ -0,0 +1,404 @@
+// Copyright (C) 2021 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package s3client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/zeebo/errs"
+)
+
+// AWSSDKError is class for aws-sdk errors.
+var AWSSDKError = errs.Class("aws-sdk error")
+
+// AWSSDK implements basic S3 Client with AWS SDK for Go.
+type AWSSDK struct {
+	api        *s3.S3
+	uploader   *s3manager.Uploader
+	downloader *s3manager.Downloader
+}
+
+func init() { Register("aws-sdk", NewAWSSDK) }
+
+// NewAWSSDK creates new Client.
+//
+// The "region" option sets the signing region, which defaults to conf.Region
+// or "us-east-1", and "concurrency" the number of parts transferred
+// concurrently by Upload and Download. Buckets are addressed by path unless
+// conf.Addressing is AddressingVirtual.
+func NewAWSSDK(conf Config) (Client, error) {
+	if err := conf.checkAddressing(); err != nil {
+		return nil, awsSDKError(err)
+	}
+	defaultRegion := conf.Region
+	if defaultRegion == "" {
+		defaultRegion = "us-east-1"
+	}
+
+	opts := ParseOptions(conf.Options)
+	region := opts.String("region", defaultRegion)
+	concurrency := opts.Int("concurrency", s3manager.DefaultUploadConcurrency)
+	if err := opts.Err(); err != nil {
+		return nil, awsSDKError(err)
+	}
+
+	config := &aws.Config{
+		Credentials:      credentials.NewStaticCredentials(conf.AccessKey, conf.SecretKey, ""),
+		Endpoint:         aws.String(conf.Endpoint()),
+		Region:           aws.String(region),
+		DisableSSL:       aws.Bool(!conf.Secure()),
+		S3ForcePathStyle: aws.Bool(conf.Addressing != AddressingVirtual),
+	}
+	transport, err := conf.HTTPTransport(http.DefaultTransport.(*http.Transport))
+	if err != nil {
+		return nil, awsSDKError(err)
+	}
+	if transport != nil {
+		config.HTTPClient = &http.Client{Transport: transport}
+	}
+
+	sess, err := session.NewSession(config)
+	if err != nil {
+		return nil, awsSDKError(err)
+	}
+
+	api := s3.New(sess)
+	uploader := s3manager.NewUploaderWithClient(api)
+	uploader.Concurrency = concurrency
+	downloader := s3manager.NewDownloaderWithClient(api)
+	downloader.Concurrency = concurrency
+
+	return &AWSSDK{
+		api:        api,
+		uploader:   uploader,
+		downloader: downloader,
+	}, nil
+}
+
+// MakeBucket makes a new bucket.
+func (client *AWSSDK) MakeBucket(bucket, location string) error {
+	input := &s3.CreateBucketInput{Bucket: aws.String(bucket)}
+	if location != "" {
+		input.CreateBucketConfiguration = &s3.CreateBucketConfiguration{
+			LocationConstraint: aws.String(location),
+		}
+	}
+
+	_, err := client.api.CreateBucketWithContext(context.Background(), input)
+	if err != nil {
+		return awsSDKError(err)
+	}
+	return nil
+}
+
+// RemoveBucket removes a bucket.
+func (client *AWSSDK) RemoveBucket(bucket string) error {
+	_, err := client.api.DeleteBucketWithContext(context.Background(), &s3.DeleteBucketInput{
+		Bucket: aws.String(bucket),
+	})
+	if err != nil {
+		return awsSDKError(err)
+	}
+	return nil
+}
+
+// ListBuckets lists all buckets.
+func (client *AWSSDK) ListBuckets() ([]string, error) {
+	response, err := client.api.ListBucketsWithContext(context.Background(), &s3.ListBucketsInput{})
+	if err != nil {
+		return nil, awsSDKError(err)
+	}
+
+	names := []string{}
+	for _, bucket := range response.Buckets {
+		names = append(names, aws.StringValue(bucket.Name))
+	}
+	return names, nil
+}
+
+// Upload uploads object data to the specified path.
+func (client *AWSSDK) Upload(bucket, objectName string, data []byte) error {
+	return putBytes(client, bucket, objectName, data)
+}
+
+// Put uploads object data from the reader to the specified path using the upload manager.
+func (client *AWSSDK) Put(ctx context.Context, bucket, objectName string, data io.Reader, size int64, opts PutOptions) error {
+	_, err := client.uploader.UploadWithContext(ctx, &s3manager.UploadInput{
+		Bucket:      aws.String(bucket),
+		Key:         aws.String(objectName),
+		Body:        data,
+		ContentType: aws.String(opts.contentType()),
+		Metadata:    aws.StringMap(opts.Metadata),
+	})
+	if err != nil {
+		return awsSDKError(err)
+	}
+	return nil
+}
+
+// InitiateMultipart starts a new multipart upload.
+func (client *AWSSDK) InitiateMultipart(ctx context.Context, bucket, objectName string) (string, error) {
+	response, err := client.api.CreateMultipartUploadWithContext(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:      aws.String(bucket),
+		Key:         aws.String(objectName),
+		ContentType: aws.String(DefaultContentType),
+	})
+	if err != nil {
+		return "", awsSDKError(err)
+	}
+	return aws.StringValue(response.UploadId), nil
+}
+
+// UploadPart uploads a single part of a multipart upload.
+//
+// The SDK requires a seekable body, hence other readers are buffered in memory.
+func (client *AWSSDK) UploadPart(ctx context.Context, bucket, objectName, uploadID string, partNumber int, data io.Reader, size int64) (Part, error) {
+	body, ok := data.(io.ReadSeeker)
+	if !ok {
+		buffer, err := ioutil.ReadAll(data)
+		if err != nil {
+			return Part{}, awsSDKError(err)
+		}
+		body = bytes.NewReader(buffer)
+	}
+
+	response, err := client.api.UploadPartWithContext(ctx, &s3.UploadPartInput{
+		Bucket:        aws.String(bucket),
+		Key:           aws.String(objectName),
+		UploadId:      aws.String(uploadID),
+		PartNumber:    aws.Int64(int64(partNumber)),
+		Body:          body,
+		ContentLength: aws.Int64(size),
+	})
+	if err != nil {
+		return Part{}, awsSDKError(err)
+	}
+
+	return Part{
+		Number: partNumber,
+		ETag:   aws.StringValue(response.ETag),
+		Size:   size,
+	}, nil
+}
+
+// CompleteMultipart finishes a multipart upload.
+func (client *AWSSDK) CompleteMultipart(ctx context.Context, bucket, objectName, uploadID string, parts []Part) error {
+	completed := make([]*s3.CompletedPart, 0, len(parts))
+	for _, part := range parts {
+		completed = append(completed, &s3.CompletedPart{
+			ETag:       aws.String(part.ETag),
+			PartNumber: aws.Int64(int64(part.Number)),
+		})
+	}
+
+	_, err := client.api.CompleteMultipartUploadWithContext(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(bucket),
+		Key:             aws.String(objectName),
+		UploadId:        aws.String(uploadID),
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: completed},
+	})
+	if err != nil {
+		return awsSDKError(err)
+	}
+	return nil
+}
+
+// AbortMultipart aborts a multipart upload.
+func (client *AWSSDK) AbortMultipart(ctx context.Context, bucket, objectName, uploadID string) error {
+	_, err := client.api.AbortMultipartUploadWithContext(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(bucket),
+		Key:      aws.String(objectName),
+		UploadId: aws.String(uploadID),
+	})
+	if err != nil {
+		return awsSDKError(err)
+	}
+	return nil
+}
+
+// Download downloads object data using the download manager.
+func (client *AWSSDK) Download(bucket, objectName string, buffer []byte) ([]byte, error) {
+	target := aws.NewWriteAtBuffer(buffer[:0])
+	_, err := client.downloader.DownloadWithContext(context.Background(), target, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(objectName),
+	})
+	if err != nil {
+		return nil, awsSDKError(err)
+	}
+	return target.Bytes(), nil
+}
+
+// DownloadRange downloads length bytes of object data starting at offset.
+func (client *AWSSDK) DownloadRange(bucket, objectName string, offset, length int64, buffer []byte) ([]byte, error) {
+	return getRangeBytes(client, bucket, objectName, offset, length, buffer)
+}
+
+// Get returns a reader for the object data.
+//
+// The download manager requires an io.WriterAt, hence this uses a single request.
+func (client *AWSSDK) Get(ctx context.Context, bucket, objectName string) (io.ReadCloser, ObjectInfo, error) {
+	return client.get(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(objectName),
+	})
+}
+
+// GetRange returns a reader for length bytes of object data starting at offset.
+func (client *AWSSDK) GetRange(ctx context.Context, bucket, objectName string, offset, length int64) (io.ReadCloser, ObjectInfo, error) {
+	return client.get(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(objectName),
+		Range:  aws.String(httpRange(offset, length)),
+	})
+}
+
+func (client *AWSSDK) get(ctx context.Context, input *s3.GetObjectInput) (io.ReadCloser, ObjectInfo, error) {
+	response, err := client.api.GetObjectWithContext(ctx, input)
+	if err != nil {
+		return nil, ObjectInfo{}, awsSDKError(err)
+	}
+
+	size := int64(-1)
+	if response.ContentLength != nil {
+		size = *response.ContentLength
+	}
+
+	return &classReader{response.Body, &AWSSDKError}, ObjectInfo{
+		Key:          aws.StringValue(input.Key),
+		Size:         size,
+		ETag:         aws.StringValue(response.ETag),
+		ContentType:  aws.StringValue(response.ContentType),
+		LastModified: aws.TimeValue(response.LastModified),
+		Metadata:     awsMetadata(response.Metadata),
+	}, nil
+}
+
+// Stat returns information about the object.
+func (client *AWSSDK) Stat(ctx context.Context, bucket, objectName string) (ObjectInfo, error) {
+	response, err := client.api.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(objectName),
+	})
+	if err != nil {
+		return ObjectInfo{}, awsSDKError(err)
+	}
+
+	return ObjectInfo{
+		Key:          objectName,
+		Size:         aws.Int64Value(response.ContentLength),
+		ETag:         aws.StringValue(response.ETag),
+		ContentType:  aws.StringValue(response.ContentType),
+		LastModified: aws.TimeValue(response.LastModified),
+		Metadata:     awsMetadata(response.Metadata),
+	}, nil
+}
+
+// Delete deletes object.
+func (client *AWSSDK) Delete(bucket, objectName string) error {
+	_, err := client.api.DeleteObjectWithContext(context.Background(), &s3.DeleteObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(objectName),
+	})
+	if err != nil {
+		return awsSDKError(err)
+	}
+	return nil
+}
+
+// Copy copies an object on the server.
+func (client *AWSSDK) Copy(ctx context.Context, srcBucket, srcKey, dstBucket, dstKey string) error {
+	source := &url.URL{Path: srcBucket + "/" + srcKey}
+	_, err := client.api.CopyObjectWithContext(ctx, &s3.CopyObjectInput{
+		Bucket:     aws.String(dstBucket),
+		Key:        aws.String(dstKey),
+		CopySource: aws.String(source.EscapedPath()),
+	})
+	if err != nil {
+		return awsSDKError(err)
+	}
+	return nil
+}
+
+// ListObjects lists a single page of objects and prefixes.
+func (client *AWSSDK) ListObjects(ctx context.Context, bucket string, opts ListOptions) (ListPage, error) {
+	input := &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(opts.Prefix),
+	}
+	if !opts.Recursive {
+		input.Delimiter = aws.String("/")
+	}
+	if opts.MaxKeys > 0 {
+		input.MaxKeys = aws.Int64(int64(opts.MaxKeys))
+	}
+	if opts.ContinuationToken != "" {
+		input.ContinuationToken = aws.String(opts.ContinuationToken)
+	}
+
+	output, err := client.api.ListObjectsV2WithContext(ctx, input)
+	if err != nil {
+		return ListPage{}, awsSDKError(err)
+	}
+
+	page := ListPage{}
+	for _, object := range output.Contents {
+		page.Entries = append(page.Entries, ListEntry{
+			Key:          aws.StringValue(object.Key),
+			Size:         aws.Int64Value(object.Size),
+			LastModified: aws.TimeValue(object.LastModified),
+		})
+	}
+	for _, prefix := range output.CommonPrefixes {
+		page.Entries = append(page.Entries, ListEntry{
+			Key:      aws.StringValue(prefix.Prefix),
+			IsPrefix: true,
+		})
+	}
+	if aws.BoolValue(output.IsTruncated) {
+		page.NextContinuationToken = aws.StringValue(output.NextContinuationToken)
+	}
+
+	return page, nil
+}
+
+// awsMetadata converts user metadata returned by the SDK, which uses canonical
+// header keys, into lower case keys.
+func awsMetadata(metadata map[string]*string) map[string]string {
+	converted := map[string]string{}
+	for key, value := range metadata {
+		converted[strings.ToLower(key)] = aws.StringValue(value)
+	}
+	return converted
+}
+
+// awsSDKError wraps err into AWSSDKError and marks its kind.
+func awsSDKError(err error) error {
+	var kind error
+	var failure awserr.RequestFailure
+	var awsErr awserr.Error
+	switch {
+	case errors.As(err, &failure):
+		kind = s3Kind(failure.Code(), failure.StatusCode())
+	case errors.As(err, &awsErr):
+		kind = s3Kind(awsErr.Code(), 0)
+	}
+	if kind == nil {
+		kind = netKind(err)
+	}
+	return AWSSDKError.Wrap(withKind(err, kind))
+}
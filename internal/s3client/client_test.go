@@ -0,0 +1,274 @@
+// Copyright (C) 2021 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package s3client_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+
+	"storj.io/benchmark/internal/s3client"
+	"storj.io/benchmark/internal/s3fake"
+)
+
+// newTestClient creates a client with newClient for a fake gateway. The
+// bucket is created unless it's empty.
+func newTestClient(t *testing.T, bucket string, newClient func(s3client.Config) (s3client.Client, error)) (s3client.Client, func()) {
+	server := s3fake.NewServer()
+
+	client, err := newClient(s3client.Config{
+		S3Gateway: server.Addr(),
+		AccessKey: "access",
+		SecretKey: "secret",
+		NoSSL:     true,
+	})
+	if err != nil {
+		server.Close()
+		t.Fatal(err)
+	}
+
+	if bucket != "" {
+		if err := client.MakeBucket(bucket, ""); err != nil {
+			server.Close()
+			t.Fatal(err)
+		}
+	}
+
+	return client, server.Close
+}
+
+func TestMinio(t *testing.T) {
+	client, cleanup := newTestClient(t, "", s3client.NewMinio)
+	defer cleanup()
+
+	testClient(t, client)
+}
+
+func TestAWSSDK(t *testing.T) {
+	client, cleanup := newTestClient(t, "", s3client.NewAWSSDK)
+	defer cleanup()
+
+	testClient(t, client)
+}
+
+func TestFileSystem(t *testing.T) {
+	root, err := ioutil.TempDir("", "s3client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(root) }()
+
+	client, err := s3client.NewFileSystem(s3client.Config{
+		Options: map[string]string{"root": root, "fsync": "true"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testClient(t, client)
+}
+
+func testClient(t *testing.T, client s3client.Client) {
+	ctx := context.Background()
+	const bucket = "bucket"
+
+	if err := client.MakeBucket(bucket, ""); err != nil {
+		t.Fatal(err)
+	}
+	buckets, err := client.ListBuckets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(buckets) != 1 || buckets[0] != bucket {
+		t.Fatalf("unexpected buckets %v", buckets)
+	}
+
+	data := []byte("0123456789")
+
+	t.Run("UploadDownload", func(t *testing.T) {
+		if err := client.Upload(bucket, "object", data); err != nil {
+			t.Fatal(err)
+		}
+
+		downloaded, err := client.Download(bucket, "object", make([]byte, 0, len(data)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(downloaded, data) {
+			t.Fatalf("downloaded %q, expected %q", downloaded, data)
+		}
+
+		ranged, err := client.DownloadRange(bucket, "object", 3, 4, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(ranged) != "3456" {
+			t.Fatalf("downloaded range %q", ranged)
+		}
+
+		if err := client.Delete(bucket, "object"); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("PutGetStat", func(t *testing.T) {
+		err := client.Put(ctx, bucket, "meta", bytes.NewReader(data), int64(len(data)), s3client.PutOptions{
+			ContentType: "text/plain",
+			Metadata:    map[string]string{"name": "value"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = client.Delete(bucket, "meta") }()
+
+		info, err := client.Stat(ctx, bucket, "meta")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size != int64(len(data)) || info.ContentType != "text/plain" || info.Metadata["name"] != "value" || info.ETag == "" {
+			t.Fatalf("unexpected info %+v", info)
+		}
+
+		reader, info, err := client.GetRange(ctx, bucket, "meta", 8, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ranged, err := ioutil.ReadAll(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := reader.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if string(ranged) != "89" {
+			t.Fatalf("read range %q, info %+v", ranged, info)
+		}
+	})
+
+	t.Run("Copy", func(t *testing.T) {
+		if err := client.Upload(bucket, "source", data); err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = client.Delete(bucket, "source") }()
+
+		if err := client.Copy(ctx, bucket, "source", bucket, "copy"); err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = client.Delete(bucket, "copy") }()
+
+		copied, err := client.Download(bucket, "copy", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(copied, data) {
+			t.Fatalf("copied %q, expected %q", copied, data)
+		}
+	})
+
+	t.Run("List", func(t *testing.T) {
+		keys := []string{"a", "b/1", "b/2", "b/c/1", "d"}
+		for _, key := range keys {
+			if err := client.Upload(bucket, key, data); err != nil {
+				t.Fatal(err)
+			}
+		}
+		defer func() {
+			for _, key := range keys {
+				_ = client.Delete(bucket, key)
+			}
+		}()
+
+		for _, test := range []struct {
+			opts     s3client.ListOptions
+			expected string
+		}{
+			{s3client.ListOptions{}, "a b/ d"},
+			{s3client.ListOptions{MaxKeys: 1}, "a b/ d"},
+			{s3client.ListOptions{Prefix: "b/"}, "b/1 b/2 b/c/"},
+			{s3client.ListOptions{Prefix: "b/", Recursive: true, MaxKeys: 2}, "b/1 b/2 b/c/1"},
+			{s3client.ListOptions{Recursive: true}, "a b/1 b/2 b/c/1 d"},
+		} {
+			entries, err := s3client.ListAll(ctx, client, bucket, test.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var listed []string
+			for _, entry := range entries {
+				if entry.IsPrefix != strings.HasSuffix(entry.Key, "/") {
+					t.Errorf("%+v: wrong IsPrefix for %q", test.opts, entry.Key)
+				}
+				if !entry.IsPrefix && entry.Size != int64(len(data)) {
+					t.Errorf("%+v: wrong size for %q: %d", test.opts, entry.Key, entry.Size)
+				}
+				listed = append(listed, entry.Key)
+			}
+			sort.Strings(listed)
+
+			if got := strings.Join(listed, " "); got != test.expected {
+				t.Errorf("%+v: listed %q, expected %q", test.opts, got, test.expected)
+			}
+		}
+	})
+
+	t.Run("Multipart", func(t *testing.T) {
+		uploader, ok := client.(s3client.MultipartUploader)
+		if !ok {
+			t.Skip("multipart uploads not supported")
+		}
+
+		err := s3client.UploadMultipart(ctx, uploader, bucket, "multipart", bytes.NewReader(data), int64(len(data)), s3client.MultipartOptions{
+			PartSize:    3,
+			Concurrency: 2,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = client.Delete(bucket, "multipart") }()
+
+		uploaded, err := client.Download(bucket, "multipart", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(uploaded, data) {
+			t.Fatalf("uploaded %q, expected %q", uploaded, data)
+		}
+	})
+
+	t.Run("Missing", func(t *testing.T) {
+		_, err := client.Stat(ctx, bucket, "missing")
+		if !errors.Is(err, s3client.ErrObjectNotFound) {
+			t.Fatalf("expected object not found, got %v", err)
+		}
+
+		_, err = client.Download(bucket, "missing", nil)
+		if !errors.Is(err, s3client.ErrObjectNotFound) {
+			t.Fatalf("expected object not found, got %v", err)
+		}
+
+		_, err = client.Stat(ctx, "missing-bucket", "object")
+		if err == nil {
+			t.Fatal("expected an error")
+		}
+
+		err = client.Upload("missing-bucket", "object", data)
+		if !errors.Is(err, s3client.ErrBucketNotFound) {
+			t.Fatalf("expected bucket not found, got %v", err)
+		}
+
+		err = client.MakeBucket(bucket, "")
+		if !errors.Is(err, s3client.ErrBucketExists) {
+			t.Fatalf("expected bucket exists, got %v", err)
+		}
+	})
+
+	if err := client.RemoveBucket(bucket); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,639 @@
+// Copyright (C) 2021 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package s3client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/zeebo/errs"
+)
+
+// CommandError is class for command errors.
+var CommandError = errs.Class("command error")
+
+// CommandConfig describes how to run a command line tool for each operation.
+//
+// Operations without a template return ErrUnsupported. Download and Upload
+// use the "get" and "put" templates. Stat uses "list" when "stat" is missing.
+type CommandConfig struct {
+	// Binary is the executable to run.
+	Binary string `json:"binary"`
+	// Env are additional KEY=VALUE environment variables, the values are templates.
+	Env []string `json:"env"`
+
+	MakeBucket   *CommandTemplate `json:"mb"`
+	RemoveBucket *CommandTemplate `json:"rb"`
+	ListBuckets  *CommandTemplate `json:"buckets"`
+	Put          *CommandTemplate `json:"put"`
+	Get          *CommandTemplate `json:"get"`
+	GetRange     *CommandTemplate `json:"get_range"`
+	Stat         *CommandTemplate `json:"stat"`
+	Delete       *CommandTemplate `json:"delete"`
+	List         *CommandTemplate `json:"list"`
+	Copy         *CommandTemplate `json:"copy"`
+	Move         *CommandTemplate `json:"move"`
+}
+
+// CommandTemplate describes a single invocation of the tool.
+//
+// The arguments are text/template templates executed with CommandData,
+// arguments that expand to an empty string are dropped.
+type CommandTemplate struct {
+	Args []string `json:"args"`
+	// Data is "stdin" or "stdout" when object data is passed through the
+	// standard input or output and "file" when it's passed through a
+	// temporary file named by {{.File}}. Defaults to the standard streams.
+	Data string `json:"data"`
+
+	// Pattern parses the output lines of "buckets", "list" and "stat".
+	// The named groups "name", "key", "prefix", "size", "modified" and
+	// "etag" are used, lines that don't match are ignored.
+	Pattern string `json:"pattern"`
+	// TimeFormat is the layout of the "modified" group, defaults to RFC3339.
+	TimeFormat string `json:"time_format"`
+	// RelativeKeys is set when non-recursive listings print keys relative
+	// to the listed directory, such as "aws s3 ls".
+	RelativeKeys bool `json:"relative_keys"`
+}
+
+// CommandData is the data available to the templates.
+type CommandData struct {
+	// Gateway is the configured S3 gateway and Endpoint the gateway
+	// with an URL scheme.
+	Gateway   string
+	Endpoint  string
+	AccessKey string
+	SecretKey string
+	Access    string
+	ConfigDir string
+	// Region, Addressing and TLS are the endpoint configuration,
+	// e.g. {{if .TLS.CAFile}}--ca-bundle={{.TLS.CAFile}}{{end}}.
+	Region     string
+	Addressing string
+	TLS        TLSConfig
+
+	Bucket string
+	Key    string
+	// DstBucket and DstKey are the destination of copy and move.
+	DstBucket string
+	DstKey    string
+
+	// Prefix and Recursive are the list options. Directory is the prefix
+	// up to and including the last slash.
+	Prefix    string
+	Directory string
+	Recursive bool
+
+	// Offset and Length are the requested range, End is the last byte of it.
+	Offset int64
+	Length int64
+	End    int64
+
+	// Size is the size of the uploaded data or -1 when it is not known.
+	Size        int64
+	ContentType string
+	Metadata    map[string]string
+
+	// File is the temporary file for passing the data.
+	File string
+}
+
+// Command implements Client by running a command line tool according to CommandConfig.
+type Command struct {
+	conf   Config
+	binary string
+	env    []string
+
+	commands map[string]*commandSpec
+}
+
+// commandSpec is a parsed CommandTemplate.
+type commandSpec struct {
+	name     string
+	template *CommandTemplate
+	args     []*template.Template
+	pattern  *regexp.Regexp
+}
+
+func init() { Register("command", NewCommand) }
+
+// NewCommand creates new Client.
+//
+// The "config" option is the path of a JSON encoded CommandConfig.
+func NewCommand(conf Config) (Client, error) {
+	opts := ParseOptions(conf.Options)
+	path := opts.String("config", "")
+	if err := opts.Err(); err != nil {
+		return nil, CommandError.Wrap(err)
+	}
+	if path == "" {
+		return nil, CommandError.New("%s", "config option is required")
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, CommandError.Wrap(err)
+	}
+
+	var config CommandConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, CommandError.New("invalid config %q: %v", path, err)
+	}
+
+	return NewCommandWithConfig(conf, config)
+}
+
+// NewCommandWithConfig creates new Client from the command configuration.
+func NewCommandWithConfig(conf Config, config CommandConfig) (Client, error) {
+	if config.Binary == "" {
+		return nil, CommandError.New("%s", "binary is required")
+	}
+
+	client := &Command{
+		conf:     conf,
+		binary:   config.Binary,
+		commands: map[string]*commandSpec{},
+	}
+
+	for name, command := range map[string]*CommandTemplate{
+		"mb":        config.MakeBucket,
+		"rb":        config.RemoveBucket,
+		"buckets":   config.ListBuckets,
+		"put":       config.Put,
+		"get":       config.Get,
+		"get_range": config.GetRange,
+		"stat":      config.Stat,
+		"delete":    config.Delete,
+		"list":      config.List,
+		"copy":      config.Copy,
+		"move":      config.Move,
+	} {
+		if command == nil {
+			continue
+		}
+		spec, err := parseCommandTemplate(name, command)
+		if err != nil {
+			return nil, CommandError.Wrap(err)
+		}
+		client.commands[name] = spec
+	}
+
+	base := client.data()
+	for _, env := range config.Env {
+		value, err := expandTemplate("env", env, base)
+		if err != nil {
+			return nil, CommandError.Wrap(err)
+		}
+		client.env = append(client.env, value)
+	}
+
+	return client, nil
+}
+
+func parseCommandTemplate(name string, command *CommandTemplate) (*commandSpec, error) {
+	spec := &commandSpec{name: name, template: command}
+
+	switch command.Data {
+	case "", "stdin", "stdout", "file":
+	default:
+		return nil, fmt.Errorf("%s: invalid data %q", name, command.Data)
+	}
+
+	for _, arg := range command.Args {
+		tmpl, err := template.New(name).Option("missingkey=error").Parse(arg)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		spec.args = append(spec.args, tmpl)
+	}
+
+	if command.Pattern != "" {
+		pattern, err := regexp.Compile(command.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		spec.pattern = pattern
+	}
+
+	return spec, nil
+}
+
+func expandTemplate(name, text string, data CommandData) (string, error) {
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var out strings.Builder
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+// data returns the template data of the configuration.
+func (client *Command) data() CommandData {
+	return CommandData{
+		Gateway:    client.conf.S3Gateway,
+		Endpoint:   client.conf.Endpoint(),
+		AccessKey:  client.conf.AccessKey,
+		SecretKey:  client.conf.SecretKey,
+		Access:     client.conf.Access,
+		ConfigDir:  client.conf.ConfigDir,
+		Region:     client.conf.Region,
+		Addressing: client.conf.Addressing,
+		TLS:        client.conf.TLS,
+		Size:       -1,
+	}
+}
+
+// cmd returns the command for the named operation.
+func (client *Command) cmd(ctx context.Context, name string, data CommandData) (*exec.Cmd, *commandSpec, error) {
+	spec, ok := client.commands[name]
+	if !ok {
+		return nil, nil, CommandError.Wrap(fmt.Errorf("%s: %w", name, ErrUnsupported))
+	}
+
+	args := make([]string, 0, len(spec.args))
+	for _, tmpl := range spec.args {
+		var arg strings.Builder
+		if err := tmpl.Execute(&arg, data); err != nil {
+			return nil, nil, CommandError.Wrap(err)
+		}
+		if arg.Len() > 0 {
+			args = append(args, arg.String())
+		}
+	}
+
+	/* #nosec G204 */ // the command and its arguments come from the configuration
+	cmd := exec.CommandContext(ctx, client.binary, args...)
+	cmd.Env = append(os.Environ(), client.env...)
+	return cmd, spec, nil
+}
+
+// run runs the named operation and returns its output.
+func (client *Command) run(ctx context.Context, name string, data CommandData) ([]byte, *commandSpec, error) {
+	cmd, spec, err := client.cmd(ctx, name, data)
+	if err != nil {
+		return nil, nil, err
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, nil, CommandError.Wrap(fullExitError(err, string(out)))
+	}
+	return out, spec, nil
+}
+
+// tempFile creates an empty temporary file.
+func tempFile() (string, error) {
+	file, err := ioutil.TempFile("", "command-data")
+	if err != nil {
+		return "", CommandError.Wrap(err)
+	}
+	path := file.Name()
+	if err := file.Close(); err != nil {
+		return "", CommandError.Wrap(errs.Combine(err, os.Remove(path)))
+	}
+	return path, nil
+}
+
+// MakeBucket makes a new bucket.
+func (client *Command) MakeBucket(bucket, location string) error {
+	data := client.data()
+	data.Bucket = bucket
+	_, _, err := client.run(context.Background(), "mb", data)
+	return err
+}
+
+// RemoveBucket removes a bucket.
+func (client *Command) RemoveBucket(bucket string) error {
+	data := client.data()
+	data.Bucket = bucket
+	_, _, err := client.run(context.Background(), "rb", data)
+	return err
+}
+
+// ListBuckets lists all buckets using the "name" group of the pattern.
+func (client *Command) ListBuckets() ([]string, error) {
+	out, spec, err := client.run(context.Background(), "buckets", client.data())
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	err = spec.parse(out, func(fields map[string]string) error {
+		if fields["name"] != "" {
+			names = append(names, fields["name"])
+		}
+		return nil
+	})
+	return names, CommandError.Wrap(err)
+}
+
+// Upload uploads object data to the specified path.
+func (client *Command) Upload(bucket, objectName string, data []byte) error {
+	return putBytes(client, bucket, objectName, data)
+}
+
+// Put uploads object data from the reader to the specified path.
+func (client *Command) Put(ctx context.Context, bucket, objectName string, data io.Reader, size int64, opts PutOptions) (err error) {
+	tdata := client.data()
+	tdata.Bucket, tdata.Key = bucket, objectName
+	tdata.Size = size
+	tdata.ContentType = opts.contentType()
+	tdata.Metadata = opts.Metadata
+
+	spec, ok := client.commands["put"]
+	if ok && spec.template.Data == "file" {
+		tdata.File, err = tempFile()
+		if err != nil {
+			return err
+		}
+		defer func() { err = errs.Combine(err, CommandError.Wrap(os.Remove(tdata.File))) }()
+
+		if err := writeFile(tdata.File, data); err != nil {
+			return CommandError.Wrap(err)
+		}
+		data = nil
+	}
+
+	cmd, _, err := client.cmd(ctx, "put", tdata)
+	if err != nil {
+		return err
+	}
+	if data != nil {
+		cmd.Stdin = data
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		return CommandError.Wrap(fullExitError(err, string(out)))
+	}
+	return nil
+}
+
+// writeFile writes data to the file at path.
+func writeFile(path string, data io.Reader) (err error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer func() { err = errs.Combine(err, file.Close()) }()
+
+	_, err = io.Copy(file, data)
+	return err
+}
+
+// Download downloads object data.
+func (client *Command) Download(bucket, objectName string, buffer []byte) ([]byte, error) {
+	return getBytes(client, bucket, objectName, buffer)
+}
+
+// DownloadRange downloads length bytes of object data starting at offset.
+func (client *Command) DownloadRange(bucket, objectName string, offset, length int64, buffer []byte) ([]byte, error) {
+	return getRangeBytes(client, bucket, objectName, offset, length, buffer)
+}
+
+// Get returns a reader for the object data.
+func (client *Command) Get(ctx context.Context, bucket, objectName string) (io.ReadCloser, ObjectInfo, error) {
+	data := client.data()
+	data.Bucket, data.Key = bucket, objectName
+	return client.get(ctx, "get", data)
+}
+
+// GetRange returns a reader for length bytes of object data starting at offset.
+func (client *Command) GetRange(ctx context.Context, bucket, objectName string, offset, length int64) (io.ReadCloser, ObjectInfo, error) {
+	data := client.data()
+	data.Bucket, data.Key = bucket, objectName
+	data.Offset, data.Length, data.End = offset, length, offset+length-1
+	return client.get(ctx, "get_range", data)
+}
+
+func (client *Command) get(ctx context.Context, name string, data CommandData) (_ io.ReadCloser, _ ObjectInfo, err error) {
+	spec, ok := client.commands[name]
+	if !ok || spec.template.Data != "file" {
+		cmd, _, err := client.cmd(ctx, name, data)
+		if err != nil {
+			return nil, ObjectInfo{}, err
+		}
+		reader, err := startProcessReader(cmd, &CommandError)
+		if err != nil {
+			return nil, ObjectInfo{}, err
+		}
+		return reader, ObjectInfo{Key: data.Key, Size: -1}, nil
+	}
+
+	data.File, err = tempFile()
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+	defer func() {
+		if err != nil {
+			err = errs.Combine(err, CommandError.Wrap(os.Remove(data.File)))
+		}
+	}()
+
+	if _, _, err := client.run(ctx, name, data); err != nil {
+		return nil, ObjectInfo{}, err
+	}
+
+	file, err := os.Open(data.File)
+	if err != nil {
+		return nil, ObjectInfo{}, CommandError.Wrap(err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return nil, ObjectInfo{}, CommandError.Wrap(errs.Combine(err, file.Close()))
+	}
+	return &tempFileReader{file, &CommandError}, ObjectInfo{Key: data.Key, Size: info.Size()}, nil
+}
+
+// Stat returns information about the object.
+//
+// When "stat" isn't configured, the object is looked up by listing.
+func (client *Command) Stat(ctx context.Context, bucket, objectName string) (ObjectInfo, error) {
+	if _, ok := client.commands["stat"]; !ok {
+		return client.statByListing(ctx, bucket, objectName)
+	}
+
+	data := client.data()
+	data.Bucket, data.Key = bucket, objectName
+	out, spec, err := client.run(ctx, "stat", data)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+
+	var info *ObjectInfo
+	err = spec.parse(out, func(fields map[string]string) error {
+		if info != nil {
+			return nil
+		}
+		entry, err := spec.entry(fields)
+		if err != nil {
+			return err
+		}
+		info = &ObjectInfo{
+			Key:          objectName,
+			Size:         entry.Size,
+			ETag:         fields["etag"],
+			LastModified: entry.LastModified,
+		}
+		return nil
+	})
+	if err != nil {
+		return ObjectInfo{}, CommandError.Wrap(err)
+	}
+	if info == nil {
+		return ObjectInfo{}, CommandError.Wrap(fmt.Errorf("%q: %w", objectName, ErrObjectNotFound))
+	}
+	return *info, nil
+}
+
+func (client *Command) statByListing(ctx context.Context, bucket, objectName string) (ObjectInfo, error) {
+	page, err := client.ListObjects(ctx, bucket, ListOptions{Prefix: objectName})
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	for _, entry := range page.Entries {
+		if !entry.IsPrefix && entry.Key == objectName {
+			return ObjectInfo{
+				Key:          objectName,
+				Size:         entry.Size,
+				LastModified: entry.LastModified,
+			}, nil
+		}
+	}
+	return ObjectInfo{}, CommandError.Wrap(fmt.Errorf("%q: %w", objectName, ErrObjectNotFound))
+}
+
+// Copy copies an object.
+func (client *Command) Copy(ctx context.Context, srcBucket, srcKey, dstBucket, dstKey string) error {
+	data := client.data()
+	data.Bucket, data.Key = srcBucket, srcKey
+	data.DstBucket, data.DstKey = dstBucket, dstKey
+	_, _, err := client.run(ctx, "copy", data)
+	return err
+}
+
+// Move moves an object.
+func (client *Command) Move(ctx context.Context, srcBucket, srcKey, dstBucket, dstKey string) error {
+	data := client.data()
+	data.Bucket, data.Key = srcBucket, srcKey
+	data.DstBucket, data.DstKey = dstBucket, dstKey
+	_, _, err := client.run(ctx, "move", data)
+	return err
+}
+
+// Delete deletes object.
+func (client *Command) Delete(bucket, objectName string) error {
+	data := client.data()
+	data.Bucket, data.Key = bucket, objectName
+	_, _, err := client.run(context.Background(), "delete", data)
+	return err
+}
+
+// ListObjects lists objects and prefixes.
+//
+// The tool is expected to list the directory of the prefix, the entries
+// are filtered by the prefix. All entries are returned in a single page.
+func (client *Command) ListObjects(ctx context.Context, bucket string, opts ListOptions) (ListPage, error) {
+	data := client.data()
+	data.Bucket = bucket
+	data.Prefix = opts.Prefix
+	data.Directory = opts.Prefix[:strings.LastIndex(opts.Prefix, "/")+1]
+	data.Recursive = opts.Recursive
+
+	out, spec, err := client.run(ctx, "list", data)
+	if err != nil {
+		return ListPage{}, err
+	}
+
+	page := ListPage{}
+	err = spec.parse(out, func(fields map[string]string) error {
+		entry, err := spec.entry(fields)
+		if err != nil {
+			return err
+		}
+		if entry.Key == "" {
+			return nil
+		}
+		if spec.template.RelativeKeys && !opts.Recursive {
+			entry.Key = data.Directory + entry.Key
+		}
+		if strings.HasPrefix(entry.Key, opts.Prefix) {
+			page.Entries = append(page.Entries, entry)
+		}
+		return nil
+	})
+	if err != nil {
+		return ListPage{}, CommandError.Wrap(err)
+	}
+	return page, nil
+}
+
+// parse calls fn with the named groups of each output line matching the pattern.
+func (spec *commandSpec) parse(out []byte, fn func(fields map[string]string) error) error {
+	if spec.pattern == nil {
+		return fmt.Errorf("%s: pattern is required", spec.name)
+	}
+
+	for _, line := range strings.Split(string(out), "\n") {
+		line = strings.TrimRight(line, "\r")
+		match := spec.pattern.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+
+		fields := map[string]string{}
+		for i, name := range spec.pattern.SubexpNames() {
+			if name != "" && match[i] != "" {
+				fields[name] = match[i]
+			}
+		}
+		if err := fn(fields); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// entry converts the named groups of a listing line to a ListEntry.
+func (spec *commandSpec) entry(fields map[string]string) (ListEntry, error) {
+	if prefix := fields["prefix"]; prefix != "" {
+		if !strings.HasSuffix(prefix, "/") {
+			prefix += "/"
+		}
+		return ListEntry{Key: prefix, IsPrefix: true}, nil
+	}
+
+	entry := ListEntry{Key: fields["key"]}
+	if size := fields["size"]; size != "" {
+		var err error
+		entry.Size, err = strconv.ParseInt(size, 10, 64)
+		if err != nil {
+			return ListEntry{}, fmt.Errorf("%s: invalid size %q: %w", spec.name, size, err)
+		}
+	}
+	if modified := fields["modified"]; modified != "" {
+		layout := spec.template.TimeFormat
+		if layout == "" {
+			layout = time.RFC3339
+		}
+		var err error
+		entry.LastModified, err = time.Parse(layout, modified)
+		if err != nil {
+			return ListEntry{}, fmt.Errorf("%s: %w", spec.name, err)
+		}
+	}
+	return entry, nil
+}
@@ -0,0 +1,126 @@
+// Copyright (C) 2021 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package s3client_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+
+	"storj.io/benchmark/internal/s3client"
+)
+
+func TestCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires a shell")
+	}
+
+	root, err := ioutil.TempDir("", "fakecli")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(root) }()
+
+	client, err := s3client.New("command", s3client.Config{
+		S3Gateway: root,
+		Options:   map[string]string{"config": "testdata/fakecli.json"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	data := []byte("0123456789")
+
+	if err := client.MakeBucket("bucket", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.MakeBucket("bucket", ""); !errors.Is(err, s3client.ErrBucketExists) {
+		t.Fatalf("expected bucket exists, got %v", err)
+	}
+	buckets, err := client.ListBuckets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(buckets) != 1 || buckets[0] != "bucket" {
+		t.Fatalf("unexpected buckets %v", buckets)
+	}
+
+	for _, key := range []string{"a", "b/1", "b/2", "b/c/1"} {
+		if err := client.Upload("bucket", key, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	downloaded, err := client.Download("bucket", "b/1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(downloaded, data) {
+		t.Fatalf("downloaded %q", downloaded)
+	}
+	ranged, err := client.DownloadRange("bucket", "b/1", 3, 4, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(ranged) != "3456" {
+		t.Fatalf("downloaded range %q", ranged)
+	}
+	if _, err := client.Download("bucket", "missing", nil); !errors.Is(err, s3client.ErrObjectNotFound) {
+		t.Fatalf("expected object not found, got %v", err)
+	}
+
+	for _, test := range []struct {
+		opts     s3client.ListOptions
+		expected string
+	}{
+		{s3client.ListOptions{}, "a b/"},
+		{s3client.ListOptions{Prefix: "b/"}, "b/1 b/2 b/c/"},
+		{s3client.ListOptions{Prefix: "b/c"}, "b/c/"},
+		{s3client.ListOptions{Prefix: "b/", Recursive: true}, "b/1 b/2 b/c/1"},
+	} {
+		entries, err := s3client.ListAll(ctx, client, "bucket", test.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var listed []string
+		for _, entry := range entries {
+			listed = append(listed, entry.Key)
+		}
+		sort.Strings(listed)
+		if got := strings.Join(listed, " "); got != test.expected {
+			t.Errorf("%+v: listed %q, expected %q", test.opts, got, test.expected)
+		}
+	}
+
+	info, err := client.Stat(ctx, "bucket", "b/2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size != int64(len(data)) {
+		t.Fatalf("unexpected info %+v", info)
+	}
+	if _, err := client.Stat(ctx, "bucket", "b/3"); !errors.Is(err, s3client.ErrObjectNotFound) {
+		t.Fatalf("expected object not found, got %v", err)
+	}
+
+	if err := client.Copy(ctx, "bucket", "a", "bucket", "copy"); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.(s3client.Mover).Move(ctx, "bucket", "copy", "bucket", "moved"); !errors.Is(err, s3client.ErrUnsupported) {
+		t.Fatalf("expected unsupported, got %v", err)
+	}
+
+	for _, key := range []string{"a", "b/1", "b/2", "b/c/1", "copy"} {
+		if err := client.Delete("bucket", key); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
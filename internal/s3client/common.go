@@ -3,14 +3,41 @@
 
 package s3client
 
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/zeebo/errs"
+)
+
 // Config is the setup for a particular .
 type Config struct {
+	// S3Gateway is the gateway address, optionally with a scheme.
 	S3Gateway string
 	AccessKey string
 	SecretKey string
 	Access    string
+	// NoSSL uses plain HTTP for a gateway address without a scheme.
 	NoSSL     bool
 	ConfigDir string
+
+	// Region is the signing region, empty uses the backend default.
+	Region string
+	// Addressing is the bucket addressing style, see AddressingPath.
+	Addressing string
+	// TLS configures the HTTPS connections to the gateway.
+	TLS TLSConfig
+	// Transport tunes the HTTP connections to the gateway.
+	Transport TransportConfig
+
+	// Options are client specific options, see ParseOptions.
+	Options map[string]string
 }
 
 // Client is the common interface for different implementations.
@@ -21,6 +48,215 @@ type Client interface {
 
 	Upload(bucket, objectName string, data []byte) error
 	Download(bucket, objectName string, buffer []byte) ([]byte, error)
+	DownloadRange(bucket, objectName string, offset, length int64, buffer []byte) ([]byte, error)
 	Delete(bucket, objectName string) error
-	ListObjects(bucket, prefix string) ([]string, error)
+	// ListObjects lists a single page of objects and prefixes.
+	ListObjects(ctx context.Context, bucket string, opts ListOptions) (ListPage, error)
+
+	// Put uploads size bytes from data to the specified path.
+	// size may be -1 when it is not known in advance.
+	Put(ctx context.Context, bucket, objectName string, data io.Reader, size int64, opts PutOptions) error
+	// Get returns a reader for the object data, which must be closed by the caller.
+	Get(ctx context.Context, bucket, objectName string) (io.ReadCloser, ObjectInfo, error)
+	// GetRange returns a reader for length bytes of object data starting at offset.
+	// The returned ObjectInfo.Size is the size of the range.
+	GetRange(ctx context.Context, bucket, objectName string, offset, length int64) (io.ReadCloser, ObjectInfo, error)
+	// Stat returns information about the object without downloading it.
+	Stat(ctx context.Context, bucket, objectName string) (ObjectInfo, error)
+	// Copy copies an object without transferring the data through the client.
+	Copy(ctx context.Context, srcBucket, srcKey, dstBucket, dstKey string) error
+}
+
+// Mover is implemented by clients that can move objects without copying the data.
+type Mover interface {
+	Move(ctx context.Context, srcBucket, srcKey, dstBucket, dstKey string) error
+}
+
+// ErrUnsupported is returned when the backend doesn't support the operation.
+var ErrUnsupported = errors.New("operation not supported")
+
+// Move moves an object with client when it implements Mover. The wrapping
+// clients implement Mover regardless of the backend, hence support is only
+// detected by the move failing with ErrUnsupported.
+func Move(ctx context.Context, client Client, srcBucket, srcKey, dstBucket, dstKey string) error {
+	mover, ok := client.(Mover)
+	if !ok {
+		return ErrUnsupported
+	}
+	return mover.Move(ctx, srcBucket, srcKey, dstBucket, dstKey)
+}
+
+// DefaultContentType is used for uploads that don't specify a content type.
+const DefaultContentType = "application/octet-stream"
+
+// PutOptions contains optional parameters for uploads.
+type PutOptions struct {
+	// ContentType defaults to DefaultContentType.
+	ContentType string
+	// Metadata is the user metadata of the object.
+	Metadata map[string]string
+}
+
+// contentType returns the content type to use for the upload.
+func (opts PutOptions) contentType() string {
+	if opts.ContentType == "" {
+		return DefaultContentType
+	}
+	return opts.ContentType
+}
+
+// ObjectInfo contains information about an object.
+//
+// Fields that the backend doesn't report are left empty.
+type ObjectInfo struct {
+	Key string
+	// Size is -1 when the backend does not report it before the data is read.
+	Size int64
+
+	ETag         string
+	ContentType  string
+	LastModified time.Time
+	// Metadata is the user metadata of the object.
+	Metadata map[string]string
+}
+
+// ListOptions configures object listing.
+type ListOptions struct {
+	Prefix string
+	// Recursive lists all objects under the prefix instead of grouping
+	// them into prefixes by the "/" delimiter.
+	Recursive bool
+
+	// MaxKeys limits the number of entries in a page, 0 uses the backend default.
+	MaxKeys int
+	// ContinuationToken continues listing from a previous page.
+	ContinuationToken string
+}
+
+// ListEntry is an object or a prefix in a listing.
+type ListEntry struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+	IsPrefix     bool
+}
+
+// ListPage is a single page of a listing.
+type ListPage struct {
+	Entries []ListEntry
+	// NextContinuationToken is empty when there are no more entries.
+	NextContinuationToken string
+}
+
+// ListAll lists all pages of objects and prefixes.
+func ListAll(ctx context.Context, client Client, bucket string, opts ListOptions) ([]ListEntry, error) {
+	entries := []ListEntry{}
+	for {
+		page, err := client.ListObjects(ctx, bucket, opts)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, page.Entries...)
+
+		if page.NextContinuationToken == "" {
+			return entries, nil
+		}
+		opts.ContinuationToken = page.NextContinuationToken
+	}
+}
+
+// putBytes implements Client.Upload using Client.Put.
+func putBytes(client Client, bucket, objectName string, data []byte) error {
+	return client.Put(context.Background(), bucket, objectName, bytes.NewReader(data), int64(len(data)), PutOptions{})
+}
+
+// getBytes implements Client.Download using Client.Get.
+func getBytes(client Client, bucket, objectName string, buffer []byte) (_ []byte, err error) {
+	reader, _, err := client.Get(context.Background(), bucket, objectName)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { err = errs.Combine(err, reader.Close()) }()
+
+	return ReadInto(reader, buffer)
+}
+
+// getRangeBytes implements Client.DownloadRange using Client.GetRange.
+func getRangeBytes(client Client, bucket, objectName string, offset, length int64, buffer []byte) (_ []byte, err error) {
+	reader, _, err := client.GetRange(context.Background(), bucket, objectName, offset, length)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { err = errs.Combine(err, reader.Close()) }()
+
+	return ReadInto(reader, buffer)
+}
+
+// httpRange returns the value of Range header for reading length bytes starting at offset.
+func httpRange(offset, length int64) string {
+	return fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)
+}
+
+// userMetadata returns user metadata from the x-amz-meta- headers.
+func userMetadata(header http.Header) map[string]string {
+	const prefix = "x-amz-meta-"
+
+	metadata := map[string]string{}
+	for name, values := range header {
+		name = strings.ToLower(name)
+		if strings.HasPrefix(name, prefix) && len(values) > 0 {
+			metadata[strings.TrimPrefix(name, prefix)] = values[0]
+		}
+	}
+	return metadata
+}
+
+// ReadInto reads everything from r into buffer, growing it when necessary.
+func ReadInto(r io.Reader, buffer []byte) ([]byte, error) {
+	buffer = buffer[:0]
+
+	var probe [1]byte
+	for {
+		full := len(buffer) == cap(buffer)
+
+		target := buffer[len(buffer):cap(buffer)]
+		if full {
+			// avoid reallocating the buffer when the data fits exactly
+			target = probe[:]
+		}
+
+		n, err := r.Read(target)
+		if full {
+			buffer = append(buffer, probe[:n]...)
+		} else {
+			buffer = buffer[:len(buffer)+n]
+		}
+
+		if errors.Is(err, io.EOF) {
+			return buffer, nil
+		}
+		if err != nil {
+			return buffer, err
+		}
+	}
+}
+
+// classReader wraps read errors into the specified class.
+type classReader struct {
+	io.ReadCloser
+	class *errs.Class
+}
+
+// Read reads from the underlying reader.
+func (reader *classReader) Read(p []byte) (int, error) {
+	n, err := reader.ReadCloser.Read(p)
+	if err != nil && !errors.Is(err, io.EOF) {
+		err = reader.class.Wrap(err)
+	}
+	return n, err
+}
+
+// Close closes the underlying reader.
+func (reader *classReader) Close() error {
+	return reader.class.Wrap(reader.ReadCloser.Close())
 }
@@ -0,0 +1,198 @@
+// Copyright (C) 2021 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package s3client
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-ini/ini"
+)
+
+// Bucket addressing styles of Config.Addressing.
+const (
+	// AddressingAuto uses the default style of the backend.
+	AddressingAuto = ""
+	// AddressingPath puts the bucket name in the path, e.g. host/bucket/key.
+	AddressingPath = "path"
+	// AddressingVirtual puts the bucket name in the host name, e.g. bucket.host/key.
+	AddressingVirtual = "virtual"
+)
+
+// TLSConfig configures the HTTPS connections to the gateway.
+type TLSConfig struct {
+	// CAFile is a PEM bundle of the certificate authorities that are
+	// trusted instead of the system roots.
+	CAFile string
+	// CertFile and KeyFile are the PEM client certificate and key.
+	CertFile string
+	KeyFile  string
+	// InsecureSkipVerify disables verifying the gateway certificate.
+	InsecureSkipVerify bool
+}
+
+// IsZero returns whether the default TLS configuration is used.
+func (conf TLSConfig) IsZero() bool {
+	return conf == TLSConfig{}
+}
+
+// Load loads the certificates and returns the configuration for crypto/tls.
+func (conf TLSConfig) Load() (*tls.Config, error) {
+	config := &tls.Config{
+		InsecureSkipVerify: conf.InsecureSkipVerify, // #nosec G402 // explicitly requested
+	}
+
+	if conf.CAFile != "" {
+		pem, err := ioutil.ReadFile(conf.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA file %q", conf.CAFile)
+		}
+	}
+
+	if conf.CertFile != "" || conf.KeyFile != "" {
+		if conf.CertFile == "" || conf.KeyFile == "" {
+			return nil, errors.New("client certificate requires both a certificate and a key file")
+		}
+		cert, err := tls.LoadX509KeyPair(conf.CertFile, conf.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
+
+// Endpoint returns the gateway URL. A gateway address without a scheme
+// uses HTTPS unless NoSSL is set.
+func (conf Config) Endpoint() string {
+	if strings.HasPrefix(conf.S3Gateway, "https://") || strings.HasPrefix(conf.S3Gateway, "http://") {
+		return conf.S3Gateway
+	}
+	if conf.NoSSL {
+		return "http://" + conf.S3Gateway
+	}
+	return "https://" + conf.S3Gateway
+}
+
+// Secure returns whether the gateway is accessed with HTTPS.
+func (conf Config) Secure() bool {
+	return strings.HasPrefix(conf.Endpoint(), "https://")
+}
+
+// Host returns the gateway address without the scheme.
+func (conf Config) Host() string {
+	endpoint := conf.Endpoint()
+	return strings.TrimSuffix(endpoint[strings.Index(endpoint, "://")+3:], "/")
+}
+
+// checkAddressing returns an error for an unknown addressing style.
+func (conf Config) checkAddressing() error {
+	switch conf.Addressing {
+	case AddressingAuto, AddressingPath, AddressingVirtual:
+		return nil
+	}
+	return fmt.Errorf("unknown addressing style %q, expected %q or %q", conf.Addressing, AddressingPath, AddressingVirtual)
+}
+
+// LoadEnv returns the configuration from the environment variables
+// AWS_ENDPOINT_URL, AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, AWS_REGION
+// (or AWS_DEFAULT_REGION), AWS_CA_BUNDLE and STORJ_ACCESS for the access
+// grant. Fields of unset variables are left empty.
+func LoadEnv(getenv func(string) string) Config {
+	region := getenv("AWS_REGION")
+	if region == "" {
+		region = getenv("AWS_DEFAULT_REGION")
+	}
+	return Config{
+		S3Gateway: getenv("AWS_ENDPOINT_URL"),
+		AccessKey: getenv("AWS_ACCESS_KEY_ID"),
+		SecretKey: getenv("AWS_SECRET_ACCESS_KEY"),
+		Access:    getenv("STORJ_ACCESS"),
+		Region:    region,
+		TLS:       TLSConfig{CAFile: getenv("AWS_CA_BUNDLE")},
+	}
+}
+
+// ProfileFiles returns the AWS credentials and config files and the
+// profile to use, honoring AWS_SHARED_CREDENTIALS_FILE, AWS_CONFIG_FILE
+// and AWS_PROFILE.
+func ProfileFiles(getenv func(string) string) (credentialsFile, configFile, profile string) {
+	home, _ := os.UserHomeDir()
+
+	credentialsFile = getenv("AWS_SHARED_CREDENTIALS_FILE")
+	if credentialsFile == "" && home != "" {
+		credentialsFile = filepath.Join(home, ".aws", "credentials")
+	}
+	configFile = getenv("AWS_CONFIG_FILE")
+	if configFile == "" && home != "" {
+		configFile = filepath.Join(home, ".aws", "config")
+	}
+	profile = getenv("AWS_PROFILE")
+	if profile == "" {
+		profile = "default"
+	}
+	return credentialsFile, configFile, profile
+}
+
+// LoadProfile returns the configuration of profile from AWS style
+// credentials and config files. Missing files are ignored.
+//
+// The credentials file sets aws_access_key_id and aws_secret_access_key,
+// the config file sets endpoint_url, region and ca_bundle.
+func LoadProfile(credentialsFile, configFile, profile string) (Config, error) {
+	var conf Config
+
+	credentials, err := loadIni(credentialsFile, profile)
+	if err != nil {
+		return conf, err
+	}
+	conf.AccessKey = credentials["aws_access_key_id"]
+	conf.SecretKey = credentials["aws_secret_access_key"]
+
+	// the config file names sections other than the default "profile <name>"
+	section := profile
+	if profile != "default" {
+		section = "profile " + profile
+	}
+	config, err := loadIni(configFile, section)
+	if err != nil {
+		return conf, err
+	}
+	conf.S3Gateway = config["endpoint_url"]
+	conf.Region = config["region"]
+	conf.TLS.CAFile = config["ca_bundle"]
+
+	return conf, nil
+}
+
+// loadIni returns the keys of section in the ini file, missing files and sections are empty.
+func loadIni(path, section string) (map[string]string, error) {
+	if path == "" {
+		return nil, nil
+	}
+	file, err := ini.Load(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to load %q: %w", path, err)
+	}
+	keys, err := file.GetSection(section)
+	if err != nil {
+		// the only possible error is a missing section
+		return nil, nil
+	}
+	return keys.KeysHash(), nil
+}
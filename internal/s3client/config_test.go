@@ -0,0 +1,146 @@
+// Copyright (C) 2021 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package s3client_test
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"storj.io/benchmark/internal/s3client"
+	"storj.io/benchmark/internal/s3fake"
+)
+
+func TestConfigEndpoint(t *testing.T) {
+	for _, test := range []struct {
+		conf     s3client.Config
+		endpoint string
+		host     string
+	}{
+		{s3client.Config{S3Gateway: "127.0.0.1:7777"}, "https://127.0.0.1:7777", "127.0.0.1:7777"},
+		{s3client.Config{S3Gateway: "127.0.0.1:7777", NoSSL: true}, "http://127.0.0.1:7777", "127.0.0.1:7777"},
+		{s3client.Config{S3Gateway: "https://gateway.test/", NoSSL: true}, "https://gateway.test/", "gateway.test"},
+		{s3client.Config{S3Gateway: "http://gateway.test"}, "http://gateway.test", "gateway.test"},
+	} {
+		if got := test.conf.Endpoint(); got != test.endpoint {
+			t.Errorf("%+v: endpoint %q, expected %q", test.conf, got, test.endpoint)
+		}
+		if got := test.conf.Host(); got != test.host {
+			t.Errorf("%+v: host %q, expected %q", test.conf, got, test.host)
+		}
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "s3client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	credentialsFile := filepath.Join(dir, "credentials")
+	configFile := filepath.Join(dir, "config")
+	writeFile(t, credentialsFile, "[default]\naws_access_key_id = default-key\n\n[ci]\naws_access_key_id = ci-key\naws_secret_access_key = ci-secret\n")
+	writeFile(t, configFile, "[default]\nregion = us-east-1\n\n[profile ci]\nregion = eu-west-1\nendpoint_url = https://gateway.test\nca_bundle = /ca.pem\n")
+
+	conf, err := s3client.LoadProfile(credentialsFile, configFile, "ci")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := s3client.Config{
+		S3Gateway: "https://gateway.test",
+		AccessKey: "ci-key",
+		SecretKey: "ci-secret",
+		Region:    "eu-west-1",
+		TLS:       s3client.TLSConfig{CAFile: "/ca.pem"},
+	}
+	if conf.S3Gateway != expected.S3Gateway || conf.AccessKey != expected.AccessKey || conf.SecretKey != expected.SecretKey ||
+		conf.Region != expected.Region || conf.TLS != expected.TLS {
+		t.Errorf("loaded %+v, expected %+v", conf, expected)
+	}
+
+	conf, err = s3client.LoadProfile(filepath.Join(dir, "missing"), configFile, "missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf.AccessKey != "" || conf.Region != "" {
+		t.Errorf("expected an empty configuration, got %+v", conf)
+	}
+
+	env := map[string]string{
+		"AWS_ACCESS_KEY_ID":  "env-key",
+		"AWS_DEFAULT_REGION": "default-region",
+		"AWS_PROFILE":        "ci",
+	}
+	conf = s3client.LoadEnv(func(key string) string { return env[key] })
+	if conf.AccessKey != "env-key" || conf.Region != "default-region" || conf.SecretKey != "" {
+		t.Errorf("unexpected configuration from the environment %+v", conf)
+	}
+	if _, _, profile := s3client.ProfileFiles(func(key string) string { return env[key] }); profile != "ci" {
+		t.Errorf("unexpected profile %q", profile)
+	}
+}
+
+func TestMinioTLS(t *testing.T) {
+	server := s3fake.NewServer()
+	defer server.Close()
+	tlsServer := httptest.NewTLSServer(server)
+	defer tlsServer.Close()
+
+	dir, err := ioutil.TempDir("", "s3client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	caFile := filepath.Join(dir, "ca.pem")
+	writeFile(t, caFile, string(pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: tlsServer.Certificate().Raw,
+	})))
+
+	for _, test := range []struct {
+		tls   s3client.TLSConfig
+		valid bool
+	}{
+		{s3client.TLSConfig{}, false},
+		{s3client.TLSConfig{CAFile: caFile}, true},
+		{s3client.TLSConfig{InsecureSkipVerify: true}, true},
+	} {
+		client, err := s3client.NewMinio(s3client.Config{
+			S3Gateway: tlsServer.URL,
+			AccessKey: "access",
+			SecretKey: "secret",
+			TLS:       test.tls,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = client.ListBuckets()
+		if test.valid && err != nil {
+			t.Errorf("%+v: %v", test.tls, err)
+		}
+		if !test.valid && err == nil {
+			t.Errorf("%+v: expected a certificate error", test.tls)
+		}
+	}
+
+	_, err = s3client.NewMinio(s3client.Config{
+		S3Gateway: tlsServer.URL,
+		TLS:       s3client.TLSConfig{CertFile: caFile},
+	})
+	if err == nil {
+		t.Error("expected an error for a client certificate without a key")
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,154 @@
+// Copyright (C) 2021 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package s3client
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Errors reported by all clients regardless of how the backend describes them.
+// They are matched with errors.Is, the backend error class is kept.
+var (
+	ErrObjectNotFound = errors.New("object not found")
+	ErrBucketNotFound = errors.New("bucket not found")
+	ErrBucketExists   = errors.New("bucket already exists")
+	ErrAccessDenied   = errors.New("access denied")
+	ErrTimeout        = errors.New("timeout")
+	ErrThrottled      = errors.New("throttled")
+)
+
+// errorKinds are the errors returned by ErrorKind and their names.
+var errorKinds = []struct {
+	err  error
+	name string
+}{
+	{ErrObjectNotFound, "object-not-found"},
+	{ErrBucketNotFound, "bucket-not-found"},
+	{ErrBucketExists, "bucket-exists"},
+	{ErrAccessDenied, "access-denied"},
+	{ErrTimeout, "timeout"},
+	{ErrThrottled, "throttled"},
+}
+
+// ErrorKind returns the error of the above list that err matches or nil.
+func ErrorKind(err error) error {
+	for _, kind := range errorKinds {
+		if errors.Is(err, kind.err) {
+			return kind.err
+		}
+	}
+	return nil
+}
+
+// kindError marks an error as matching one of the above errors.
+type kindError struct {
+	kind error
+	err  error
+}
+
+func (err *kindError) Error() string        { return err.err.Error() }
+func (err *kindError) Unwrap() error        { return err.err }
+func (err *kindError) Is(target error) bool { return target == err.kind }
+
+// withKind marks err as kind, a nil kind leaves err unchanged.
+func withKind(err, kind error) error {
+	if err == nil || kind == nil || errors.Is(err, kind) {
+		return err
+	}
+	return &kindError{kind: kind, err: err}
+}
+
+// s3CodeKinds maps S3 error codes.
+var s3CodeKinds = map[string]error{
+	"NoSuchKey":               ErrObjectNotFound,
+	"NotFound":                ErrObjectNotFound,
+	"NoSuchBucket":            ErrBucketNotFound,
+	"BucketAlreadyExists":     ErrBucketExists,
+	"BucketAlreadyOwnedByYou": ErrBucketExists,
+	"AccessDenied":            ErrAccessDenied,
+	"InvalidAccessKeyId":      ErrAccessDenied,
+	"SignatureDoesNotMatch":   ErrAccessDenied,
+	"RequestTimeout":          ErrTimeout,
+	"SlowDown":                ErrThrottled,
+	"Throttling":              ErrThrottled,
+	"ThrottlingException":     ErrThrottled,
+	"RequestLimitExceeded":    ErrThrottled,
+	"TooManyRequests":         ErrThrottled,
+}
+
+// s3Kind classifies an S3 error response by its code or, when the
+// response has no body, by its status code.
+func s3Kind(code string, status int) error {
+	if kind, ok := s3CodeKinds[code]; ok {
+		return kind
+	}
+	switch status {
+	case http.StatusNotFound:
+		// responses to HEAD requests don't contain a code
+		return ErrObjectNotFound
+	case http.StatusForbidden:
+		return ErrAccessDenied
+	case http.StatusRequestTimeout, http.StatusGatewayTimeout:
+		return ErrTimeout
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return ErrThrottled
+	}
+	return nil
+}
+
+// netKind returns ErrTimeout for network timeouts.
+func netKind(err error) error {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return ErrTimeout
+	}
+	return nil
+}
+
+// awsCodePattern matches the error code in the output of the AWS CLI, e.g.
+// "An error occurred (NoSuchKey) when calling the GetObject operation".
+var awsCodePattern = regexp.MustCompile(`An error occurred \(([^)]+)\)`)
+
+// outputPatterns match the lowercase error output of the command line tools.
+var outputPatterns = []struct {
+	text string
+	kind error
+}{
+	{"object not found", ErrObjectNotFound},
+	{"key does not exist", ErrObjectNotFound},
+	{"bucket not found", ErrBucketNotFound},
+	{"bucket does not exist", ErrBucketNotFound},
+	{"bucket already exists", ErrBucketExists},
+	{"access denied", ErrAccessDenied},
+	{"permission denied", ErrAccessDenied},
+	{"deadline exceeded", ErrTimeout},
+	{"timed out", ErrTimeout},
+	{"timeout", ErrTimeout},
+	{"too many requests", ErrThrottled},
+	{"slow down", ErrThrottled},
+	{"rate limit", ErrThrottled},
+}
+
+// outputKind classifies the error output of a command line tool.
+func outputKind(output string) error {
+	if match := awsCodePattern.FindStringSubmatch(output); match != nil {
+		status, _ := strconv.Atoi(match[1])
+		if kind := s3Kind(match[1], status); kind != nil {
+			return kind
+		}
+	}
+
+	output = strings.ToLower(output)
+	for _, pattern := range outputPatterns {
+		if strings.Contains(output, pattern.text) {
+			return pattern.kind
+		}
+	}
+	return nil
+}
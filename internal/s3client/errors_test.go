@@ -0,0 +1,102 @@
+// Copyright (C) 2021 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package s3client_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"storj.io/benchmark/internal/s3client"
+	"storj.io/common/testcontext"
+	"storj.io/storj/private/testplanet"
+)
+
+func TestCommandErrors(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires a shell")
+	}
+
+	binary, err := filepath.Abs(filepath.Join("testdata", "fail.sh"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	awscli, err := s3client.NewAWSCLI(s3client.Config{
+		S3Gateway: "127.0.0.1:7777",
+		Options:   map[string]string{"binary": binary},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	uplink, err := s3client.NewUplink(s3client.Config{
+		Access:  "access",
+		Options: map[string]string{"binary": binary},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		client s3client.Client
+		output string
+		kind   error
+	}{
+		{awscli, "An error occurred (404) when calling the HeadObject operation: Not Found", s3client.ErrObjectNotFound},
+		{awscli, "An error occurred (NoSuchBucket) when calling the ListObjectsV2 operation: The specified bucket does not exist", s3client.ErrBucketNotFound},
+		{awscli, "An error occurred (BucketAlreadyOwnedByYou) when calling the CreateBucket operation", s3client.ErrBucketExists},
+		{awscli, "An error occurred (403) when calling the HeadObject operation: Forbidden", s3client.ErrAccessDenied},
+		{awscli, "An error occurred (SlowDown) when calling the PutObject operation: Please reduce your request rate.", s3client.ErrThrottled},
+		{awscli, `Read timeout on endpoint URL: "http://127.0.0.1:7777/bucket/object"`, s3client.ErrTimeout},
+		{uplink, "uplink: object not found", s3client.ErrObjectNotFound},
+		{uplink, "uplink: bucket not found", s3client.ErrBucketNotFound},
+		{uplink, "uplink: permission denied", s3client.ErrAccessDenied},
+		{uplink, "uplink: too many requests", s3client.ErrThrottled},
+		{uplink, "uplink: something else", nil},
+	} {
+		if err := os.Setenv("FAIL_OUTPUT", test.output); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err := test.client.Stat(context.Background(), "bucket", "object")
+		if err == nil {
+			t.Fatalf("%q: expected an error", test.output)
+		}
+		if kind := s3client.ErrorKind(err); kind != test.kind {
+			t.Errorf("%q: got %v, expected %v", test.output, kind, test.kind)
+		}
+		if test.kind != nil && !errors.Is(err, test.kind) {
+			t.Errorf("%q: error does not match %v", test.output, test.kind)
+		}
+	}
+	_ = os.Unsetenv("FAIL_OUTPUT")
+}
+
+func TestUplinkLibErrors(t *testing.T) {
+	testplanet.Run(t, testplanet.Config{
+		SatelliteCount: 1, StorageNodeCount: 0, UplinkCount: 1,
+	}, func(t *testing.T, ctx *testcontext.Context, planet *testplanet.Planet) {
+		access, err := planet.Uplinks[0].Access[planet.Satellites[0].ID()].Serialize()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		client, err := s3client.NewUplinkLib(s3client.Config{Access: access})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ctx.Check(client.(io.Closer).Close)
+
+		data := []byte("data")
+		err = client.Put(ctx, "missing", "object", bytes.NewReader(data), int64(len(data)), s3client.PutOptions{})
+		if kind := s3client.ErrorKind(err); kind != s3client.ErrBucketNotFound {
+			t.Fatalf("expected %v, got %v: %v", s3client.ErrBucketNotFound, kind, err)
+		}
+	})
+}
@@ -0,0 +1,495 @@
+// Copyright (C) 2021 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package s3client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrInjected is returned for errors injected by Faults.
+var ErrInjected = errors.New("injected fault")
+
+// Latency returns a random delay.
+type Latency func(rng *rand.Rand) time.Duration
+
+// ParseLatency parses a latency distribution.
+//
+// The supported distributions are "fixed:D", "uniform:MIN-MAX",
+// "normal:MEAN,STDDEV" and "exp:MEAN", where all values are durations,
+// e.g. "uniform:10ms-100ms". A plain duration is the same as "fixed:D".
+func ParseLatency(spec string) (Latency, error) {
+	kind, args := "fixed", spec
+	if i := strings.IndexByte(spec, ':'); i >= 0 {
+		kind, args = spec[:i], spec[i+1:]
+	}
+
+	parse := func(sep string, count int) ([]time.Duration, error) {
+		parts := strings.Split(args, sep)
+		if len(parts) != count {
+			return nil, fmt.Errorf("latency %q: expected %d values", spec, count)
+		}
+		values := make([]time.Duration, len(parts))
+		for i, part := range parts {
+			value, err := time.ParseDuration(strings.TrimSpace(part))
+			if err != nil {
+				return nil, fmt.Errorf("latency %q: %w", spec, err)
+			}
+			values[i] = value
+		}
+		return values, nil
+	}
+
+	switch kind {
+	case "fixed":
+		values, err := parse(",", 1)
+		if err != nil {
+			return nil, err
+		}
+		return func(rng *rand.Rand) time.Duration {
+			return values[0]
+		}, nil
+	case "uniform":
+		values, err := parse("-", 2)
+		if err != nil {
+			return nil, err
+		}
+		min, max := values[0], values[1]
+		if max < min {
+			return nil, fmt.Errorf("latency %q: maximum is less than minimum", spec)
+		}
+		return func(rng *rand.Rand) time.Duration {
+			return min + time.Duration(rng.Int63n(int64(max-min)+1))
+		}, nil
+	case "normal":
+		values, err := parse(",", 2)
+		if err != nil {
+			return nil, err
+		}
+		mean, stddev := values[0], values[1]
+		return func(rng *rand.Rand) time.Duration {
+			delay := time.Duration(rng.NormFloat64()*float64(stddev)) + mean
+			if delay < 0 {
+				return 0
+			}
+			return delay
+		}, nil
+	case "exp":
+		values, err := parse(",", 1)
+		if err != nil {
+			return nil, err
+		}
+		mean := values[0]
+		return func(rng *rand.Rand) time.Duration {
+			return time.Duration(rng.ExpFloat64() * float64(mean))
+		}, nil
+	default:
+		return nil, fmt.Errorf("latency %q: unknown distribution %q", spec, kind)
+	}
+}
+
+// FaultOptions configures Faults.
+type FaultOptions struct {
+	// Seed initializes the random source, making the faults reproducible.
+	Seed int64
+	// Latency is added before every call, nil adds no delay.
+	Latency Latency
+	// ErrorRates is the probability of failing a call with ErrInjected,
+	// keyed by the operation name, e.g. "Upload". The "*" key applies
+	// to the operations that aren't listed.
+	ErrorRates map[string]float64
+	// TruncateRate is the probability of a download ending early without an error.
+	TruncateRate float64
+	// CorruptRate is the probability of a download containing a modified byte.
+	CorruptRate float64
+}
+
+// FaultStats counts the injected faults of a kind for an operation.
+type FaultStats struct {
+	Op string
+	// Kind is "error", "truncate" or "corrupt".
+	Kind  string
+	Count int
+}
+
+// Faults is a Client that injects latency, errors and damaged downloads.
+//
+// Downloads are Download, DownloadRange, Get and GetRange. Truncated and
+// corrupted downloads don't return an error, they must be detected by
+// the caller.
+type Faults struct {
+	client Client
+	opts   FaultOptions
+
+	mu    sync.Mutex
+	rng   *rand.Rand
+	stats map[[2]string]int
+}
+
+var _ Client = (*Faults)(nil)
+var _ MultipartUploader = (*Faults)(nil)
+var _ Mover = (*Faults)(nil)
+
+// NewFaults wraps client with fault injection.
+func NewFaults(client Client, opts FaultOptions) *Faults {
+	return &Faults{
+		client: client,
+		opts:   opts,
+		rng:    rand.New(rand.NewSource(opts.Seed)),
+		stats:  map[[2]string]int{},
+	}
+}
+
+// Stats returns the injected faults sorted by operation and kind.
+func (client *Faults) Stats() []FaultStats {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	all := make([]FaultStats, 0, len(client.stats))
+	for key, count := range client.stats {
+		all = append(all, FaultStats{Op: key[0], Kind: key[1], Count: count})
+	}
+	sort.Slice(all, func(i, k int) bool {
+		if all[i].Op != all[k].Op {
+			return all[i].Op < all[k].Op
+		}
+		return all[i].Kind < all[k].Kind
+	})
+	return all
+}
+
+// roll returns true with the probability rate and counts the fault.
+func (client *Faults) roll(op, kind string, rate float64) bool {
+	if rate <= 0 {
+		return false
+	}
+
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	if client.rng.Float64() >= rate {
+		return false
+	}
+	client.stats[[2]string{op, kind}]++
+	return true
+}
+
+// intn returns a random number in [0, n).
+func (client *Faults) intn(n int64) int64 {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	return client.rng.Int63n(n)
+}
+
+// inject delays the call and returns an error when it should fail.
+func (client *Faults) inject(ctx context.Context, op string) error {
+	if client.opts.Latency != nil {
+		client.mu.Lock()
+		delay := client.opts.Latency(client.rng)
+		client.mu.Unlock()
+
+		if !sleep(ctx, delay) {
+			return ctx.Err()
+		}
+	}
+
+	rate, ok := client.opts.ErrorRates[op]
+	if !ok {
+		rate = client.opts.ErrorRates["*"]
+	}
+	if client.roll(op, "error", rate) {
+		return fmt.Errorf("%s: %w", op, ErrInjected)
+	}
+	return nil
+}
+
+// damage truncates or corrupts downloaded data.
+func (client *Faults) damage(op string, data []byte) []byte {
+	if len(data) == 0 {
+		return data
+	}
+	if client.roll(op, "truncate", client.opts.TruncateRate) {
+		data = data[:client.intn(int64(len(data)))]
+	}
+	if len(data) > 0 && client.roll(op, "corrupt", client.opts.CorruptRate) {
+		data[client.intn(int64(len(data)))] ^= 0xFF
+	}
+	return data
+}
+
+// damageReader truncates or corrupts a download of size bytes. When the size
+// is unknown, e.g. for the command line backends, the faults are placed in
+// the data returned by the first read.
+func (client *Faults) damageReader(op string, reader io.ReadCloser, size int64) io.ReadCloser {
+	if size == 0 {
+		return reader
+	}
+	damaged := &faultReader{reader: reader, limit: -1, corrupt: -1}
+	if size < 0 {
+		damaged.client, damaged.op = client, op
+		return damaged
+	}
+	if client.roll(op, "truncate", client.opts.TruncateRate) {
+		damaged.limit = client.intn(size)
+		size = damaged.limit
+	}
+	if size > 0 && client.roll(op, "corrupt", client.opts.CorruptRate) {
+		damaged.corrupt = client.intn(size)
+	}
+	return damaged
+}
+
+// MakeBucket makes a new bucket.
+func (client *Faults) MakeBucket(bucket, location string) error {
+	if err := client.inject(context.Background(), "MakeBucket"); err != nil {
+		return err
+	}
+	return client.client.MakeBucket(bucket, location)
+}
+
+// RemoveBucket removes a bucket.
+func (client *Faults) RemoveBucket(bucket string) error {
+	if err := client.inject(context.Background(), "RemoveBucket"); err != nil {
+		return err
+	}
+	return client.client.RemoveBucket(bucket)
+}
+
+// ListBuckets lists all buckets.
+func (client *Faults) ListBuckets() ([]string, error) {
+	if err := client.inject(context.Background(), "ListBuckets"); err != nil {
+		return nil, err
+	}
+	return client.client.ListBuckets()
+}
+
+// Upload uploads object data to the specified path.
+func (client *Faults) Upload(bucket, objectName string, data []byte) error {
+	if err := client.inject(context.Background(), "Upload"); err != nil {
+		return err
+	}
+	return client.client.Upload(bucket, objectName, data)
+}
+
+// Download downloads object data.
+func (client *Faults) Download(bucket, objectName string, buffer []byte) ([]byte, error) {
+	if err := client.inject(context.Background(), "Download"); err != nil {
+		return buffer[:0], err
+	}
+	data, err := client.client.Download(bucket, objectName, buffer)
+	if err != nil {
+		return data, err
+	}
+	return client.damage("Download", data), nil
+}
+
+// DownloadRange downloads length bytes of object data starting at offset.
+func (client *Faults) DownloadRange(bucket, objectName string, offset, length int64, buffer []byte) ([]byte, error) {
+	if err := client.inject(context.Background(), "DownloadRange"); err != nil {
+		return buffer[:0], err
+	}
+	data, err := client.client.DownloadRange(bucket, objectName, offset, length, buffer)
+	if err != nil {
+		return data, err
+	}
+	return client.damage("DownloadRange", data), nil
+}
+
+// Delete deletes object.
+func (client *Faults) Delete(bucket, objectName string) error {
+	if err := client.inject(context.Background(), "Delete"); err != nil {
+		return err
+	}
+	return client.client.Delete(bucket, objectName)
+}
+
+// ListObjects lists a single page of objects and prefixes.
+func (client *Faults) ListObjects(ctx context.Context, bucket string, opts ListOptions) (ListPage, error) {
+	if err := client.inject(ctx, "ListObjects"); err != nil {
+		return ListPage{}, err
+	}
+	return client.client.ListObjects(ctx, bucket, opts)
+}
+
+// Put uploads object data from the reader to the specified path.
+func (client *Faults) Put(ctx context.Context, bucket, objectName string, data io.Reader, size int64, opts PutOptions) error {
+	if err := client.inject(ctx, "Put"); err != nil {
+		return err
+	}
+	return client.client.Put(ctx, bucket, objectName, data, size, opts)
+}
+
+// Get returns a reader for the object data.
+func (client *Faults) Get(ctx context.Context, bucket, objectName string) (io.ReadCloser, ObjectInfo, error) {
+	if err := client.inject(ctx, "Get"); err != nil {
+		return nil, ObjectInfo{}, err
+	}
+	reader, info, err := client.client.Get(ctx, bucket, objectName)
+	if err != nil {
+		return reader, info, err
+	}
+	return client.damageReader("Get", reader, info.Size), info, nil
+}
+
+// GetRange returns a reader for length bytes of object data starting at offset.
+func (client *Faults) GetRange(ctx context.Context, bucket, objectName string, offset, length int64) (io.ReadCloser, ObjectInfo, error) {
+	if err := client.inject(ctx, "GetRange"); err != nil {
+		return nil, ObjectInfo{}, err
+	}
+	reader, info, err := client.client.GetRange(ctx, bucket, objectName, offset, length)
+	if err != nil {
+		return reader, info, err
+	}
+	// the size of the range to the end is only known from the object info
+	size := length
+	if size < 0 {
+		size = info.Size
+	}
+	return client.damageReader("GetRange", reader, size), info, nil
+}
+
+// Stat returns information about the object.
+func (client *Faults) Stat(ctx context.Context, bucket, objectName string) (ObjectInfo, error) {
+	if err := client.inject(ctx, "Stat"); err != nil {
+		return ObjectInfo{}, err
+	}
+	return client.client.Stat(ctx, bucket, objectName)
+}
+
+// Copy copies an object.
+func (client *Faults) Copy(ctx context.Context, srcBucket, srcKey, dstBucket, dstKey string) error {
+	if err := client.inject(ctx, "Copy"); err != nil {
+		return err
+	}
+	return client.client.Copy(ctx, srcBucket, srcKey, dstBucket, dstKey)
+}
+
+// Move moves an object.
+func (client *Faults) Move(ctx context.Context, srcBucket, srcKey, dstBucket, dstKey string) error {
+	mover, ok := client.client.(Mover)
+	if !ok {
+		return ErrUnsupported
+	}
+	if err := client.inject(ctx, "Move"); err != nil {
+		return err
+	}
+	return mover.Move(ctx, srcBucket, srcKey, dstBucket, dstKey)
+}
+
+// InitiateMultipart starts a new multipart upload.
+func (client *Faults) InitiateMultipart(ctx context.Context, bucket, objectName string) (string, error) {
+	uploader, ok := client.client.(MultipartUploader)
+	if !ok {
+		return "", ErrUnsupported
+	}
+	if err := client.inject(ctx, "InitiateMultipart"); err != nil {
+		return "", err
+	}
+	return uploader.InitiateMultipart(ctx, bucket, objectName)
+}
+
+// UploadPart uploads a single part of a multipart upload.
+func (client *Faults) UploadPart(ctx context.Context, bucket, objectName, uploadID string, partNumber int, data io.Reader, size int64) (Part, error) {
+	uploader, ok := client.client.(MultipartUploader)
+	if !ok {
+		return Part{}, ErrUnsupported
+	}
+	if err := client.inject(ctx, "UploadPart"); err != nil {
+		return Part{}, err
+	}
+	return uploader.UploadPart(ctx, bucket, objectName, uploadID, partNumber, data, size)
+}
+
+// CompleteMultipart finishes a multipart upload.
+func (client *Faults) CompleteMultipart(ctx context.Context, bucket, objectName, uploadID string, parts []Part) error {
+	uploader, ok := client.client.(MultipartUploader)
+	if !ok {
+		return ErrUnsupported
+	}
+	if err := client.inject(ctx, "CompleteMultipart"); err != nil {
+		return err
+	}
+	return uploader.CompleteMultipart(ctx, bucket, objectName, uploadID, parts)
+}
+
+// AbortMultipart aborts a multipart upload.
+func (client *Faults) AbortMultipart(ctx context.Context, bucket, objectName, uploadID string) error {
+	uploader, ok := client.client.(MultipartUploader)
+	if !ok {
+		return ErrUnsupported
+	}
+	if err := client.inject(ctx, "AbortMultipart"); err != nil {
+		return err
+	}
+	return uploader.AbortMultipart(ctx, bucket, objectName, uploadID)
+}
+
+// Close closes the wrapped client when it implements io.Closer.
+func (client *Faults) Close() error {
+	if closer, ok := client.client.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// faultReader ends a download at limit and modifies the byte at corrupt,
+// negative values disable the faults. With client set the faults are placed
+// by the first read returning data.
+type faultReader struct {
+	reader  io.ReadCloser
+	offset  int64
+	limit   int64
+	corrupt int64
+
+	client *Faults
+	op     string
+}
+
+// Read reads from the underlying reader.
+func (reader *faultReader) Read(p []byte) (int, error) {
+	if reader.limit >= 0 {
+		if reader.offset >= reader.limit {
+			return 0, io.EOF
+		}
+		if remaining := reader.limit - reader.offset; int64(len(p)) > remaining {
+			p = p[:remaining]
+		}
+	}
+
+	n, err := reader.reader.Read(p)
+	if reader.client != nil && n > 0 {
+		n = reader.place(n)
+	}
+	if reader.corrupt >= reader.offset && reader.corrupt < reader.offset+int64(n) {
+		p[reader.corrupt-reader.offset] ^= 0xFF
+	}
+	reader.offset += int64(n)
+	return n, err
+}
+
+// place decides the faults for the n bytes of the first read the same way
+// as damage does for a whole download and returns the bytes to keep.
+func (reader *faultReader) place(n int) int {
+	client := reader.client
+	reader.client = nil
+	if client.roll(reader.op, "truncate", client.opts.TruncateRate) {
+		reader.limit = reader.offset + client.intn(int64(n))
+		n = int(reader.limit - reader.offset)
+	}
+	if n > 0 && client.roll(reader.op, "corrupt", client.opts.CorruptRate) {
+		reader.corrupt = reader.offset + client.intn(int64(n))
+	}
+	return n
+}
+
+// Close closes the underlying reader.
+func (reader *faultReader) Close() error {
+	return reader.reader.Close()
+}
@@ -0,0 +1,191 @@
+// Copyright (C) 2021 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package s3client_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"testing"
+	"time"
+
+	"storj.io/benchmark/internal/s3client"
+)
+
+func TestParseLatency(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, test := range []struct {
+		spec     string
+		min, max time.Duration
+	}{
+		{"50ms", 50 * time.Millisecond, 50 * time.Millisecond},
+		{"fixed:1s", time.Second, time.Second},
+		{"uniform:10ms-20ms", 10 * time.Millisecond, 20 * time.Millisecond},
+		{"normal:10ms,1ms", 0, time.Second},
+		{"exp:10ms", 0, time.Hour},
+	} {
+		latency, err := s3client.ParseLatency(test.spec)
+		if err != nil {
+			t.Fatalf("%q: %v", test.spec, err)
+		}
+		for i := 0; i < 100; i++ {
+			if delay := latency(rng); delay < test.min || delay > test.max {
+				t.Fatalf("%q: delay %v out of range", test.spec, delay)
+			}
+		}
+	}
+
+	for _, spec := range []string{"", "fixed:x", "uniform:20ms-10ms", "normal:10ms", "pareto:1s"} {
+		if _, err := s3client.ParseLatency(spec); err == nil {
+			t.Errorf("%q: expected an error", spec)
+		}
+	}
+}
+
+func TestFaults(t *testing.T) {
+	minio, cleanup := newTestClient(t, "bucket", s3client.NewMinio)
+	defer cleanup()
+
+	ctx := context.Background()
+	data := []byte("0123456789")
+	if err := minio.Upload("bucket", "object", data); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Errors", func(t *testing.T) {
+		client := s3client.NewFaults(minio, s3client.FaultOptions{
+			ErrorRates: map[string]float64{"Upload": 1},
+		})
+		err := client.Upload("bucket", "other", data)
+		if !errors.Is(err, s3client.ErrInjected) {
+			t.Fatalf("unexpected error %v", err)
+		}
+		if s3client.ErrorClass(err) != "injected" {
+			t.Fatalf("unexpected class %q", s3client.ErrorClass(err))
+		}
+		if _, err := client.Stat(ctx, "bucket", "object"); err != nil {
+			t.Fatal(err)
+		}
+
+		stats := client.Stats()
+		if len(stats) != 1 || stats[0] != (s3client.FaultStats{Op: "Upload", Kind: "error", Count: 1}) {
+			t.Fatalf("unexpected stats %+v", stats)
+		}
+	})
+
+	t.Run("Truncate", func(t *testing.T) {
+		client := s3client.NewFaults(minio, s3client.FaultOptions{TruncateRate: 1})
+		downloaded, err := client.Download("bucket", "object", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(downloaded) >= len(data) || !bytes.HasPrefix(data, downloaded) {
+			t.Fatalf("download not truncated: %q", downloaded)
+		}
+
+		reader, _, err := client.Get(ctx, "bucket", "object")
+		if err != nil {
+			t.Fatal(err)
+		}
+		read, err := ioutil.ReadAll(reader)
+		_ = reader.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(read) >= len(data) || !bytes.HasPrefix(data, read) {
+			t.Fatalf("reader not truncated: %q", read)
+		}
+	})
+
+	t.Run("Corrupt", func(t *testing.T) {
+		client := s3client.NewFaults(minio, s3client.FaultOptions{CorruptRate: 1})
+		reader, _, err := client.GetRange(ctx, "bucket", "object", 2, 5)
+		if err != nil {
+			t.Fatal(err)
+		}
+		read, err := ioutil.ReadAll(reader)
+		_ = reader.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(read) != 5 || bytes.Equal(read, data[2:7]) {
+			t.Fatalf("range not corrupted: %q", read)
+		}
+	})
+	t.Run("UnknownSize", func(t *testing.T) {
+		for _, opts := range []s3client.FaultOptions{{TruncateRate: 1}, {CorruptRate: 1}} {
+			client := s3client.NewFaults(unknownSize{minio}, opts)
+			reader, _, err := client.Get(ctx, "bucket", "object")
+			if err != nil {
+				t.Fatal(err)
+			}
+			read, err := ioutil.ReadAll(reader)
+			_ = reader.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if bytes.Equal(read, data) {
+				t.Fatalf("%+v: reader not damaged", opts)
+			}
+
+			stats := client.Stats()
+			if len(stats) != 1 || stats[0].Count != 1 {
+				t.Fatalf("%+v: unexpected stats %+v", opts, stats)
+			}
+		}
+	})
+}
+
+func TestFaultsRangeToEnd(t *testing.T) {
+	root, err := ioutil.TempDir("", "s3client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(root) }()
+
+	fs, err := s3client.NewFileSystem(s3client.Config{
+		Options: map[string]string{"root": root},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.MakeBucket("bucket", ""); err != nil {
+		t.Fatal(err)
+	}
+	data := []byte("0123456789")
+	if err := fs.Upload("bucket", "object", data); err != nil {
+		t.Fatal(err)
+	}
+
+	client := s3client.NewFaults(fs, s3client.FaultOptions{CorruptRate: 1})
+	reader, _, err := client.GetRange(context.Background(), "bucket", "object", 5, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	read, err := ioutil.ReadAll(reader)
+	_ = reader.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(read) != 5 || bytes.Equal(read, data[5:]) {
+		t.Fatalf("range not corrupted: %q", read)
+	}
+}
+
+// unknownSize is a client whose downloads don't report the object size,
+// like the command line backends.
+type unknownSize struct {
+	s3client.Client
+}
+
+// Get returns a reader for the object data without its size.
+func (client unknownSize) Get(ctx context.Context, bucket, objectName string) (io.ReadCloser, s3client.ObjectInfo, error) {
+	reader, info, err := client.Client.Get(ctx, bucket, objectName)
+	info.Size = -1
+	return reader, info, err
+}
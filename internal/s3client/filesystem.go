@@ -0,0 +1,501 @@
+// Copyright (C) 2021 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package s3client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/zeebo/errs"
+)
+
+// FileSystemError is class for local filesystem errors.
+var FileSystemError = errs.Class("fs error")
+
+// FileSystem implements Client by storing buckets as directories on a local disk.
+//
+// Keys are mapped to paths, hence keys that aren't clean relative paths,
+// such as "a//b" or "../a", are rejected. Content type and metadata are
+// stored in separate files under ".meta" when they're set.
+type FileSystem struct {
+	root  string
+	fsync bool
+}
+
+var _ Mover = (*FileSystem)(nil)
+
+func init() { Register("fs", NewFileSystem) }
+
+// NewFileSystem creates new Client.
+//
+// The "root" option is the directory containing the buckets, it's created
+// when it doesn't exist. The "fsync" option syncs the files and directories
+// to the disk before returning from uploads.
+func NewFileSystem(conf Config) (Client, error) {
+	opts := ParseOptions(conf.Options)
+	root := opts.String("root", "")
+	fsync := opts.Bool("fsync", false)
+	if err := opts.Err(); err != nil {
+		return nil, FileSystemError.Wrap(err)
+	}
+	if root == "" {
+		return nil, FileSystemError.New("%s", "root option is required")
+	}
+
+	if err := os.MkdirAll(filepath.Join(root, ".uploads"), 0755); err != nil {
+		return nil, FileSystemError.Wrap(err)
+	}
+	return &FileSystem{root: root, fsync: fsync}, nil
+}
+
+// fsMetadata is stored for objects with a content type or metadata.
+type fsMetadata struct {
+	ContentType string            `json:"content_type"`
+	Metadata    map[string]string `json:"metadata"`
+}
+
+func (client *FileSystem) bucketPath(bucket string) (string, error) {
+	if bucket == "" || strings.ContainsAny(bucket, `/\`) || strings.HasPrefix(bucket, ".") {
+		return "", fmt.Errorf("invalid bucket name %q", bucket)
+	}
+	return filepath.Join(client.root, bucket), nil
+}
+
+// paths returns the object and metadata paths of the key.
+func (client *FileSystem) paths(bucket, key string) (object, meta string, err error) {
+	dir, err := client.bucketPath(bucket)
+	if err != nil {
+		return "", "", err
+	}
+	if key == "" || path.Clean(key) != key || path.IsAbs(key) || key == ".." || strings.HasPrefix(key, "../") {
+		return "", "", fmt.Errorf("invalid key %q", key)
+	}
+	return filepath.Join(dir, filepath.FromSlash(key)),
+		filepath.Join(client.root, ".meta", bucket, filepath.FromSlash(key)), nil
+}
+
+// objectError marks errors of missing objects and buckets.
+func (client *FileSystem) objectError(bucket string, err error) error {
+	if !os.IsNotExist(err) {
+		return FileSystemError.Wrap(err)
+	}
+	if _, statErr := os.Stat(filepath.Join(client.root, bucket)); os.IsNotExist(statErr) {
+		return FileSystemError.Wrap(withKind(err, ErrBucketNotFound))
+	}
+	return FileSystemError.Wrap(withKind(err, ErrObjectNotFound))
+}
+
+// MakeBucket makes a new bucket.
+func (client *FileSystem) MakeBucket(bucket, location string) error {
+	dir, err := client.bucketPath(bucket)
+	if err != nil {
+		return FileSystemError.Wrap(err)
+	}
+	err = os.Mkdir(dir, 0755)
+	if os.IsExist(err) {
+		return FileSystemError.Wrap(withKind(err, ErrBucketExists))
+	}
+	return FileSystemError.Wrap(err)
+}
+
+// RemoveBucket removes an empty bucket.
+func (client *FileSystem) RemoveBucket(bucket string) error {
+	dir, err := client.bucketPath(bucket)
+	if err != nil {
+		return FileSystemError.Wrap(err)
+	}
+	err = os.Remove(dir)
+	if os.IsNotExist(err) {
+		return FileSystemError.Wrap(withKind(err, ErrBucketNotFound))
+	}
+	if err != nil {
+		return FileSystemError.Wrap(err)
+	}
+	return FileSystemError.Wrap(os.RemoveAll(filepath.Join(client.root, ".meta", bucket)))
+}
+
+// ListBuckets lists all buckets.
+func (client *FileSystem) ListBuckets() ([]string, error) {
+	infos, err := ioutil.ReadDir(client.root)
+	if err != nil {
+		return nil, FileSystemError.Wrap(err)
+	}
+
+	names := []string{}
+	for _, info := range infos {
+		if info.IsDir() && !strings.HasPrefix(info.Name(), ".") {
+			names = append(names, info.Name())
+		}
+	}
+	return names, nil
+}
+
+// Upload uploads object data to the specified path.
+func (client *FileSystem) Upload(bucket, objectName string, data []byte) error {
+	return putBytes(client, bucket, objectName, data)
+}
+
+// Put uploads object data from the reader to the specified path.
+//
+// The data is written to a temporary file, which replaces the object when complete.
+func (client *FileSystem) Put(ctx context.Context, bucket, objectName string, data io.Reader, size int64, opts PutOptions) error {
+	objectPath, metaPath, err := client.paths(bucket, objectName)
+	if err != nil {
+		return FileSystemError.Wrap(err)
+	}
+	if _, err := os.Stat(filepath.Join(client.root, bucket)); err != nil {
+		return client.objectError(bucket, err)
+	}
+
+	if err := client.write(objectPath, data); err != nil {
+		return err
+	}
+
+	if opts.ContentType == "" && len(opts.Metadata) == 0 {
+		err := os.Remove(metaPath)
+		if err != nil && !os.IsNotExist(err) {
+			return FileSystemError.Wrap(err)
+		}
+		return nil
+	}
+
+	meta, err := json.Marshal(fsMetadata{ContentType: opts.ContentType, Metadata: opts.Metadata})
+	if err != nil {
+		return FileSystemError.Wrap(err)
+	}
+	return client.write(metaPath, strings.NewReader(string(meta)))
+}
+
+// write atomically replaces the file at target with data.
+func (client *FileSystem) write(target string, data io.Reader) (err error) {
+	file, err := ioutil.TempFile(filepath.Join(client.root, ".uploads"), "upload")
+	if err != nil {
+		return FileSystemError.Wrap(err)
+	}
+	defer func() {
+		if err != nil {
+			err = errs.Combine(err, FileSystemError.Wrap(os.Remove(file.Name())))
+		}
+	}()
+
+	_, err = io.Copy(file, data)
+	if err == nil && client.fsync {
+		err = file.Sync()
+	}
+	err = errs.Combine(err, file.Close())
+	if err != nil {
+		return FileSystemError.Wrap(err)
+	}
+
+	return client.rename(file.Name(), target)
+}
+
+// rename moves source to target, creating the parent directories.
+func (client *FileSystem) rename(source, target string) error {
+	dir := filepath.Dir(target)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return FileSystemError.Wrap(err)
+	}
+	if err := os.Rename(source, target); err != nil {
+		return FileSystemError.Wrap(err)
+	}
+	if client.fsync {
+		return FileSystemError.Wrap(syncDir(dir))
+	}
+	return nil
+}
+
+// syncDir syncs directory entries to the disk.
+func syncDir(dir string) error {
+	file, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	return errs.Combine(file.Sync(), file.Close())
+}
+
+// Download downloads object data.
+func (client *FileSystem) Download(bucket, objectName string, buffer []byte) ([]byte, error) {
+	return getBytes(client, bucket, objectName, buffer)
+}
+
+// DownloadRange downloads length bytes of object data starting at offset.
+func (client *FileSystem) DownloadRange(bucket, objectName string, offset, length int64, buffer []byte) ([]byte, error) {
+	return getRangeBytes(client, bucket, objectName, offset, length, buffer)
+}
+
+// Get returns a reader for the object data.
+func (client *FileSystem) Get(ctx context.Context, bucket, objectName string) (io.ReadCloser, ObjectInfo, error) {
+	return client.GetRange(ctx, bucket, objectName, 0, -1)
+}
+
+// GetRange returns a reader for length bytes of object data starting at offset,
+// a negative length reads until the end.
+func (client *FileSystem) GetRange(ctx context.Context, bucket, objectName string, offset, length int64) (io.ReadCloser, ObjectInfo, error) {
+	info, err := client.Stat(ctx, bucket, objectName)
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+
+	objectPath, _, err := client.paths(bucket, objectName)
+	if err != nil {
+		return nil, ObjectInfo{}, FileSystemError.Wrap(err)
+	}
+	file, err := os.Open(objectPath)
+	if err != nil {
+		return nil, ObjectInfo{}, client.objectError(bucket, err)
+	}
+
+	if offset > 0 {
+		if _, err := file.Seek(offset, io.SeekStart); err != nil {
+			return nil, ObjectInfo{}, FileSystemError.Wrap(errs.Combine(err, file.Close()))
+		}
+	}
+	if length < 0 || offset+length > info.Size {
+		length = info.Size - offset
+	}
+	if offset > 0 || length < info.Size {
+		info.Size = length
+	}
+
+	return &classReader{
+		ReadCloser: &limitedFile{Reader: io.LimitReader(file, length), Closer: file},
+		class:      &FileSystemError,
+	}, info, nil
+}
+
+// limitedFile reads a part of a file.
+type limitedFile struct {
+	io.Reader
+	io.Closer
+}
+
+// Stat returns information about the object.
+//
+// The ETag is derived from the modification time and size.
+func (client *FileSystem) Stat(ctx context.Context, bucket, objectName string) (ObjectInfo, error) {
+	objectPath, metaPath, err := client.paths(bucket, objectName)
+	if err != nil {
+		return ObjectInfo{}, FileSystemError.Wrap(err)
+	}
+
+	stat, err := os.Stat(objectPath)
+	if err != nil {
+		return ObjectInfo{}, client.objectError(bucket, err)
+	}
+	if stat.IsDir() {
+		return ObjectInfo{}, client.objectError(bucket, os.ErrNotExist)
+	}
+
+	info := ObjectInfo{
+		Key:          objectName,
+		Size:         stat.Size(),
+		ETag:         strconv.FormatInt(stat.ModTime().UnixNano(), 16) + "-" + strconv.FormatInt(stat.Size(), 16),
+		ContentType:  DefaultContentType,
+		LastModified: stat.ModTime(),
+		Metadata:     map[string]string{},
+	}
+
+	data, err := ioutil.ReadFile(metaPath)
+	if os.IsNotExist(err) {
+		return info, nil
+	}
+	if err != nil {
+		return ObjectInfo{}, FileSystemError.Wrap(err)
+	}
+
+	var meta fsMetadata
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return ObjectInfo{}, FileSystemError.Wrap(err)
+	}
+	if meta.ContentType != "" {
+		info.ContentType = meta.ContentType
+	}
+	for key, value := range meta.Metadata {
+		info.Metadata[key] = value
+	}
+	return info, nil
+}
+
+// Copy copies an object.
+func (client *FileSystem) Copy(ctx context.Context, srcBucket, srcKey, dstBucket, dstKey string) (err error) {
+	srcPath, srcMeta, err := client.paths(srcBucket, srcKey)
+	if err != nil {
+		return FileSystemError.Wrap(err)
+	}
+	dstPath, dstMeta, err := client.paths(dstBucket, dstKey)
+	if err != nil {
+		return FileSystemError.Wrap(err)
+	}
+	if _, err := os.Stat(filepath.Join(client.root, dstBucket)); err != nil {
+		return client.objectError(dstBucket, err)
+	}
+
+	for _, pair := range []struct{ source, target string }{
+		{srcPath, dstPath},
+		{srcMeta, dstMeta},
+	} {
+		source, err := os.Open(pair.source)
+		if os.IsNotExist(err) && pair.source == srcMeta {
+			err = os.Remove(dstMeta)
+			if err != nil && !os.IsNotExist(err) {
+				return FileSystemError.Wrap(err)
+			}
+			return nil
+		}
+		if err != nil {
+			return client.objectError(srcBucket, err)
+		}
+		err = errs.Combine(client.write(pair.target, source), FileSystemError.Wrap(source.Close()))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Move moves an object.
+func (client *FileSystem) Move(ctx context.Context, srcBucket, srcKey, dstBucket, dstKey string) error {
+	srcPath, srcMeta, err := client.paths(srcBucket, srcKey)
+	if err != nil {
+		return FileSystemError.Wrap(err)
+	}
+	dstPath, dstMeta, err := client.paths(dstBucket, dstKey)
+	if err != nil {
+		return FileSystemError.Wrap(err)
+	}
+	if _, err := os.Stat(srcPath); err != nil {
+		return client.objectError(srcBucket, err)
+	}
+	if _, err := os.Stat(filepath.Join(client.root, dstBucket)); err != nil {
+		return client.objectError(dstBucket, err)
+	}
+
+	if err := client.rename(srcPath, dstPath); err != nil {
+		return err
+	}
+	client.removeEmptyDirs(srcBucket, filepath.Dir(srcPath))
+
+	err = os.Remove(dstMeta)
+	if err != nil && !os.IsNotExist(err) {
+		return FileSystemError.Wrap(err)
+	}
+	if _, err := os.Stat(srcMeta); err == nil {
+		return client.rename(srcMeta, dstMeta)
+	}
+	return nil
+}
+
+// Delete deletes object.
+func (client *FileSystem) Delete(bucket, objectName string) error {
+	objectPath, metaPath, err := client.paths(bucket, objectName)
+	if err != nil {
+		return FileSystemError.Wrap(err)
+	}
+	if err := os.Remove(objectPath); err != nil {
+		return client.objectError(bucket, err)
+	}
+	client.removeEmptyDirs(bucket, filepath.Dir(objectPath))
+
+	err = os.Remove(metaPath)
+	if err != nil && !os.IsNotExist(err) {
+		return FileSystemError.Wrap(err)
+	}
+	return nil
+}
+
+// removeEmptyDirs removes dir and its parents inside the bucket while they are empty,
+// the same way prefixes disappear with the objects.
+func (client *FileSystem) removeEmptyDirs(bucket, dir string) {
+	bucketDir := filepath.Join(client.root, bucket)
+	for dir != bucketDir && strings.HasPrefix(dir, bucketDir) {
+		if os.Remove(dir) != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+// ListObjects lists a single page of objects and prefixes.
+//
+// The continuation token is the last returned key.
+func (client *FileSystem) ListObjects(ctx context.Context, bucket string, opts ListOptions) (ListPage, error) {
+	bucketDir, err := client.bucketPath(bucket)
+	if err != nil {
+		return ListPage{}, FileSystemError.Wrap(err)
+	}
+	if _, err := os.Stat(bucketDir); err != nil {
+		return ListPage{}, client.objectError(bucket, err)
+	}
+
+	directory := opts.Prefix[:strings.LastIndex(opts.Prefix, "/")+1]
+	start := filepath.Join(bucketDir, filepath.FromSlash(directory))
+
+	var entries []ListEntry
+	err = filepath.Walk(start, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if name == start {
+			return nil
+		}
+
+		relative, err := filepath.Rel(bucketDir, name)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(relative)
+
+		if info.IsDir() {
+			if !strings.HasPrefix(key+"/", opts.Prefix) && !strings.HasPrefix(opts.Prefix, key+"/") {
+				return filepath.SkipDir
+			}
+			if !opts.Recursive {
+				if strings.HasPrefix(key+"/", opts.Prefix) {
+					entries = append(entries, ListEntry{Key: key + "/", IsPrefix: true})
+				}
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if strings.HasPrefix(key, opts.Prefix) {
+			entries = append(entries, ListEntry{
+				Key:          key,
+				Size:         info.Size(),
+				LastModified: info.ModTime(),
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return ListPage{}, FileSystemError.Wrap(err)
+	}
+
+	sort.Slice(entries, func(i, k int) bool { return entries[i].Key < entries[k].Key })
+
+	if opts.ContinuationToken != "" {
+		first := sort.Search(len(entries), func(i int) bool { return entries[i].Key > opts.ContinuationToken })
+		entries = entries[first:]
+	}
+
+	page := ListPage{Entries: entries}
+	if opts.MaxKeys > 0 && len(entries) > opts.MaxKeys {
+		page.Entries = entries[:opts.MaxKeys]
+		page.NextContinuationToken = page.Entries[len(page.Entries)-1].Key
+	}
+	return page, nil
+}
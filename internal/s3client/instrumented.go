@@ -0,0 +1,366 @@
+// Copyright (C) 2021 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package s3client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/loov/hrtime"
+	"github.com/zeebo/errs"
+)
+
+// Operation is a record of a single client call.
+type Operation struct {
+	Backend string
+	Op      string
+	Bucket  string
+	Key     string
+	// Bytes is the number of bytes of object data uploaded or downloaded.
+	Bytes int64
+
+	Start time.Time
+	End   time.Time
+	// Duration is measured with a high resolution timer.
+	Duration time.Duration
+	// FirstByte and LastByte are the times from the start until the first
+	// and the last byte of object data were read. They are only set for Get
+	// and GetRange and are zero when no data was read.
+	FirstByte time.Duration
+	LastByte  time.Duration
+
+	Err error
+	// ErrClass is the result of ErrorClass(Err).
+	ErrClass string
+}
+
+// Recorder receives operations of instrumented clients.
+//
+// Record is called concurrently when the client is used concurrently.
+type Recorder interface {
+	Record(op Operation)
+}
+
+// MemoryRecorder collects operations in memory.
+type MemoryRecorder struct {
+	mu         sync.Mutex
+	operations []Operation
+}
+
+// Record adds the operation.
+func (recorder *MemoryRecorder) Record(op Operation) {
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	recorder.operations = append(recorder.operations, op)
+}
+
+// Take returns the operations recorded since the previous call.
+func (recorder *MemoryRecorder) Take() []Operation {
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	operations := recorder.operations
+	recorder.operations = nil
+	return operations
+}
+
+// errorClasses are the error classes reported by ErrorClass.
+var errorClasses = []*errs.Class{
+	&MinioError, &AWSCLIError, &AWSSDKError, &UplinkError, &UplinkLibError, &CommandError, &FileSystemError, &MultipartError,
+}
+
+// ErrorClass returns a short name describing the kind of err, such as
+// "object-not-found", or the name of the backend that failed.
+func ErrorClass(err error) string {
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, ErrUnsupported):
+		return "unsupported"
+	case errors.Is(err, ErrInjected):
+		return "injected"
+	}
+	for _, kind := range errorKinds {
+		if errors.Is(err, kind.err) {
+			return kind.name
+		}
+	}
+	for _, class := range errorClasses {
+		if class.Has(err) {
+			return strings.TrimSuffix(string(*class), " error")
+		}
+	}
+	return "error"
+}
+
+// Instrumented is a Client that records every call to a Recorder.
+//
+// Get and GetRange are recorded when the returned reader is closed,
+// including the time spent reading.
+type Instrumented struct {
+	client   Client
+	backend  string
+	recorder Recorder
+}
+
+var _ Client = (*Instrumented)(nil)
+var _ MultipartUploader = (*Instrumented)(nil)
+var _ Mover = (*Instrumented)(nil)
+
+// NewInstrumented wraps client to record its calls as done by backend.
+func NewInstrumented(client Client, backend string, recorder Recorder) *Instrumented {
+	return &Instrumented{
+		client:   client,
+		backend:  backend,
+		recorder: recorder,
+	}
+}
+
+// span is an operation in progress.
+type span struct {
+	client *Instrumented
+	op     Operation
+	start  time.Duration
+}
+
+func (client *Instrumented) start(op, bucket, key string) *span {
+	return &span{
+		client: client,
+		op: Operation{
+			Backend: client.backend,
+			Op:      op,
+			Bucket:  bucket,
+			Key:     key,
+			Start:   time.Now(),
+		},
+		start: hrtime.Now(),
+	}
+}
+
+// finish records the operation and returns err.
+func (span *span) finish(bytes int64, err error) error {
+	span.op.Duration = hrtime.Since(span.start)
+	span.op.End = span.op.Start.Add(span.op.Duration)
+	span.op.Bytes = bytes
+	span.op.Err = err
+	span.op.ErrClass = ErrorClass(err)
+	span.client.recorder.Record(span.op)
+	return err
+}
+
+// MakeBucket makes a new bucket.
+func (client *Instrumented) MakeBucket(bucket, location string) error {
+	span := client.start("MakeBucket", bucket, "")
+	return span.finish(0, client.client.MakeBucket(bucket, location))
+}
+
+// RemoveBucket removes a bucket.
+func (client *Instrumented) RemoveBucket(bucket string) error {
+	span := client.start("RemoveBucket", bucket, "")
+	return span.finish(0, client.client.RemoveBucket(bucket))
+}
+
+// ListBuckets lists all buckets.
+func (client *Instrumented) ListBuckets() ([]string, error) {
+	span := client.start("ListBuckets", "", "")
+	names, err := client.client.ListBuckets()
+	return names, span.finish(0, err)
+}
+
+// Upload uploads object data to the specified path.
+func (client *Instrumented) Upload(bucket, objectName string, data []byte) error {
+	span := client.start("Upload", bucket, objectName)
+	return span.finish(int64(len(data)), client.client.Upload(bucket, objectName, data))
+}
+
+// Download downloads object data.
+func (client *Instrumented) Download(bucket, objectName string, buffer []byte) ([]byte, error) {
+	span := client.start("Download", bucket, objectName)
+	data, err := client.client.Download(bucket, objectName, buffer)
+	return data, span.finish(int64(len(data)), err)
+}
+
+// DownloadRange downloads length bytes of object data starting at offset.
+func (client *Instrumented) DownloadRange(bucket, objectName string, offset, length int64, buffer []byte) ([]byte, error) {
+	span := client.start("DownloadRange", bucket, objectName)
+	data, err := client.client.DownloadRange(bucket, objectName, offset, length, buffer)
+	return data, span.finish(int64(len(data)), err)
+}
+
+// Delete deletes object.
+func (client *Instrumented) Delete(bucket, objectName string) error {
+	span := client.start("Delete", bucket, objectName)
+	return span.finish(0, client.client.Delete(bucket, objectName))
+}
+
+// ListObjects lists a single page of objects and prefixes.
+func (client *Instrumented) ListObjects(ctx context.Context, bucket string, opts ListOptions) (ListPage, error) {
+	span := client.start("ListObjects", bucket, opts.Prefix)
+	page, err := client.client.ListObjects(ctx, bucket, opts)
+	return page, span.finish(0, err)
+}
+
+// Put uploads object data from the reader to the specified path.
+//
+// When size is -1, the bytes are counted while reading.
+func (client *Instrumented) Put(ctx context.Context, bucket, objectName string, data io.Reader, size int64, opts PutOptions) error {
+	span := client.start("Put", bucket, objectName)
+	if size >= 0 {
+		return span.finish(size, client.client.Put(ctx, bucket, objectName, data, size, opts))
+	}
+
+	// counting hides io.Seeker, hence it's only used when necessary
+	counter := &countingReader{reader: data}
+	err := client.client.Put(ctx, bucket, objectName, counter, size, opts)
+	return span.finish(counter.n, err)
+}
+
+// Get returns a reader for the object data.
+func (client *Instrumented) Get(ctx context.Context, bucket, objectName string) (io.ReadCloser, ObjectInfo, error) {
+	span := client.start("Get", bucket, objectName)
+	reader, info, err := client.client.Get(ctx, bucket, objectName)
+	if err != nil {
+		return nil, info, span.finish(0, err)
+	}
+	return &spanReader{reader: reader, span: span}, info, nil
+}
+
+// GetRange returns a reader for length bytes of object data starting at offset.
+func (client *Instrumented) GetRange(ctx context.Context, bucket, objectName string, offset, length int64) (io.ReadCloser, ObjectInfo, error) {
+	span := client.start("GetRange", bucket, objectName)
+	reader, info, err := client.client.GetRange(ctx, bucket, objectName, offset, length)
+	if err != nil {
+		return nil, info, span.finish(0, err)
+	}
+	return &spanReader{reader: reader, span: span}, info, nil
+}
+
+// Stat returns information about the object.
+func (client *Instrumented) Stat(ctx context.Context, bucket, objectName string) (ObjectInfo, error) {
+	span := client.start("Stat", bucket, objectName)
+	info, err := client.client.Stat(ctx, bucket, objectName)
+	return info, span.finish(0, err)
+}
+
+// Copy copies an object.
+func (client *Instrumented) Copy(ctx context.Context, srcBucket, srcKey, dstBucket, dstKey string) error {
+	span := client.start("Copy", dstBucket, dstKey)
+	return span.finish(0, client.client.Copy(ctx, srcBucket, srcKey, dstBucket, dstKey))
+}
+
+// Move moves an object.
+func (client *Instrumented) Move(ctx context.Context, srcBucket, srcKey, dstBucket, dstKey string) error {
+	span := client.start("Move", dstBucket, dstKey)
+	mover, ok := client.client.(Mover)
+	if !ok {
+		return span.finish(0, ErrUnsupported)
+	}
+	return span.finish(0, mover.Move(ctx, srcBucket, srcKey, dstBucket, dstKey))
+}
+
+// InitiateMultipart starts a new multipart upload.
+func (client *Instrumented) InitiateMultipart(ctx context.Context, bucket, objectName string) (string, error) {
+	span := client.start("InitiateMultipart", bucket, objectName)
+	uploader, ok := client.client.(MultipartUploader)
+	if !ok {
+		return "", span.finish(0, ErrUnsupported)
+	}
+	uploadID, err := uploader.InitiateMultipart(ctx, bucket, objectName)
+	return uploadID, span.finish(0, err)
+}
+
+// UploadPart uploads a single part of a multipart upload.
+func (client *Instrumented) UploadPart(ctx context.Context, bucket, objectName, uploadID string, partNumber int, data io.Reader, size int64) (Part, error) {
+	span := client.start("UploadPart", bucket, objectName)
+	uploader, ok := client.client.(MultipartUploader)
+	if !ok {
+		return Part{}, span.finish(0, ErrUnsupported)
+	}
+	part, err := uploader.UploadPart(ctx, bucket, objectName, uploadID, partNumber, data, size)
+	return part, span.finish(size, err)
+}
+
+// CompleteMultipart finishes a multipart upload.
+func (client *Instrumented) CompleteMultipart(ctx context.Context, bucket, objectName, uploadID string, parts []Part) error {
+	span := client.start("CompleteMultipart", bucket, objectName)
+	uploader, ok := client.client.(MultipartUploader)
+	if !ok {
+		return span.finish(0, ErrUnsupported)
+	}
+	return span.finish(0, uploader.CompleteMultipart(ctx, bucket, objectName, uploadID, parts))
+}
+
+// AbortMultipart aborts a multipart upload.
+func (client *Instrumented) AbortMultipart(ctx context.Context, bucket, objectName, uploadID string) error {
+	span := client.start("AbortMultipart", bucket, objectName)
+	uploader, ok := client.client.(MultipartUploader)
+	if !ok {
+		return span.finish(0, ErrUnsupported)
+	}
+	return span.finish(0, uploader.AbortMultipart(ctx, bucket, objectName, uploadID))
+}
+
+// Close closes the wrapped client when it implements io.Closer.
+func (client *Instrumented) Close() error {
+	if closer, ok := client.client.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// countingReader counts the bytes read.
+type countingReader struct {
+	reader io.Reader
+	n      int64
+}
+
+// Read reads from the underlying reader.
+func (counter *countingReader) Read(p []byte) (int, error) {
+	n, err := counter.reader.Read(p)
+	counter.n += int64(n)
+	return n, err
+}
+
+// spanReader finishes the span of Get or GetRange when closed.
+type spanReader struct {
+	reader io.ReadCloser
+	span   *span
+	n      int64
+	err    error
+}
+
+// Read reads from the underlying reader, remembers the first read error
+// and times the first and last byte.
+func (reader *spanReader) Read(p []byte) (int, error) {
+	n, err := reader.reader.Read(p)
+	reader.n += int64(n)
+	if n > 0 && reader.span != nil {
+		elapsed := hrtime.Since(reader.span.start)
+		if reader.span.op.FirstByte == 0 {
+			reader.span.op.FirstByte = elapsed
+		}
+		reader.span.op.LastByte = elapsed
+	}
+	if err != nil && !errors.Is(err, io.EOF) && reader.err == nil {
+		reader.err = err
+	}
+	return n, err
+}
+
+// Close closes the underlying reader and records the operation.
+func (reader *spanReader) Close() error {
+	err := reader.reader.Close()
+	if reader.span != nil {
+		_ = reader.span.finish(reader.n, errs.Combine(reader.err, err))
+		reader.span = nil
+	}
+	return err
+}
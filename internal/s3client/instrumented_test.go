@@ -0,0 +1,81 @@
+// Copyright (C) 2021 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package s3client_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"storj.io/benchmark/internal/s3client"
+)
+
+func TestInstrumented(t *testing.T) {
+	minio, cleanup := newTestClient(t, "", s3client.NewMinio)
+	defer cleanup()
+
+	ctx := context.Background()
+	recorder := &s3client.MemoryRecorder{}
+	client := s3client.NewInstrumented(minio, "minio", recorder)
+
+	if err := client.MakeBucket("bucket", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Put(ctx, "bucket", "object", strings.NewReader("data"), -1, s3client.PutOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	reader, _, err := client.Get(ctx, "bucket", "object")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ioutil.ReadAll(reader); err != nil {
+		t.Fatal(err)
+	}
+	if err := reader.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Stat(ctx, "bucket", "missing"); err == nil {
+		t.Fatal("expected an error for a missing object")
+	}
+	if err := client.Move(ctx, "bucket", "object", "bucket", "moved"); !errors.Is(err, s3client.ErrUnsupported) {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	ops := recorder.Take()
+	expected := []struct {
+		op       string
+		key      string
+		bytes    int64
+		errClass string
+	}{
+		{"MakeBucket", "", 0, ""},
+		{"Put", "object", 4, ""},
+		{"Get", "object", 4, ""},
+		{"Stat", "missing", 0, "object-not-found"},
+		{"Move", "moved", 0, "unsupported"},
+	}
+	if len(ops) != len(expected) {
+		t.Fatalf("recorded %d operations, expected %d", len(ops), len(expected))
+	}
+	for i, exp := range expected {
+		op := ops[i]
+		if op.Backend != "minio" || op.Bucket != "bucket" || op.Op != exp.op || op.Key != exp.key ||
+			op.Bytes != exp.bytes || op.ErrClass != exp.errClass {
+			t.Errorf("unexpected operation %d: %+v", i, op)
+		}
+		if op.Duration <= 0 || op.End.Before(op.Start) {
+			t.Errorf("unexpected timing of %s: %+v", op.Op, op)
+		}
+		if streamed := op.Op == "Get"; streamed != (op.FirstByte > 0) ||
+			op.LastByte < op.FirstByte || op.LastByte > op.Duration {
+			t.Errorf("unexpected first and last byte of %s: %+v", op.Op, op)
+		}
+	}
+
+	if ops := recorder.Take(); len(ops) != 0 {
+		t.Fatalf("operations were not cleared: %+v", ops)
+	}
+}
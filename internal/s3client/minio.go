@@ -7,12 +7,12 @@
 package s3client
 
 import (
-	"bytes"
-	"errors"
+	"context"
 	"io"
-	"io/ioutil"
+	"net/http"
 
 	minio "github.com/minio/minio-go"
+	"github.com/minio/minio-go/pkg/credentials"
 	"github.com/zeebo/errs"
 )
 
@@ -24,12 +24,58 @@ type Minio struct {
 	api *minio.Client
 }
 
+func init() { Register("minio", NewMinio) }
+
 // NewMinio creates new Client.
+//
+// The "region" option avoids looking up bucket regions and "lookup" sets
+// the bucket lookup style to "auto", "dns" or "path". They default to
+// conf.Region and conf.Addressing.
 func NewMinio(conf Config) (Client, error) {
-	api, err := minio.New(conf.S3Gateway, conf.AccessKey, conf.SecretKey, !conf.NoSSL)
+	if err := conf.checkAddressing(); err != nil {
+		return nil, minioError(err)
+	}
+	defaultLookup := map[string]string{
+		AddressingAuto:    "auto",
+		AddressingPath:    "path",
+		AddressingVirtual: "dns",
+	}[conf.Addressing]
+
+	opts := ParseOptions(conf.Options)
+	region := opts.String("region", conf.Region)
+	lookup := opts.String("lookup", defaultLookup)
+	if err := opts.Err(); err != nil {
+		return nil, minioError(err)
+	}
+
+	lookupTypes := map[string]minio.BucketLookupType{
+		"auto": minio.BucketLookupAuto,
+		"dns":  minio.BucketLookupDNS,
+		"path": minio.BucketLookupPath,
+	}
+	lookupType, ok := lookupTypes[lookup]
+	if !ok {
+		return nil, MinioError.New("invalid bucket lookup %q", lookup)
+	}
+
+	api, err := minio.NewWithOptions(conf.Host(), &minio.Options{
+		Creds:        credentials.NewStaticV4(conf.AccessKey, conf.SecretKey, ""),
+		Secure:       conf.Secure(),
+		Region:       region,
+		BucketLookup: lookupType,
+	})
 	if err != nil {
-		return nil, MinioError.Wrap(err)
+		return nil, minioError(err)
 	}
+
+	transport, err := conf.HTTPTransport(minio.DefaultTransport.(*http.Transport))
+	if err != nil {
+		return nil, minioError(err)
+	}
+	if transport != nil {
+		api.SetCustomTransport(transport)
+	}
+
 	return &Minio{api}, nil
 }
 
@@ -37,7 +83,7 @@ func NewMinio(conf Config) (Client, error) {
 func (client *Minio) MakeBucket(bucket, location string) error {
 	err := client.api.MakeBucket(bucket, location)
 	if err != nil {
-		return MinioError.Wrap(err)
+		return minioError(err)
 	}
 	return nil
 }
@@ -46,7 +92,7 @@ func (client *Minio) MakeBucket(bucket, location string) error {
 func (client *Minio) RemoveBucket(bucket string) error {
 	err := client.api.RemoveBucket(bucket)
 	if err != nil {
-		return MinioError.Wrap(err)
+		return minioError(err)
 	}
 	return nil
 }
@@ -55,7 +101,7 @@ func (client *Minio) RemoveBucket(bucket string) error {
 func (client *Minio) ListBuckets() ([]string, error) {
 	buckets, err := client.api.ListBuckets()
 	if err != nil {
-		return nil, MinioError.Wrap(err)
+		return nil, minioError(err)
 	}
 
 	names := []string{}
@@ -67,71 +113,199 @@ func (client *Minio) ListBuckets() ([]string, error) {
 
 // Upload uploads object data to the specified path.
 func (client *Minio) Upload(bucket, objectName string, data []byte) error {
-	_, err := client.api.PutObject(
+	return putBytes(client, bucket, objectName, data)
+}
+
+// Put uploads object data from the reader to the specified path.
+func (client *Minio) Put(ctx context.Context, bucket, objectName string, data io.Reader, size int64, opts PutOptions) error {
+	_, err := client.api.PutObjectWithContext(ctx,
 		bucket, objectName,
-		bytes.NewReader(data), int64(len(data)),
-		minio.PutObjectOptions{ContentType: "application/octet-stream"})
+		data, size,
+		minio.PutObjectOptions{
+			ContentType:  opts.contentType(),
+			UserMetadata: opts.Metadata,
+		})
 	if err != nil {
-		return MinioError.Wrap(err)
+		return minioError(err)
 	}
 	return nil
 }
 
-// UploadMultipart uses multipart uploads, has hardcoded threshold.
-func (client *Minio) UploadMultipart(bucket, objectName string, data []byte, threshold int) error {
-	_, err := client.api.PutObject(
-		bucket, objectName,
-		bytes.NewReader(data), -1,
-		minio.PutObjectOptions{ContentType: "application/octet-stream"})
+// InitiateMultipart starts a new multipart upload.
+//
+// The multipart methods use minio.Core, which doesn't take a context.
+func (client *Minio) InitiateMultipart(ctx context.Context, bucket, objectName string) (string, error) {
+	core := minio.Core{Client: client.api}
+	uploadID, err := core.NewMultipartUpload(bucket, objectName,
+		minio.PutObjectOptions{ContentType: DefaultContentType})
 	if err != nil {
-		return MinioError.Wrap(err)
+		return "", minioError(err)
+	}
+	return uploadID, nil
+}
+
+// UploadPart uploads a single part of a multipart upload.
+func (client *Minio) UploadPart(ctx context.Context, bucket, objectName, uploadID string, partNumber int, data io.Reader, size int64) (Part, error) {
+	core := minio.Core{Client: client.api}
+	part, err := core.PutObjectPart(bucket, objectName, uploadID, partNumber, data, size, "", "", nil)
+	if err != nil {
+		return Part{}, minioError(err)
+	}
+	return Part{
+		Number: part.PartNumber,
+		ETag:   part.ETag,
+		Size:   part.Size,
+	}, nil
+}
+
+// CompleteMultipart finishes a multipart upload.
+func (client *Minio) CompleteMultipart(ctx context.Context, bucket, objectName, uploadID string, parts []Part) error {
+	completed := make([]minio.CompletePart, 0, len(parts))
+	for _, part := range parts {
+		completed = append(completed, minio.CompletePart{
+			PartNumber: part.Number,
+			ETag:       part.ETag,
+		})
+	}
+
+	core := minio.Core{Client: client.api}
+	_, err := core.CompleteMultipartUpload(bucket, objectName, uploadID, completed)
+	if err != nil {
+		return minioError(err)
+	}
+	return nil
+}
+
+// AbortMultipart aborts a multipart upload.
+func (client *Minio) AbortMultipart(ctx context.Context, bucket, objectName, uploadID string) error {
+	core := minio.Core{Client: client.api}
+	err := core.AbortMultipartUpload(bucket, objectName, uploadID)
+	if err != nil {
+		return minioError(err)
 	}
 	return nil
 }
 
 // Download downloads object data.
 func (client *Minio) Download(bucket, objectName string, buffer []byte) ([]byte, error) {
-	reader, err := client.api.GetObject(bucket, objectName, minio.GetObjectOptions{})
+	return getBytes(client, bucket, objectName, buffer)
+}
+
+// DownloadRange downloads length bytes of object data starting at offset.
+func (client *Minio) DownloadRange(bucket, objectName string, offset, length int64, buffer []byte) ([]byte, error) {
+	return getRangeBytes(client, bucket, objectName, offset, length, buffer)
+}
+
+// Get returns a reader for the object data.
+func (client *Minio) Get(ctx context.Context, bucket, objectName string) (io.ReadCloser, ObjectInfo, error) {
+	return client.get(ctx, bucket, objectName, minio.GetObjectOptions{})
+}
+
+// GetRange returns a reader for length bytes of object data starting at offset.
+func (client *Minio) GetRange(ctx context.Context, bucket, objectName string, offset, length int64) (io.ReadCloser, ObjectInfo, error) {
+	opts := minio.GetObjectOptions{}
+	err := opts.SetRange(offset, offset+length-1)
+	if err != nil {
+		return nil, ObjectInfo{}, minioError(err)
+	}
+	return client.get(ctx, bucket, objectName, opts)
+}
+
+// get uses minio.Core, because minio.Object drops the range when its
+// information is requested before reading. minio.Core doesn't take a context.
+func (client *Minio) get(ctx context.Context, bucket, objectName string, opts minio.GetObjectOptions) (io.ReadCloser, ObjectInfo, error) {
+	core := minio.Core{Client: client.api}
+	reader, info, err := core.GetObject(bucket, objectName, opts)
+	if err != nil {
+		return nil, ObjectInfo{}, minioError(err)
+	}
+
+	return &classReader{reader, &MinioError}, minioObjectInfo(info), nil
+}
+
+// Stat returns information about the object.
+func (client *Minio) Stat(ctx context.Context, bucket, objectName string) (ObjectInfo, error) {
+	info, err := client.api.StatObject(bucket, objectName, minio.StatObjectOptions{})
+	if err != nil {
+		return ObjectInfo{}, minioError(err)
+	}
+	return minioObjectInfo(info), nil
+}
+
+// Copy copies an object on the server.
+func (client *Minio) Copy(ctx context.Context, srcBucket, srcKey, dstBucket, dstKey string) error {
+	dst, err := minio.NewDestinationInfo(dstBucket, dstKey, nil, nil)
+	if err != nil {
+		return minioError(err)
+	}
+
+	err = client.api.CopyObject(dst, minio.NewSourceInfo(srcBucket, srcKey, nil))
 	if err != nil {
-		return nil, MinioError.Wrap(err)
+		return minioError(err)
 	}
-	defer func() { _ = reader.Close() }()
+	return nil
+}
 
-	n, err := reader.Read(buffer[:cap(buffer)])
-	if !errors.Is(err, io.EOF) {
-		rest, err := ioutil.ReadAll(reader)
-		if errors.Is(err, io.EOF) {
-			err = nil
-		}
-		if err != nil {
-			return nil, MinioError.Wrap(err)
-		}
-		buffer = append(buffer, rest...)
-		n = len(buffer)
+// minioError wraps err into MinioError and marks its kind.
+func minioError(err error) error {
+	response := minio.ToErrorResponse(err)
+	kind := s3Kind(response.Code, response.StatusCode)
+	if kind == nil {
+		kind = netKind(err)
 	}
+	return MinioError.Wrap(withKind(err, kind))
+}
 
-	buffer = buffer[:n]
-	return buffer, nil
+func minioObjectInfo(info minio.ObjectInfo) ObjectInfo {
+	return ObjectInfo{
+		Key:          info.Key,
+		Size:         info.Size,
+		ETag:         info.ETag,
+		ContentType:  info.ContentType,
+		LastModified: info.LastModified,
+		Metadata:     userMetadata(info.Metadata),
+	}
 }
 
 // Delete deletes object.
 func (client *Minio) Delete(bucket, objectName string) error {
 	err := client.api.RemoveObject(bucket, objectName)
 	if err != nil {
-		return MinioError.Wrap(err)
+		return minioError(err)
 	}
 	return nil
 }
 
-// ListObjects lists objects.
-func (client *Minio) ListObjects(bucket, prefix string) ([]string, error) {
-	doneCh := make(chan struct{})
-	defer close(doneCh)
+// ListObjects lists a single page of objects and prefixes.
+func (client *Minio) ListObjects(ctx context.Context, bucket string, opts ListOptions) (ListPage, error) {
+	delimiter := "/"
+	if opts.Recursive {
+		delimiter = ""
+	}
 
-	names := []string{}
-	for message := range client.api.ListObjects(bucket, prefix, false, doneCh) {
-		names = append(names, message.Key)
+	core := minio.Core{Client: client.api}
+	result, err := core.ListObjectsV2(bucket, opts.Prefix, opts.ContinuationToken, false, delimiter, opts.MaxKeys, "")
+	if err != nil {
+		return ListPage{}, minioError(err)
 	}
 
-	return names, nil
+	page := ListPage{}
+	for _, object := range result.Contents {
+		page.Entries = append(page.Entries, ListEntry{
+			Key:          object.Key,
+			Size:         object.Size,
+			LastModified: object.LastModified,
+		})
+	}
+	for _, prefix := range result.CommonPrefixes {
+		page.Entries = append(page.Entries, ListEntry{
+			Key:      prefix.Prefix,
+			IsPrefix: true,
+		})
+	}
+	if result.IsTruncated {
+		page.NextContinuationToken = result.NextContinuationToken
+	}
+
+	return page, nil
 }
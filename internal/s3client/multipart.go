@@ -0,0 +1,147 @@
+// Copyright (C) 2021 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package s3client
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/zeebo/errs"
+	"golang.org/x/sync/errgroup"
+)
+
+// MultipartError is class for multipart upload errors.
+var MultipartError = errs.Class("multipart error")
+
+// MultipartUploader is implemented by clients that support multipart uploads.
+type MultipartUploader interface {
+	// InitiateMultipart starts a new multipart upload and returns its id.
+	InitiateMultipart(ctx context.Context, bucket, objectName string) (uploadID string, err error)
+	// UploadPart uploads size bytes from data as part partNumber, starting from 1.
+	UploadPart(ctx context.Context, bucket, objectName, uploadID string, partNumber int, data io.Reader, size int64) (Part, error)
+	// CompleteMultipart combines the parts into the final object.
+	CompleteMultipart(ctx context.Context, bucket, objectName, uploadID string, parts []Part) error
+	// AbortMultipart cancels the upload and removes the uploaded parts.
+	AbortMultipart(ctx context.Context, bucket, objectName, uploadID string) error
+}
+
+// Multipart returns client as MultipartUploader. The wrapping clients
+// implement MultipartUploader regardless of the backend, hence support is
+// only detected by the requests failing with ErrUnsupported.
+func Multipart(client Client) MultipartUploader {
+	if uploader, ok := client.(MultipartUploader); ok {
+		return uploader
+	}
+	return unsupportedMultipart{}
+}
+
+// unsupportedMultipart fails the multipart uploads of clients that don't support them.
+type unsupportedMultipart struct{}
+
+func (unsupportedMultipart) InitiateMultipart(ctx context.Context, bucket, objectName string) (string, error) {
+	return "", ErrUnsupported
+}
+
+func (unsupportedMultipart) UploadPart(ctx context.Context, bucket, objectName, uploadID string, partNumber int, data io.Reader, size int64) (Part, error) {
+	return Part{}, ErrUnsupported
+}
+
+func (unsupportedMultipart) CompleteMultipart(ctx context.Context, bucket, objectName, uploadID string, parts []Part) error {
+	return ErrUnsupported
+}
+
+func (unsupportedMultipart) AbortMultipart(ctx context.Context, bucket, objectName, uploadID string) error {
+	return ErrUnsupported
+}
+
+// Part describes an uploaded part of a multipart upload.
+type Part struct {
+	Number int
+	ETag   string
+	Size   int64
+}
+
+// MultipartOptions configures UploadMultipart.
+type MultipartOptions struct {
+	PartSize    int64
+	Concurrency int
+
+	// OnPart is called concurrently after each uploaded part.
+	OnPart func(part Part, duration time.Duration)
+}
+
+// UploadMultipart uploads size bytes from data by uploading opts.Concurrency
+// parts of opts.PartSize in parallel. The upload is aborted on failure.
+func UploadMultipart(ctx context.Context, uploader MultipartUploader, bucket, objectName string, data io.ReaderAt, size int64, opts MultipartOptions) (err error) {
+	if opts.PartSize <= 0 {
+		return MultipartError.New("invalid part size %d", opts.PartSize)
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 1
+	}
+
+	uploadID, err := uploader.InitiateMultipart(ctx, bucket, objectName)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			err = errs.Combine(err, uploader.AbortMultipart(context.Background(), bucket, objectName, uploadID))
+		}
+	}()
+
+	partCount := int((size + opts.PartSize - 1) / opts.PartSize)
+	if partCount == 0 {
+		// an empty object still needs a single part
+		partCount = 1
+	}
+
+	parts := make([]Part, partCount)
+	next := make(chan int)
+
+	group, groupCtx := errgroup.WithContext(ctx)
+	group.Go(func() error {
+		defer close(next)
+		for index := range parts {
+			select {
+			case next <- index:
+			case <-groupCtx.Done():
+				return groupCtx.Err()
+			}
+		}
+		return nil
+	})
+
+	for worker := 0; worker < opts.Concurrency; worker++ {
+		group.Go(func() error {
+			for index := range next {
+				offset := int64(index) * opts.PartSize
+				partSize := opts.PartSize
+				if offset+partSize > size {
+					partSize = size - offset
+				}
+
+				start := time.Now()
+				part, err := uploader.UploadPart(groupCtx, bucket, objectName, uploadID,
+					index+1, io.NewSectionReader(data, offset, partSize), partSize)
+				if err != nil {
+					return err
+				}
+				if opts.OnPart != nil {
+					opts.OnPart(part, time.Since(start))
+				}
+
+				parts[index] = part
+			}
+			return nil
+		})
+	}
+
+	if err := group.Wait(); err != nil {
+		return err
+	}
+
+	return uploader.CompleteMultipart(ctx, bucket, objectName, uploadID, parts)
+}
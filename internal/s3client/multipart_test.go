@@ -0,0 +1,76 @@
+// Copyright (C) 2021 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package s3client_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"storj.io/benchmark/internal/s3client"
+)
+
+func TestUploadMultipartCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	uploader := &cancelingUploader{cancel: cancel}
+	data := make([]byte, 100)
+	err := s3client.UploadMultipart(ctx, uploader, "bucket", "object", bytes.NewReader(data), int64(len(data)), s3client.MultipartOptions{
+		PartSize:    1,
+		Concurrency: 1,
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the upload to be canceled, got %v", err)
+	}
+	if uploader.completed || !uploader.aborted {
+		t.Fatalf("expected the upload to be aborted, got %+v", uploader)
+	}
+}
+
+func TestUploadMultipartUnsupported(t *testing.T) {
+	client, cleanup := newTestClient(t, "bucket", s3client.NewMinio)
+	defer cleanup()
+
+	// embedding the interface hides the multipart methods of the client
+	plain := struct{ s3client.Client }{client}
+	for _, client := range []s3client.Client{plain, s3client.NewInstrumented(plain, "", &s3client.MemoryRecorder{})} {
+		data := make([]byte, 100)
+		err := s3client.UploadMultipart(context.Background(), s3client.Multipart(client), "bucket", "object", bytes.NewReader(data), int64(len(data)), s3client.MultipartOptions{
+			PartSize: 10,
+		})
+		if !errors.Is(err, s3client.ErrUnsupported) {
+			t.Fatalf("%T: expected %v, got %v", client, s3client.ErrUnsupported, err)
+		}
+	}
+}
+
+// cancelingUploader cancels the upload context when a part is uploaded,
+// but doesn't fail the part itself.
+type cancelingUploader struct {
+	cancel    func()
+	completed bool
+	aborted   bool
+}
+
+func (uploader *cancelingUploader) InitiateMultipart(ctx context.Context, bucket, objectName string) (string, error) {
+	return "upload", nil
+}
+
+func (uploader *cancelingUploader) UploadPart(ctx context.Context, bucket, objectName, uploadID string, partNumber int, data io.Reader, size int64) (s3client.Part, error) {
+	uploader.cancel()
+	return s3client.Part{Number: partNumber, Size: size}, nil
+}
+
+func (uploader *cancelingUploader) CompleteMultipart(ctx context.Context, bucket, objectName, uploadID string, parts []s3client.Part) error {
+	uploader.completed = true
+	return nil
+}
+
+func (uploader *cancelingUploader) AbortMultipart(ctx context.Context, bucket, objectName, uploadID string) error {
+	uploader.aborted = true
+	return nil
+}
@@ -0,0 +1,199 @@
+// Copyright (C) 2021 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package s3client
+
+import (
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// RequestTiming contains the phases of a single HTTP request.
+type RequestTiming struct {
+	Method string
+	Start  time.Time
+	End    time.Time
+
+	// DNS, Connect and TLS are zero when the request reuses a connection.
+	DNS     time.Duration
+	Connect time.Duration
+	TLS     time.Duration
+	// Write is the time from getting a connection until the request,
+	// including the body, is written.
+	Write time.Duration
+	// FirstByte is the time from writing the request until the first
+	// response byte, i.e. the processing time of the gateway.
+	FirstByte time.Duration
+	// Transfer is the time from the first response byte until the
+	// response body is read.
+	Transfer time.Duration
+}
+
+// Phases are the summed phases of the HTTP requests of an operation.
+type Phases struct {
+	Requests  int
+	DNS       time.Duration
+	Connect   time.Duration
+	TLS       time.Duration
+	Write     time.Duration
+	FirstByte time.Duration
+	Transfer  time.Duration
+}
+
+// PhasesBetween sums the phases of the requests that started between start and end.
+func PhasesBetween(timings []RequestTiming, start, end time.Time) Phases {
+	var phases Phases
+	for _, timing := range timings {
+		if timing.Start.Before(start) || timing.Start.After(end) {
+			continue
+		}
+		phases.Requests++
+		phases.DNS += timing.DNS
+		phases.Connect += timing.Connect
+		phases.TLS += timing.TLS
+		phases.Write += timing.Write
+		phases.FirstByte += timing.FirstByte
+		phases.Transfer += timing.Transfer
+	}
+	return phases
+}
+
+// RequestTimings collects the timings of HTTP requests.
+type RequestTimings struct {
+	mu       sync.Mutex
+	disabled bool
+	timings  []RequestTiming
+}
+
+// SetEnabled starts or stops collecting timings, they are collected by default.
+// It does nothing for a nil collector.
+func (timings *RequestTimings) SetEnabled(enabled bool) {
+	if timings == nil {
+		return
+	}
+	timings.mu.Lock()
+	defer timings.mu.Unlock()
+	timings.disabled = !enabled
+}
+
+// Record adds the timing of a request unless collecting is disabled.
+func (timings *RequestTimings) Record(timing RequestTiming) {
+	timings.mu.Lock()
+	defer timings.mu.Unlock()
+	if timings.disabled {
+		return
+	}
+	timings.timings = append(timings.timings, timing)
+}
+
+// Take returns the timings recorded since the previous call.
+// It returns nil for a nil collector.
+func (timings *RequestTimings) Take() []RequestTiming {
+	if timings == nil {
+		return nil
+	}
+	timings.mu.Lock()
+	defer timings.mu.Unlock()
+	taken := timings.timings
+	timings.timings = nil
+	return taken
+}
+
+// requestTrace measures the phases of a request.
+type requestTrace struct {
+	mu     sync.Mutex
+	timing RequestTiming
+	done   bool
+
+	dnsStart     time.Time
+	connectStart time.Time
+	tlsStart     time.Time
+	gotConn      time.Time
+	wrote        time.Time
+	firstByte    time.Time
+}
+
+// clientTrace returns the hooks for net/http/httptrace.
+func (trace *requestTrace) clientTrace() *httptrace.ClientTrace {
+	at := func(t *time.Time) {
+		trace.mu.Lock()
+		*t = time.Now()
+		trace.mu.Unlock()
+	}
+	since := func(d *time.Duration, start *time.Time) {
+		trace.mu.Lock()
+		*d += time.Since(*start)
+		trace.mu.Unlock()
+	}
+
+	return &httptrace.ClientTrace{
+		DNSStart:          func(httptrace.DNSStartInfo) { at(&trace.dnsStart) },
+		DNSDone:           func(httptrace.DNSDoneInfo) { since(&trace.timing.DNS, &trace.dnsStart) },
+		ConnectStart:      func(string, string) { at(&trace.connectStart) },
+		ConnectDone:       func(string, string, error) { since(&trace.timing.Connect, &trace.connectStart) },
+		TLSHandshakeStart: func() { at(&trace.tlsStart) },
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			since(&trace.timing.TLS, &trace.tlsStart)
+		},
+		GotConn:              func(httptrace.GotConnInfo) { at(&trace.gotConn) },
+		WroteRequest:         func(httptrace.WroteRequestInfo) { at(&trace.wrote) },
+		GotFirstResponseByte: func() { at(&trace.firstByte) },
+	}
+}
+
+// finish computes the remaining phases and records the timing once.
+func (trace *requestTrace) finish(timings *RequestTimings) {
+	trace.mu.Lock()
+	if trace.done {
+		trace.mu.Unlock()
+		return
+	}
+	trace.done = true
+
+	timing := trace.timing
+	timing.End = time.Now()
+	if !trace.gotConn.IsZero() && !trace.wrote.IsZero() {
+		timing.Write = trace.wrote.Sub(trace.gotConn)
+	}
+	if !trace.wrote.IsZero() && !trace.firstByte.IsZero() {
+		timing.FirstByte = trace.firstByte.Sub(trace.wrote)
+	}
+	if !trace.firstByte.IsZero() {
+		timing.Transfer = timing.End.Sub(trace.firstByte)
+	}
+	trace.mu.Unlock()
+
+	timings.Record(timing)
+}
+
+// traceRequest starts tracing req.
+func traceRequest(req *http.Request, trace *httptrace.ClientTrace) *http.Request {
+	return req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+}
+
+// timedBody finishes the trace when the response body has been read or closed.
+type timedBody struct {
+	body    io.ReadCloser
+	trace   *requestTrace
+	timings *RequestTimings
+}
+
+// Read reads from the response body.
+func (body *timedBody) Read(p []byte) (int, error) {
+	n, err := body.body.Read(p)
+	if err != nil {
+		body.trace.finish(body.timings)
+	}
+	return n, err
+}
+
+// Close closes the response body.
+func (body *timedBody) Close() error {
+	err := body.body.Close()
+	body.trace.finish(body.timings)
+	return err
+}
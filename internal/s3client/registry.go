@@ -0,0 +1,135 @@
+// Copyright (C) 2021 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package s3client
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/zeebo/errs"
+)
+
+// Constructor creates a new client.
+//
+// Constructors should parse conf.Options with ParseOptions and return an
+// error for the options they don't recognize.
+type Constructor func(conf Config) (Client, error)
+
+var registry struct {
+	mu           sync.Mutex
+	constructors map[string]Constructor
+}
+
+// Register makes a client available by the provided name.
+// It panics when the name is already registered.
+func Register(name string, constructor Constructor) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	if registry.constructors == nil {
+		registry.constructors = map[string]Constructor{}
+	}
+	if _, exists := registry.constructors[name]; exists {
+		panic(fmt.Sprintf("s3client: client %q registered twice", name))
+	}
+	registry.constructors[name] = constructor
+}
+
+// Names returns the sorted names of the registered clients.
+func Names() []string {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	names := make([]string, 0, len(registry.constructors))
+	for name := range registry.constructors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// New creates a client registered by the provided name.
+func New(name string, conf Config) (Client, error) {
+	registry.mu.Lock()
+	constructor, ok := registry.constructors[name]
+	registry.mu.Unlock()
+
+	if !ok {
+		return nil, errs.New("unknown client %q, available clients: %s", name, strings.Join(Names(), ", "))
+	}
+	return constructor(conf)
+}
+
+// Options parses client specific options.
+//
+// Parsing errors are collected and returned by Err together with
+// the options that were not read.
+type Options struct {
+	values map[string]string
+	used   map[string]bool
+	errs   errs.Group
+}
+
+// ParseOptions starts parsing client specific options.
+func ParseOptions(values map[string]string) *Options {
+	return &Options{
+		values: values,
+		used:   map[string]bool{},
+	}
+}
+
+// String returns the value of the option or def when it's not set.
+func (opts *Options) String(key, def string) string {
+	opts.used[key] = true
+	if value, ok := opts.values[key]; ok {
+		return value
+	}
+	return def
+}
+
+// Int returns the integer value of the option or def when it's not set.
+func (opts *Options) Int(key string, def int) int {
+	value := opts.String(key, "")
+	if value == "" {
+		return def
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		opts.errs.Add(fmt.Errorf("option %q: %w", key, err))
+		return def
+	}
+	return n
+}
+
+// Bool returns the boolean value of the option or def when it's not set.
+func (opts *Options) Bool(key string, def bool) bool {
+	value := opts.String(key, "")
+	if value == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		opts.errs.Add(fmt.Errorf("option %q: %w", key, err))
+		return def
+	}
+	return b
+}
+
+// Err returns parsing errors and an error for each unknown option.
+func (opts *Options) Err() error {
+	var unknown []string
+	for key := range opts.values {
+		if !opts.used[key] {
+			unknown = append(unknown, key)
+		}
+	}
+	sort.Strings(unknown)
+	for _, key := range unknown {
+		opts.errs.Add(fmt.Errorf("unknown option %q", key))
+	}
+	return opts.errs.Err()
+}
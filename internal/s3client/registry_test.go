@@ -0,0 +1,63 @@
+// Copyright (C) 2021 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package s3client_test
+
+import (
+	"testing"
+
+	"storj.io/benchmark/internal/s3client"
+)
+
+func TestRegistry(t *testing.T) {
+	names := map[string]bool{}
+	for _, name := range s3client.Names() {
+		names[name] = true
+	}
+	for _, name := range []string{"minio", "aws-cli", "aws-sdk", "uplink", "uplink-lib", "command", "fs"} {
+		if !names[name] {
+			t.Errorf("client %q is not registered", name)
+		}
+	}
+
+	if _, err := s3client.New("unknown", s3client.Config{}); err == nil {
+		t.Error("expected an error for an unknown client")
+	}
+
+	_, err := s3client.New("minio", s3client.Config{
+		S3Gateway: "127.0.0.1:7777",
+		Options:   map[string]string{"lookup": "path", "unknown": "value"},
+	})
+	if err == nil {
+		t.Error("expected an error for an unknown option")
+	}
+}
+
+func TestParseOptions(t *testing.T) {
+	opts := s3client.ParseOptions(map[string]string{
+		"name":  "value",
+		"count": "5",
+		"flag":  "true",
+	})
+	if got := opts.String("name", ""); got != "value" {
+		t.Errorf("got %q", got)
+	}
+	if got := opts.Int("count", 0); got != 5 {
+		t.Errorf("got %d", got)
+	}
+	if got := opts.Bool("flag", false); !got {
+		t.Errorf("got %v", got)
+	}
+	if got := opts.Int("missing", 7); got != 7 {
+		t.Errorf("got %d", got)
+	}
+	if err := opts.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	opts = s3client.ParseOptions(map[string]string{"count": "five"})
+	_ = opts.Int("count", 0)
+	if err := opts.Err(); err == nil {
+		t.Error("expected an error for an invalid integer")
+	}
+}
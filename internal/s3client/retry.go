@@ -0,0 +1,430 @@
+// Copyright (C) 2021 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package s3client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RetryOptions configures Retry.
+type RetryOptions struct {
+	// MaxAttempts is the number of attempts including the first one.
+	// Values below 1 are treated as 1, i.e. no retries.
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry.
+	InitialBackoff time.Duration
+	// MaxBackoff limits the delay between retries, 0 means no limit.
+	MaxBackoff time.Duration
+	// Multiplier grows the delay after each retry, defaults to 2.
+	Multiplier float64
+	// Jitter randomizes each delay by up to the specified fraction, e.g. 0.2 for ±20%.
+	Jitter float64
+
+	// Retryable decides whether err is transient. By default all errors
+	// are retried except ErrUnsupported, context errors and the errors
+	// that won't change by retrying, such as ErrObjectNotFound.
+	Retryable func(err error) bool
+	// OnRetry is called before waiting for a retry.
+	OnRetry func(op string, attempt int, err error, backoff time.Duration)
+}
+
+// RetryStats contains retry statistics of an operation.
+type RetryStats struct {
+	Op string
+	// Calls is the number of calls of the operation.
+	Calls int
+	// Attempts is the total number of attempts, including retries.
+	Attempts int
+	// Failures is the number of calls that failed after all attempts.
+	Failures int
+	// Causes counts the errors that caused retries.
+	Causes map[string]int
+}
+
+// AttemptsPerCall returns the average number of attempts per call.
+func (stats RetryStats) AttemptsPerCall() float64 {
+	if stats.Calls == 0 {
+		return 0
+	}
+	return float64(stats.Attempts) / float64(stats.Calls)
+}
+
+// Retry is a Client that retries idempotent operations with exponential backoff.
+//
+// Put and UploadPart are only retried when data implements io.Seeker.
+// Get and GetRange retry opening the object, but not reading from it.
+// MakeBucket, RemoveBucket, InitiateMultipart and CompleteMultipart are not retried.
+type Retry struct {
+	client Client
+	opts   RetryOptions
+
+	mu    sync.Mutex
+	stats map[string]*RetryStats
+}
+
+var _ Client = (*Retry)(nil)
+var _ MultipartUploader = (*Retry)(nil)
+var _ Mover = (*Retry)(nil)
+
+// NewRetry wraps client with retries.
+func NewRetry(client Client, opts RetryOptions) *Retry {
+	if opts.MaxAttempts < 1 {
+		opts.MaxAttempts = 1
+	}
+	if opts.Multiplier <= 0 {
+		opts.Multiplier = 2
+	}
+	if opts.Retryable == nil {
+		opts.Retryable = isTransient
+	}
+	return &Retry{
+		client: client,
+		opts:   opts,
+		stats:  map[string]*RetryStats{},
+	}
+}
+
+// isTransient is the default RetryOptions.Retryable.
+func isTransient(err error) bool {
+	return !errors.Is(err, ErrUnsupported) &&
+		!errors.Is(err, ErrObjectNotFound) &&
+		!errors.Is(err, ErrBucketNotFound) &&
+		!errors.Is(err, ErrBucketExists) &&
+		!errors.Is(err, ErrAccessDenied) &&
+		!errors.Is(err, context.Canceled) &&
+		!errors.Is(err, context.DeadlineExceeded)
+}
+
+// Stats returns retry statistics of the operations sorted by name.
+func (client *Retry) Stats() []RetryStats {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	all := make([]RetryStats, 0, len(client.stats))
+	for _, stats := range client.stats {
+		copied := *stats
+		copied.Causes = map[string]int{}
+		for cause, count := range stats.Causes {
+			copied.Causes[cause] = count
+		}
+		all = append(all, copied)
+	}
+	sort.Slice(all, func(i, k int) bool { return all[i].Op < all[k].Op })
+	return all
+}
+
+// do calls fn until it succeeds, the error is not retryable or the attempts run out.
+// fn is only called once when retry is false.
+func (client *Retry) do(ctx context.Context, op string, retry bool, fn func(attempt int) error) error {
+	maxAttempts := client.opts.MaxAttempts
+	if !retry {
+		maxAttempts = 1
+	}
+
+	var err error
+	attempt := 1
+	for ; ; attempt++ {
+		err = fn(attempt)
+		if err == nil || attempt >= maxAttempts || !client.opts.Retryable(err) {
+			break
+		}
+
+		backoff := client.backoff(attempt)
+		client.recordRetry(op, err)
+		if client.opts.OnRetry != nil {
+			client.opts.OnRetry(op, attempt, err, backoff)
+		}
+
+		if !sleep(ctx, backoff) {
+			break
+		}
+	}
+
+	client.recordCall(op, attempt, err)
+	return err
+}
+
+// backoff returns the delay before retrying after the specified attempt.
+func (client *Retry) backoff(attempt int) time.Duration {
+	delay := float64(client.opts.InitialBackoff) * math.Pow(client.opts.Multiplier, float64(attempt-1))
+	if client.opts.MaxBackoff > 0 && delay > float64(client.opts.MaxBackoff) {
+		delay = float64(client.opts.MaxBackoff)
+	}
+	if client.opts.Jitter > 0 {
+		delay *= 1 + client.opts.Jitter*(2*rand.Float64()-1)
+	}
+	if delay < 0 {
+		return 0
+	}
+	return time.Duration(delay)
+}
+
+func (client *Retry) recordRetry(op string, err error) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	client.opStats(op).Causes[retryCause(err)]++
+}
+
+func (client *Retry) recordCall(op string, attempts int, err error) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	stats := client.opStats(op)
+	stats.Calls++
+	stats.Attempts += attempts
+	if err != nil {
+		stats.Failures++
+	}
+}
+
+func (client *Retry) opStats(op string) *RetryStats {
+	stats, ok := client.stats[op]
+	if !ok {
+		stats = &RetryStats{Op: op, Causes: map[string]int{}}
+		client.stats[op] = stats
+	}
+	return stats
+}
+
+// retryCause returns a short description of err for grouping retries.
+func retryCause(err error) string {
+	cause := err.Error()
+	if i := strings.IndexByte(cause, '\n'); i >= 0 {
+		cause = cause[:i]
+	}
+	const maxLength = 120
+	if len(cause) > maxLength {
+		cause = cause[:maxLength] + "..."
+	}
+	return cause
+}
+
+// sleep waits for the duration and returns false when ctx is canceled first.
+func sleep(ctx context.Context, duration time.Duration) bool {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// rewinder returns a function that seeks data back to its current position,
+// or nil when data is not seekable.
+func rewinder(data io.Reader) (func() error, error) {
+	seeker, ok := data.(io.Seeker)
+	if !ok {
+		return nil, nil
+	}
+	start, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	return func() error {
+		_, err := seeker.Seek(start, io.SeekStart)
+		return err
+	}, nil
+}
+
+// MakeBucket makes a new bucket.
+func (client *Retry) MakeBucket(bucket, location string) error {
+	return client.do(context.Background(), "MakeBucket", false, func(int) error {
+		return client.client.MakeBucket(bucket, location)
+	})
+}
+
+// RemoveBucket removes a bucket.
+func (client *Retry) RemoveBucket(bucket string) error {
+	return client.do(context.Background(), "RemoveBucket", false, func(int) error {
+		return client.client.RemoveBucket(bucket)
+	})
+}
+
+// ListBuckets lists all buckets.
+func (client *Retry) ListBuckets() (names []string, err error) {
+	err = client.do(context.Background(), "ListBuckets", true, func(int) error {
+		names, err = client.client.ListBuckets()
+		return err
+	})
+	return names, err
+}
+
+// Upload uploads object data to the specified path.
+func (client *Retry) Upload(bucket, objectName string, data []byte) error {
+	return client.do(context.Background(), "Upload", true, func(int) error {
+		return client.client.Upload(bucket, objectName, data)
+	})
+}
+
+// Download downloads object data.
+func (client *Retry) Download(bucket, objectName string, buffer []byte) (data []byte, err error) {
+	err = client.do(context.Background(), "Download", true, func(int) error {
+		data, err = client.client.Download(bucket, objectName, buffer)
+		return err
+	})
+	return data, err
+}
+
+// DownloadRange downloads length bytes of object data starting at offset.
+func (client *Retry) DownloadRange(bucket, objectName string, offset, length int64, buffer []byte) (data []byte, err error) {
+	err = client.do(context.Background(), "DownloadRange", true, func(int) error {
+		data, err = client.client.DownloadRange(bucket, objectName, offset, length, buffer)
+		return err
+	})
+	return data, err
+}
+
+// Delete deletes object.
+func (client *Retry) Delete(bucket, objectName string) error {
+	return client.do(context.Background(), "Delete", true, func(int) error {
+		return client.client.Delete(bucket, objectName)
+	})
+}
+
+// ListObjects lists a single page of objects and prefixes.
+func (client *Retry) ListObjects(ctx context.Context, bucket string, opts ListOptions) (page ListPage, err error) {
+	err = client.do(ctx, "ListObjects", true, func(int) error {
+		page, err = client.client.ListObjects(ctx, bucket, opts)
+		return err
+	})
+	return page, err
+}
+
+// Put uploads object data from the reader to the specified path.
+func (client *Retry) Put(ctx context.Context, bucket, objectName string, data io.Reader, size int64, opts PutOptions) error {
+	rewind, err := rewinder(data)
+	if err != nil {
+		return err
+	}
+	return client.do(ctx, "Put", rewind != nil, func(attempt int) error {
+		if attempt > 1 {
+			if err := rewind(); err != nil {
+				return err
+			}
+		}
+		return client.client.Put(ctx, bucket, objectName, data, size, opts)
+	})
+}
+
+// Get returns a reader for the object data.
+func (client *Retry) Get(ctx context.Context, bucket, objectName string) (reader io.ReadCloser, info ObjectInfo, err error) {
+	err = client.do(ctx, "Get", true, func(int) error {
+		reader, info, err = client.client.Get(ctx, bucket, objectName)
+		return err
+	})
+	return reader, info, err
+}
+
+// GetRange returns a reader for length bytes of object data starting at offset.
+func (client *Retry) GetRange(ctx context.Context, bucket, objectName string, offset, length int64) (reader io.ReadCloser, info ObjectInfo, err error) {
+	err = client.do(ctx, "GetRange", true, func(int) error {
+		reader, info, err = client.client.GetRange(ctx, bucket, objectName, offset, length)
+		return err
+	})
+	return reader, info, err
+}
+
+// Stat returns information about the object.
+func (client *Retry) Stat(ctx context.Context, bucket, objectName string) (info ObjectInfo, err error) {
+	err = client.do(ctx, "Stat", true, func(int) error {
+		info, err = client.client.Stat(ctx, bucket, objectName)
+		return err
+	})
+	return info, err
+}
+
+// Copy copies an object.
+func (client *Retry) Copy(ctx context.Context, srcBucket, srcKey, dstBucket, dstKey string) error {
+	return client.do(ctx, "Copy", true, func(int) error {
+		return client.client.Copy(ctx, srcBucket, srcKey, dstBucket, dstKey)
+	})
+}
+
+// Move moves an object, it's not retried, because the source is gone after a success.
+func (client *Retry) Move(ctx context.Context, srcBucket, srcKey, dstBucket, dstKey string) error {
+	mover, ok := client.client.(Mover)
+	if !ok {
+		return ErrUnsupported
+	}
+	return client.do(ctx, "Move", false, func(int) error {
+		return mover.Move(ctx, srcBucket, srcKey, dstBucket, dstKey)
+	})
+}
+
+// InitiateMultipart starts a new multipart upload.
+func (client *Retry) InitiateMultipart(ctx context.Context, bucket, objectName string) (uploadID string, err error) {
+	uploader, ok := client.client.(MultipartUploader)
+	if !ok {
+		return "", ErrUnsupported
+	}
+	err = client.do(ctx, "InitiateMultipart", false, func(int) error {
+		uploadID, err = uploader.InitiateMultipart(ctx, bucket, objectName)
+		return err
+	})
+	return uploadID, err
+}
+
+// UploadPart uploads a single part of a multipart upload.
+func (client *Retry) UploadPart(ctx context.Context, bucket, objectName, uploadID string, partNumber int, data io.Reader, size int64) (part Part, err error) {
+	uploader, ok := client.client.(MultipartUploader)
+	if !ok {
+		return Part{}, ErrUnsupported
+	}
+	rewind, err := rewinder(data)
+	if err != nil {
+		return Part{}, err
+	}
+	err = client.do(ctx, "UploadPart", rewind != nil, func(attempt int) error {
+		if attempt > 1 {
+			if err := rewind(); err != nil {
+				return err
+			}
+		}
+		part, err = uploader.UploadPart(ctx, bucket, objectName, uploadID, partNumber, data, size)
+		return err
+	})
+	return part, err
+}
+
+// CompleteMultipart finishes a multipart upload.
+func (client *Retry) CompleteMultipart(ctx context.Context, bucket, objectName, uploadID string, parts []Part) error {
+	uploader, ok := client.client.(MultipartUploader)
+	if !ok {
+		return ErrUnsupported
+	}
+	return client.do(ctx, "CompleteMultipart", false, func(int) error {
+		return uploader.CompleteMultipart(ctx, bucket, objectName, uploadID, parts)
+	})
+}
+
+// AbortMultipart aborts a multipart upload.
+func (client *Retry) AbortMultipart(ctx context.Context, bucket, objectName, uploadID string) error {
+	uploader, ok := client.client.(MultipartUploader)
+	if !ok {
+		return ErrUnsupported
+	}
+	return client.do(ctx, "AbortMultipart", true, func(int) error {
+		return uploader.AbortMultipart(ctx, bucket, objectName, uploadID)
+	})
+}
+
+// Close closes the wrapped client when it implements io.Closer.
+func (client *Retry) Close() error {
+	if closer, ok := client.client.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
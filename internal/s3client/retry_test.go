@@ -0,0 +1,150 @@
+// Copyright (C) 2021 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package s3client_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"storj.io/benchmark/internal/s3client"
+)
+
+// flakyClient fails the first failures calls of Upload, Put and Stat.
+type flakyClient struct {
+	s3client.Client
+
+	failures int
+	calls    int
+	err      error
+	uploaded []string
+}
+
+func (client *flakyClient) fail() error {
+	client.calls++
+	if client.calls <= client.failures {
+		return client.err
+	}
+	return nil
+}
+
+func (client *flakyClient) Upload(bucket, objectName string, data []byte) error {
+	return client.fail()
+}
+
+func (client *flakyClient) Put(ctx context.Context, bucket, objectName string, data io.Reader, size int64, opts s3client.PutOptions) error {
+	read, err := ioutil.ReadAll(data)
+	if err != nil {
+		return err
+	}
+	if err := client.fail(); err != nil {
+		return err
+	}
+	client.uploaded = append(client.uploaded, string(read))
+	return nil
+}
+
+func (client *flakyClient) Stat(ctx context.Context, bucket, objectName string) (s3client.ObjectInfo, error) {
+	return s3client.ObjectInfo{}, client.fail()
+}
+
+func TestRetry(t *testing.T) {
+	ctx := context.Background()
+	transient := errors.New("503 Service Unavailable")
+
+	t.Run("Succeeds", func(t *testing.T) {
+		flaky := &flakyClient{failures: 2, err: transient}
+		retries := 0
+		client := s3client.NewRetry(flaky, s3client.RetryOptions{
+			MaxAttempts: 3,
+			OnRetry: func(op string, attempt int, err error, backoff time.Duration) {
+				retries++
+			},
+		})
+
+		if err := client.Upload("bucket", "key", nil); err != nil {
+			t.Fatal(err)
+		}
+		if flaky.calls != 3 || retries != 2 {
+			t.Fatalf("calls %d, retries %d", flaky.calls, retries)
+		}
+
+		stats := client.Stats()
+		if len(stats) != 1 || stats[0].Op != "Upload" || stats[0].Calls != 1 || stats[0].Attempts != 3 || stats[0].Failures != 0 {
+			t.Fatalf("unexpected stats %+v", stats)
+		}
+		if stats[0].Causes[transient.Error()] != 2 {
+			t.Fatalf("unexpected causes %+v", stats[0].Causes)
+		}
+	})
+
+	t.Run("GivesUp", func(t *testing.T) {
+		flaky := &flakyClient{failures: 5, err: transient}
+		client := s3client.NewRetry(flaky, s3client.RetryOptions{MaxAttempts: 3})
+
+		if _, err := client.Stat(ctx, "bucket", "key"); !errors.Is(err, transient) {
+			t.Fatalf("unexpected error %v", err)
+		}
+		if flaky.calls != 3 {
+			t.Fatalf("calls %d", flaky.calls)
+		}
+		if stats := client.Stats(); stats[0].Failures != 1 {
+			t.Fatalf("unexpected stats %+v", stats)
+		}
+	})
+
+	t.Run("NotRetryable", func(t *testing.T) {
+		flaky := &flakyClient{failures: 1, err: s3client.ErrUnsupported}
+		client := s3client.NewRetry(flaky, s3client.RetryOptions{MaxAttempts: 3})
+
+		if err := client.Upload("bucket", "key", nil); !errors.Is(err, s3client.ErrUnsupported) {
+			t.Fatalf("unexpected error %v", err)
+		}
+		if flaky.calls != 1 {
+			t.Fatalf("calls %d", flaky.calls)
+		}
+	})
+
+	t.Run("PutSeekable", func(t *testing.T) {
+		flaky := &flakyClient{failures: 1, err: transient}
+		client := s3client.NewRetry(flaky, s3client.RetryOptions{MaxAttempts: 3})
+
+		data := bytes.NewReader([]byte("data"))
+		if err := client.Put(ctx, "bucket", "key", data, 4, s3client.PutOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		if len(flaky.uploaded) != 1 || flaky.uploaded[0] != "data" {
+			t.Fatalf("uploaded %q", flaky.uploaded)
+		}
+	})
+
+	t.Run("PutNotSeekable", func(t *testing.T) {
+		flaky := &flakyClient{failures: 1, err: transient}
+		client := s3client.NewRetry(flaky, s3client.RetryOptions{MaxAttempts: 3})
+
+		data := ioutil.NopCloser(strings.NewReader("data"))
+		if err := client.Put(ctx, "bucket", "key", data, 4, s3client.PutOptions{}); !errors.Is(err, transient) {
+			t.Fatalf("unexpected error %v", err)
+		}
+		if flaky.calls != 1 {
+			t.Fatalf("calls %d", flaky.calls)
+		}
+	})
+
+	t.Run("Unsupported", func(t *testing.T) {
+		client := s3client.NewRetry(&flakyClient{}, s3client.RetryOptions{MaxAttempts: 3})
+
+		if err := client.Move(ctx, "bucket", "a", "bucket", "b"); !errors.Is(err, s3client.ErrUnsupported) {
+			t.Fatalf("unexpected error %v", err)
+		}
+		if _, err := client.InitiateMultipart(ctx, "bucket", "key"); !errors.Is(err, s3client.ErrUnsupported) {
+			t.Fatalf("unexpected error %v", err)
+		}
+	})
+}
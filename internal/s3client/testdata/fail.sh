@@ -0,0 +1,4 @@
+#!/bin/sh
+# fail.sh fails every command with $FAIL_OUTPUT as the error output.
+echo "$FAIL_OUTPUT" >&2
+exit 1
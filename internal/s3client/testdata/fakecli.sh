@@ -0,0 +1,82 @@
+#!/bin/sh
+# fakecli.sh is a minimal object store on the local filesystem
+# for testing the command client, see fakecli.json.
+#
+# usage: fakecli.sh root command arguments...
+root=$1
+command=$2
+shift 2
+
+fail() {
+	echo "fakecli: $1" >&2
+	exit 1
+}
+
+bucket() {
+	[ -d "$root/$1" ] || fail "bucket not found"
+}
+
+object() {
+	bucket "$1"
+	[ -f "$root/$1/$2" ] || fail "object not found"
+}
+
+case "$command" in
+mb)
+	[ -d "$root/$1" ] && fail "bucket already exists"
+	mkdir -p "$root/$1"
+	;;
+rb)
+	bucket "$1"
+	rmdir "$root/$1" 2>/dev/null || fail "bucket not empty"
+	;;
+buckets)
+	ls "$root"
+	;;
+put)
+	bucket "$1"
+	mkdir -p "$(dirname "$root/$1/$2")"
+	cp "$3" "$root/$1/$2"
+	;;
+get)
+	object "$1" "$2"
+	cat "$root/$1/$2"
+	;;
+range)
+	object "$1" "$2"
+	tail -c "+$(($3 + 1))" "$root/$1/$2" | head -c "$4"
+	;;
+rm)
+	object "$1" "$2"
+	rm "$root/$1/$2"
+	;;
+cp)
+	object "$1" "$2"
+	bucket "$3"
+	mkdir -p "$(dirname "$root/$3/$4")"
+	cp "$root/$1/$2" "$root/$3/$4"
+	;;
+ls)
+	# ls bucket directory [--recursive]
+	bucket "$1"
+	cd "$root/$1" || exit 1
+	if [ "$3" = "--recursive" ]; then
+		find . -type f | sed 's|^\./||' | while read -r key; do
+			echo "OBJ $(wc -c <"$key" | tr -d ' ') $key"
+		done
+	elif [ -d "./$2" ]; then
+		for entry in "./$2"*; do
+			[ -e "$entry" ] || continue
+			name=$(basename "$entry")
+			if [ -d "$entry" ]; then
+				echo "PRE $name/"
+			else
+				echo "OBJ $(wc -c <"$entry" | tr -d ' ') $name"
+			fi
+		done
+	fi
+	;;
+*)
+	fail "unknown command $command"
+	;;
+esac
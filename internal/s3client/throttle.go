@@ -0,0 +1,358 @@
+// Copyright (C) 2021 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package s3client
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// ThrottleOptions configures Throttle. Zero values disable the limits.
+type ThrottleOptions struct {
+	// UploadBandwidth limits the uploaded bytes per second.
+	UploadBandwidth int64
+	// DownloadBandwidth limits the downloaded bytes per second.
+	DownloadBandwidth int64
+	// OpsPerSecond limits the rate of calls.
+	OpsPerSecond float64
+	// Burst is the duration of transfer that may happen at full speed,
+	// defaults to 100ms.
+	Burst time.Duration
+}
+
+// Throttle is a Client that limits bandwidth and request rate.
+//
+// Readers passed to Put and UploadPart and returned by Get and GetRange
+// are throttled while streaming. With a bandwidth limit, Upload, Download
+// and DownloadRange stream through Put, Get and GetRange.
+type Throttle struct {
+	client   Client
+	upload   *tokenBucket
+	download *tokenBucket
+	ops      *tokenBucket
+}
+
+var _ Client = (*Throttle)(nil)
+var _ MultipartUploader = (*Throttle)(nil)
+var _ Mover = (*Throttle)(nil)
+
+// NewThrottle wraps client with bandwidth and request rate limits.
+func NewThrottle(client Client, opts ThrottleOptions) *Throttle {
+	if opts.Burst <= 0 {
+		opts.Burst = 100 * time.Millisecond
+	}
+	return &Throttle{
+		client:   client,
+		upload:   newTokenBucket(float64(opts.UploadBandwidth), opts.Burst.Seconds()*float64(opts.UploadBandwidth)),
+		download: newTokenBucket(float64(opts.DownloadBandwidth), opts.Burst.Seconds()*float64(opts.DownloadBandwidth)),
+		ops:      newTokenBucket(opts.OpsPerSecond, 1),
+	}
+}
+
+// tokenBucket is a token bucket that allows going into debt,
+// a nil bucket is unlimited.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate, burst float64) *tokenBucket {
+	if rate <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{
+		rate:   rate,
+		burst:  burst,
+		tokens: burst,
+		last:   time.Now(),
+	}
+}
+
+// reserve takes n tokens as if they were taken at the specified time and
+// returns when they are paid for.
+func (bucket *tokenBucket) reserve(at time.Time, n int64) time.Time {
+	bucket.mu.Lock()
+	defer bucket.mu.Unlock()
+
+	if at.After(bucket.last) {
+		bucket.tokens += at.Sub(bucket.last).Seconds() * bucket.rate
+		if bucket.tokens > bucket.burst {
+			bucket.tokens = bucket.burst
+		}
+		bucket.last = at
+	}
+
+	bucket.tokens -= float64(n)
+	if bucket.tokens >= 0 {
+		return bucket.last
+	}
+	return bucket.last.Add(time.Duration(-bucket.tokens / bucket.rate * float64(time.Second)))
+}
+
+// wait takes n tokens and waits until they are paid for.
+func (bucket *tokenBucket) wait(ctx context.Context, n int64) error {
+	if bucket == nil || n <= 0 {
+		return nil
+	}
+	return bucket.waitUntil(ctx, bucket.reserve(time.Now(), n))
+}
+
+func (bucket *tokenBucket) waitUntil(ctx context.Context, ready time.Time) error {
+	if !sleep(ctx, time.Until(ready)) {
+		return ctx.Err()
+	}
+	return nil
+}
+
+// MakeBucket makes a new bucket.
+func (client *Throttle) MakeBucket(bucket, location string) error {
+	if err := client.ops.wait(context.Background(), 1); err != nil {
+		return err
+	}
+	return client.client.MakeBucket(bucket, location)
+}
+
+// RemoveBucket removes a bucket.
+func (client *Throttle) RemoveBucket(bucket string) error {
+	if err := client.ops.wait(context.Background(), 1); err != nil {
+		return err
+	}
+	return client.client.RemoveBucket(bucket)
+}
+
+// ListBuckets lists all buckets.
+func (client *Throttle) ListBuckets() ([]string, error) {
+	if err := client.ops.wait(context.Background(), 1); err != nil {
+		return nil, err
+	}
+	return client.client.ListBuckets()
+}
+
+// Upload uploads object data to the specified path.
+func (client *Throttle) Upload(bucket, objectName string, data []byte) error {
+	if client.upload == nil {
+		if err := client.ops.wait(context.Background(), 1); err != nil {
+			return err
+		}
+		return client.client.Upload(bucket, objectName, data)
+	}
+	return client.Put(context.Background(), bucket, objectName, bytes.NewReader(data), int64(len(data)), PutOptions{})
+}
+
+// Download downloads object data.
+func (client *Throttle) Download(bucket, objectName string, buffer []byte) ([]byte, error) {
+	if client.download == nil {
+		if err := client.ops.wait(context.Background(), 1); err != nil {
+			return buffer[:0], err
+		}
+		return client.client.Download(bucket, objectName, buffer)
+	}
+	return getBytes(client, bucket, objectName, buffer)
+}
+
+// DownloadRange downloads length bytes of object data starting at offset.
+func (client *Throttle) DownloadRange(bucket, objectName string, offset, length int64, buffer []byte) ([]byte, error) {
+	if client.download == nil {
+		if err := client.ops.wait(context.Background(), 1); err != nil {
+			return buffer[:0], err
+		}
+		return client.client.DownloadRange(bucket, objectName, offset, length, buffer)
+	}
+	return getRangeBytes(client, bucket, objectName, offset, length, buffer)
+}
+
+// Delete deletes object.
+func (client *Throttle) Delete(bucket, objectName string) error {
+	if err := client.ops.wait(context.Background(), 1); err != nil {
+		return err
+	}
+	return client.client.Delete(bucket, objectName)
+}
+
+// ListObjects lists a single page of objects and prefixes.
+func (client *Throttle) ListObjects(ctx context.Context, bucket string, opts ListOptions) (ListPage, error) {
+	if err := client.ops.wait(ctx, 1); err != nil {
+		return ListPage{}, err
+	}
+	return client.client.ListObjects(ctx, bucket, opts)
+}
+
+// Put uploads object data from the reader to the specified path.
+func (client *Throttle) Put(ctx context.Context, bucket, objectName string, data io.Reader, size int64, opts PutOptions) error {
+	if err := client.ops.wait(ctx, 1); err != nil {
+		return err
+	}
+	if client.upload != nil {
+		data = throttleReader(ctx, data, client.upload)
+	}
+	return client.client.Put(ctx, bucket, objectName, data, size, opts)
+}
+
+// Get returns a reader for the object data.
+func (client *Throttle) Get(ctx context.Context, bucket, objectName string) (io.ReadCloser, ObjectInfo, error) {
+	if err := client.ops.wait(ctx, 1); err != nil {
+		return nil, ObjectInfo{}, err
+	}
+	reader, info, err := client.client.Get(ctx, bucket, objectName)
+	if err != nil || client.download == nil {
+		return reader, info, err
+	}
+	return &throttledReadCloser{throttledReader{ctx: ctx, reader: reader, bucket: client.download}, reader}, info, nil
+}
+
+// GetRange returns a reader for length bytes of object data starting at offset.
+func (client *Throttle) GetRange(ctx context.Context, bucket, objectName string, offset, length int64) (io.ReadCloser, ObjectInfo, error) {
+	if err := client.ops.wait(ctx, 1); err != nil {
+		return nil, ObjectInfo{}, err
+	}
+	reader, info, err := client.client.GetRange(ctx, bucket, objectName, offset, length)
+	if err != nil || client.download == nil {
+		return reader, info, err
+	}
+	return &throttledReadCloser{throttledReader{ctx: ctx, reader: reader, bucket: client.download}, reader}, info, nil
+}
+
+// Stat returns information about the object.
+func (client *Throttle) Stat(ctx context.Context, bucket, objectName string) (ObjectInfo, error) {
+	if err := client.ops.wait(ctx, 1); err != nil {
+		return ObjectInfo{}, err
+	}
+	return client.client.Stat(ctx, bucket, objectName)
+}
+
+// Copy copies an object.
+func (client *Throttle) Copy(ctx context.Context, srcBucket, srcKey, dstBucket, dstKey string) error {
+	if err := client.ops.wait(ctx, 1); err != nil {
+		return err
+	}
+	return client.client.Copy(ctx, srcBucket, srcKey, dstBucket, dstKey)
+}
+
+// Move moves an object.
+func (client *Throttle) Move(ctx context.Context, srcBucket, srcKey, dstBucket, dstKey string) error {
+	mover, ok := client.client.(Mover)
+	if !ok {
+		return ErrUnsupported
+	}
+	if err := client.ops.wait(ctx, 1); err != nil {
+		return err
+	}
+	return mover.Move(ctx, srcBucket, srcKey, dstBucket, dstKey)
+}
+
+// InitiateMultipart starts a new multipart upload.
+func (client *Throttle) InitiateMultipart(ctx context.Context, bucket, objectName string) (string, error) {
+	uploader, ok := client.client.(MultipartUploader)
+	if !ok {
+		return "", ErrUnsupported
+	}
+	if err := client.ops.wait(ctx, 1); err != nil {
+		return "", err
+	}
+	return uploader.InitiateMultipart(ctx, bucket, objectName)
+}
+
+// UploadPart uploads a single part of a multipart upload.
+func (client *Throttle) UploadPart(ctx context.Context, bucket, objectName, uploadID string, partNumber int, data io.Reader, size int64) (Part, error) {
+	uploader, ok := client.client.(MultipartUploader)
+	if !ok {
+		return Part{}, ErrUnsupported
+	}
+	if err := client.ops.wait(ctx, 1); err != nil {
+		return Part{}, err
+	}
+	if client.upload != nil {
+		data = throttleReader(ctx, data, client.upload)
+	}
+	return uploader.UploadPart(ctx, bucket, objectName, uploadID, partNumber, data, size)
+}
+
+// CompleteMultipart finishes a multipart upload.
+func (client *Throttle) CompleteMultipart(ctx context.Context, bucket, objectName, uploadID string, parts []Part) error {
+	uploader, ok := client.client.(MultipartUploader)
+	if !ok {
+		return ErrUnsupported
+	}
+	if err := client.ops.wait(ctx, 1); err != nil {
+		return err
+	}
+	return uploader.CompleteMultipart(ctx, bucket, objectName, uploadID, parts)
+}
+
+// AbortMultipart aborts a multipart upload.
+func (client *Throttle) AbortMultipart(ctx context.Context, bucket, objectName, uploadID string) error {
+	uploader, ok := client.client.(MultipartUploader)
+	if !ok {
+		return ErrUnsupported
+	}
+	if err := client.ops.wait(ctx, 1); err != nil {
+		return err
+	}
+	return uploader.AbortMultipart(ctx, bucket, objectName, uploadID)
+}
+
+// Close closes the wrapped client when it implements io.Closer.
+func (client *Throttle) Close() error {
+	if closer, ok := client.client.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// throttledReader waits for the read bytes to be paid for.
+type throttledReader struct {
+	ctx    context.Context
+	reader io.Reader
+	bucket *tokenBucket
+}
+
+// Read reads from the underlying reader.
+func (reader *throttledReader) Read(p []byte) (int, error) {
+	n, err := reader.reader.Read(p)
+	if waitErr := reader.bucket.wait(reader.ctx, int64(n)); waitErr != nil && err == nil {
+		err = waitErr
+	}
+	return n, err
+}
+
+// throttledReadSeeker is a throttledReader that keeps the underlying reader
+// seekable, e.g. for rewinding retried uploads.
+type throttledReadSeeker struct {
+	throttledReader
+	seeker io.Seeker
+}
+
+// Seek seeks the underlying reader.
+func (reader *throttledReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	return reader.seeker.Seek(offset, whence)
+}
+
+// throttleReader throttles reading from reader with bucket, keeping io.Seeker.
+func throttleReader(ctx context.Context, reader io.Reader, bucket *tokenBucket) io.Reader {
+	throttled := throttledReader{ctx: ctx, reader: reader, bucket: bucket}
+	if seeker, ok := reader.(io.Seeker); ok {
+		return &throttledReadSeeker{throttled, seeker}
+	}
+	return &throttled
+}
+
+// throttledReadCloser is a throttledReader that closes the underlying reader.
+type throttledReadCloser struct {
+	throttledReader
+	closer io.Closer
+}
+
+// Close closes the underlying reader.
+func (reader *throttledReadCloser) Close() error {
+	return reader.closer.Close()
+}
@@ -0,0 +1,108 @@
+// Copyright (C) 2021 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package s3client_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"storj.io/benchmark/internal/s3client"
+)
+
+func TestThrottle(t *testing.T) {
+	minio, cleanup := newTestClient(t, "bucket", s3client.NewMinio)
+	defer cleanup()
+
+	ctx := context.Background()
+	// transferring the data takes 200ms after the 50ms burst
+	const bandwidth = 100 << 10
+	data := make([]byte, bandwidth/4)
+	const minimum = 150 * time.Millisecond
+
+	t.Run("Upload", func(t *testing.T) {
+		client := s3client.NewThrottle(minio, s3client.ThrottleOptions{
+			UploadBandwidth: bandwidth,
+			Burst:           50 * time.Millisecond,
+		})
+
+		start := time.Now()
+		if err := client.Upload("bucket", "object", data); err != nil {
+			t.Fatal(err)
+		}
+		if elapsed := time.Since(start); elapsed < minimum {
+			t.Fatalf("upload took %v, expected at least %v", elapsed, minimum)
+		}
+	})
+
+	t.Run("Get", func(t *testing.T) {
+		client := s3client.NewThrottle(minio, s3client.ThrottleOptions{
+			DownloadBandwidth: bandwidth,
+			Burst:             50 * time.Millisecond,
+		})
+
+		start := time.Now()
+		reader, _, err := client.Get(ctx, "bucket", "object")
+		if err != nil {
+			t.Fatal(err)
+		}
+		read, err := ioutil.ReadAll(reader)
+		_ = reader.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(read, data) {
+			t.Fatal("downloaded data does not match")
+		}
+		if elapsed := time.Since(start); elapsed < minimum {
+			t.Fatalf("download took %v, expected at least %v", elapsed, minimum)
+		}
+	})
+
+	t.Run("Streaming", func(t *testing.T) {
+		recording := &putRecorder{Client: minio}
+		client := s3client.NewThrottle(recording, s3client.ThrottleOptions{UploadBandwidth: bandwidth})
+
+		// uploads are shaped while streaming and stay rewindable for retries
+		if err := client.Upload("bucket", "object", data); err != nil {
+			t.Fatal(err)
+		}
+		if err := client.Put(ctx, "bucket", "object", bytes.NewReader(data), int64(len(data)), s3client.PutOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		if len(recording.seekable) != 2 || !recording.seekable[0] || !recording.seekable[1] {
+			t.Fatalf("expected two seekable puts, got %v", recording.seekable)
+		}
+	})
+
+	t.Run("Ops", func(t *testing.T) {
+		client := s3client.NewThrottle(minio, s3client.ThrottleOptions{OpsPerSecond: 20})
+
+		start := time.Now()
+		for i := 0; i < 5; i++ {
+			if _, err := client.Stat(ctx, "bucket", "object"); err != nil {
+				t.Fatal(err)
+			}
+		}
+		// the first call uses the burst
+		if elapsed := time.Since(start); elapsed < minimum {
+			t.Fatalf("calls took %v, expected at least %v", elapsed, minimum)
+		}
+	})
+}
+
+// putRecorder records whether the readers passed to Put are seekable.
+type putRecorder struct {
+	s3client.Client
+	seekable []bool
+}
+
+func (client *putRecorder) Put(ctx context.Context, bucket, objectName string, data io.Reader, size int64, opts s3client.PutOptions) error {
+	_, ok := data.(io.Seeker)
+	client.seekable = append(client.seekable, ok)
+	return client.Client.Put(ctx, bucket, objectName, data, size, opts)
+}
@@ -0,0 +1,172 @@
+// Copyright (C) 2021 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package s3client
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// TransportConfig tunes the HTTP connections of the clients that send the
+// requests in process. Zero values keep the defaults of the client.
+type TransportConfig struct {
+	// MaxIdleConns limits the idle connections kept for reuse and
+	// MaxIdleConnsPerHost the ones to the gateway.
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+	// MaxConnsPerHost limits the connections to the gateway.
+	MaxConnsPerHost int
+	// IdleConnTimeout closes connections that have been idle for the duration.
+	IdleConnTimeout time.Duration
+	// DisableKeepAlives uses a new connection for every request.
+	DisableKeepAlives bool
+	// DisableHTTP2 uses HTTP/1.1 also with gateways supporting HTTP/2.
+	DisableHTTP2 bool
+
+	// Stats counts the connections when it's not nil.
+	Stats *ConnStats
+	// Timings collects the phases of every request when it's not nil.
+	Timings *RequestTimings
+}
+
+// ConnStats counts the connections of the HTTP transports using it.
+type ConnStats struct {
+	opened int64
+	reused int64
+	closed int64
+}
+
+// ConnCounts are the connection counts at a point in time.
+type ConnCounts struct {
+	// Opened and Closed count the connections, Reused counts the
+	// requests sent over an already used connection.
+	Opened int64
+	Reused int64
+	Closed int64
+}
+
+// Counts returns the current counts.
+func (stats *ConnStats) Counts() ConnCounts {
+	return ConnCounts{
+		Opened: atomic.LoadInt64(&stats.opened),
+		Reused: atomic.LoadInt64(&stats.reused),
+		Closed: atomic.LoadInt64(&stats.closed),
+	}
+}
+
+// HTTPTransport returns a copy of base configured by conf.TLS and
+// conf.Transport. It returns nil when base can be used as is.
+func (conf Config) HTTPTransport(base *http.Transport) (http.RoundTripper, error) {
+	if conf.TLS.IsZero() && conf.Transport == (TransportConfig{}) {
+		return nil, nil
+	}
+
+	transport := base.Clone()
+	if !conf.TLS.IsZero() {
+		config, err := conf.TLS.Load()
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig = config
+	}
+
+	opts := conf.Transport
+	if opts.MaxIdleConns > 0 {
+		transport.MaxIdleConns = opts.MaxIdleConns
+	}
+	if opts.MaxIdleConnsPerHost > 0 {
+		transport.MaxIdleConnsPerHost = opts.MaxIdleConnsPerHost
+	}
+	if opts.MaxConnsPerHost > 0 {
+		transport.MaxConnsPerHost = opts.MaxConnsPerHost
+	}
+	if opts.IdleConnTimeout > 0 {
+		transport.IdleConnTimeout = opts.IdleConnTimeout
+	}
+	if opts.DisableKeepAlives {
+		transport.DisableKeepAlives = true
+	}
+	if opts.DisableHTTP2 {
+		transport.ForceAttemptHTTP2 = false
+		// a non-nil empty map disables HTTP/2
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+
+	if opts.Stats == nil && opts.Timings == nil {
+		return transport, nil
+	}
+
+	if opts.Stats != nil {
+		dial := transport.DialContext
+		if dial == nil {
+			dial = (&net.Dialer{}).DialContext
+		}
+		transport.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+			conn, err := dial(ctx, network, address)
+			if err != nil {
+				return nil, err
+			}
+			atomic.AddInt64(&opts.Stats.opened, 1)
+			return &countedConn{Conn: conn, stats: opts.Stats}, nil
+		}
+	}
+	return &tracingTransport{transport: transport, stats: opts.Stats, timings: opts.Timings}, nil
+}
+
+// tracingTransport counts the requests that reuse a connection and
+// measures the phases of the requests.
+type tracingTransport struct {
+	transport *http.Transport
+	stats     *ConnStats
+	timings   *RequestTimings
+}
+
+// RoundTrip sends the request.
+func (transport *tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if transport.stats != nil {
+		req = traceRequest(req, &httptrace.ClientTrace{
+			GotConn: func(info httptrace.GotConnInfo) {
+				if info.Reused {
+					atomic.AddInt64(&transport.stats.reused, 1)
+				}
+			},
+		})
+	}
+	if transport.timings == nil {
+		return transport.transport.RoundTrip(req)
+	}
+
+	trace := &requestTrace{timing: RequestTiming{Method: req.Method, Start: time.Now()}}
+	resp, err := transport.transport.RoundTrip(traceRequest(req, trace.clientTrace()))
+	if err != nil {
+		trace.finish(transport.timings)
+		return resp, err
+	}
+	resp.Body = &timedBody{body: resp.Body, trace: trace, timings: transport.timings}
+	return resp, nil
+}
+
+// CloseIdleConnections closes the idle connections of the transport.
+func (transport *tracingTransport) CloseIdleConnections() {
+	transport.transport.CloseIdleConnections()
+}
+
+// countedConn counts when the connection is closed.
+type countedConn struct {
+	net.Conn
+	stats *ConnStats
+	once  sync.Once
+}
+
+// Close closes the connection.
+func (conn *countedConn) Close() error {
+	conn.once.Do(func() { atomic.AddInt64(&conn.stats.closed, 1) })
+	return conn.Conn.Close()
+}
@@ -0,0 +1,94 @@
+// Copyright (C) 2021 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package s3client_test
+
+import (
+	"testing"
+	"time"
+
+	"storj.io/benchmark/internal/s3client"
+)
+
+func TestConnStats(t *testing.T) {
+	for _, test := range []struct {
+		keepAlive bool
+		opened    int64
+		reused    int64
+	}{
+		{keepAlive: true, opened: 1, reused: 4},
+		{keepAlive: false, opened: 5, reused: 0},
+	} {
+		stats := &s3client.ConnStats{}
+		client, cleanup := newTestClient(t, "", func(conf s3client.Config) (s3client.Client, error) {
+			conf.Transport = s3client.TransportConfig{
+				DisableKeepAlives: !test.keepAlive,
+				Stats:             stats,
+			}
+			return s3client.NewMinio(conf)
+		})
+		defer cleanup()
+
+		for i := 0; i < 5; i++ {
+			if _, err := client.ListBuckets(); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		counts := stats.Counts()
+		if counts.Opened != test.opened || counts.Reused != test.reused || counts.Closed > counts.Opened {
+			t.Errorf("keep-alive %v: unexpected counts %+v", test.keepAlive, counts)
+		}
+	}
+}
+
+func TestRequestTimings(t *testing.T) {
+	timings := &s3client.RequestTimings{}
+	client, cleanup := newTestClient(t, "bucket", func(conf s3client.Config) (s3client.Client, error) {
+		conf.Region = "us-east-1"
+		conf.Transport = s3client.TransportConfig{Timings: timings}
+		return s3client.NewMinio(conf)
+	})
+	defer cleanup()
+	_ = timings.Take()
+
+	start := time.Now()
+	if err := client.Upload("bucket", "object", make([]byte, 1000)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Download("bucket", "object", nil); err != nil {
+		t.Fatal(err)
+	}
+	end := time.Now()
+
+	taken := timings.Take()
+	methods := map[string]int{}
+	for _, timing := range taken {
+		methods[timing.Method]++
+		if timing.End.Before(timing.Start) || timing.FirstByte <= 0 {
+			t.Errorf("unexpected timing %+v", timing)
+		}
+		if timing.Connect != 0 || timing.DNS != 0 {
+			t.Errorf("expected a reused connection, got %+v", timing)
+		}
+	}
+	if methods["PUT"] != 1 || methods["GET"] != 1 {
+		t.Fatalf("unexpected requests %v", methods)
+	}
+
+	phases := s3client.PhasesBetween(taken, start, end)
+	if phases.Requests != len(taken) || phases.FirstByte <= 0 {
+		t.Errorf("unexpected phases %+v", phases)
+	}
+	if phases := s3client.PhasesBetween(taken, end, end.Add(time.Second)); phases.Requests != 0 {
+		t.Errorf("expected no requests after the end, got %+v", phases)
+	}
+
+	timings.SetEnabled(false)
+	if _, err := client.Download("bucket", "object", nil); err != nil {
+		t.Fatal(err)
+	}
+	if taken := timings.Take(); len(taken) != 0 {
+		t.Fatalf("expected no timings while disabled, got %d", len(taken))
+	}
+}
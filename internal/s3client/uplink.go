@@ -4,10 +4,18 @@
 package s3client
 
 import (
+	"bufio"
 	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"os/exec"
+	"path"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/zeebo/errs"
 )
@@ -17,12 +25,23 @@ var UplinkError = errs.Class("uplink error")
 
 // Uplink implements basic S3 Client with uplink.
 type Uplink struct {
-	conf Config
+	conf   Config
+	binary string
 }
 
+func init() { Register("uplink", NewUplink) }
+
 // NewUplink creates new Client.
+//
+// The "binary" option sets the path of the uplink executable.
 func NewUplink(conf Config) (Client, error) {
-	client := &Uplink{conf}
+	opts := ParseOptions(conf.Options)
+	binary := opts.String("binary", "uplink")
+	if err := opts.Err(); err != nil {
+		return nil, UplinkError.Wrap(err)
+	}
+
+	client := &Uplink{conf, binary}
 
 	if client.conf.ConfigDir != "" {
 		fmt.Printf("Using existing uplink config at %s\n", client.conf.ConfigDir)
@@ -36,7 +55,7 @@ func NewUplink(conf Config) (Client, error) {
 	return client, nil
 }
 
-func (client *Uplink) cmd(subargs ...string) *exec.Cmd {
+func (client *Uplink) cmd(ctx context.Context, subargs ...string) *exec.Cmd {
 	args := make([]string, 0, len(subargs)+2)
 	args = append(args, subargs...)
 
@@ -50,13 +69,13 @@ func (client *Uplink) cmd(subargs ...string) *exec.Cmd {
 	// command it passes the arguments to the command properly escaped which are
 	// only interpreted by the OS as the arguments of the indicated program (.i.e
 	// uplink).
-	cmd := exec.Command("uplink", args...)
+	cmd := exec.CommandContext(ctx, client.binary, args...)
 	return cmd
 }
 
 // MakeBucket makes a new bucket.
 func (client *Uplink) MakeBucket(bucket, location string) error {
-	cmd := client.cmd("mb", "s3://"+bucket)
+	cmd := client.cmd(context.Background(), "mb", "s3://"+bucket)
 	out, err := cmd.Output()
 	if err != nil {
 		return UplinkError.Wrap(fullExitError(err, string(out)))
@@ -66,7 +85,7 @@ func (client *Uplink) MakeBucket(bucket, location string) error {
 
 // RemoveBucket removes a bucket.
 func (client *Uplink) RemoveBucket(bucket string) error {
-	cmd := client.cmd("rb", "s3://"+bucket)
+	cmd := client.cmd(context.Background(), "rb", "s3://"+bucket)
 	out, err := cmd.Output()
 	if err != nil {
 		return UplinkError.Wrap(fullExitError(err, string(out)))
@@ -76,7 +95,7 @@ func (client *Uplink) RemoveBucket(bucket string) error {
 
 // ListBuckets lists all buckets.
 func (client *Uplink) ListBuckets() ([]string, error) {
-	cmd := client.cmd("ls")
+	cmd := client.cmd(context.Background(), "ls")
 	data, err := cmd.Output()
 	if err != nil {
 		return nil, UplinkError.Wrap(fullExitError(err, string(data)))
@@ -88,9 +107,24 @@ func (client *Uplink) ListBuckets() ([]string, error) {
 
 // Upload uploads object data to the specified path.
 func (client *Uplink) Upload(bucket, objectName string, data []byte) error {
-	// TODO: add upload threshold
-	cmd := client.cmd("put", "s3://"+bucket+"/"+objectName)
-	cmd.Stdin = bytes.NewReader(data)
+	return putBytes(client, bucket, objectName, data)
+}
+
+// Put uploads object data from the reader to the specified path.
+//
+// Uploads with metadata use "cp", which supports setting metadata.
+func (client *Uplink) Put(ctx context.Context, bucket, objectName string, data io.Reader, size int64, opts PutOptions) error {
+	args := []string{"put", "s3://" + bucket + "/" + objectName}
+	if opts.ContentType != "" || len(opts.Metadata) > 0 {
+		metadata, err := json.Marshal(uplinkMetadata(opts))
+		if err != nil {
+			return UplinkError.Wrap(err)
+		}
+		args = []string{"cp", "-", "s3://" + bucket + "/" + objectName, "--metadata", string(metadata)}
+	}
+
+	cmd := client.cmd(ctx, args...)
+	cmd.Stdin = data
 	out, err := cmd.Output()
 	if err != nil {
 		return UplinkError.Wrap(fullExitError(err, string(out)))
@@ -100,17 +134,94 @@ func (client *Uplink) Upload(bucket, objectName string, data []byte) error {
 
 // Download downloads object data.
 func (client *Uplink) Download(bucket, objectName string, buffer []byte) ([]byte, error) {
-	cmd := client.cmd("cat", "s3://"+bucket+"/"+objectName)
-	out, err := cmd.Output()
+	return getBytes(client, bucket, objectName, buffer)
+}
+
+// Get returns a reader for the object data.
+func (client *Uplink) Get(ctx context.Context, bucket, objectName string) (io.ReadCloser, ObjectInfo, error) {
+	cmd := client.cmd(ctx, "cat", "s3://"+bucket+"/"+objectName)
+	reader, err := startProcessReader(cmd, &UplinkError)
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+	return reader, ObjectInfo{Key: objectName, Size: -1}, nil
+}
+
+// DownloadRange downloads length bytes of object data starting at offset.
+func (client *Uplink) DownloadRange(bucket, objectName string, offset, length int64, buffer []byte) ([]byte, error) {
+	return getRangeBytes(client, bucket, objectName, offset, length, buffer)
+}
+
+// GetRange returns a reader for length bytes of object data starting at offset.
+func (client *Uplink) GetRange(ctx context.Context, bucket, objectName string, offset, length int64) (io.ReadCloser, ObjectInfo, error) {
+	cmd := client.cmd(ctx, "cp", "--range", httpRange(offset, length), "s3://"+bucket+"/"+objectName, "-")
+	reader, err := startProcessReader(cmd, &UplinkError)
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+	return reader, ObjectInfo{Key: objectName, Size: -1}, nil
+}
+
+// Stat returns information about the object.
+//
+// The size and creation time are parsed from "ls" and the metadata from "meta get".
+func (client *Uplink) Stat(ctx context.Context, bucket, objectName string) (ObjectInfo, error) {
+	cmd := client.cmd(ctx, "ls", "s3://"+bucket+"/"+objectName)
+	listing, err := cmd.Output()
 	if err != nil {
-		return nil, UplinkError.Wrap(fullExitError(err, string(out)))
+		return ObjectInfo{}, UplinkError.Wrap(fullExitError(err, string(listing)))
+	}
+
+	entries, err := parseUplinkListing(listing)
+	if err != nil {
+		return ObjectInfo{}, UplinkError.Wrap(err)
+	}
+
+	var info *ObjectInfo
+	for _, entry := range entries {
+		// older uplink versions print keys relative to the listed prefix
+		if !entry.IsPrefix && (entry.Key == objectName || entry.Key == path.Base(objectName)) {
+			info = &ObjectInfo{
+				Key:          objectName,
+				Size:         entry.Size,
+				LastModified: entry.LastModified,
+			}
+			break
+		}
+	}
+	if info == nil {
+		return ObjectInfo{}, UplinkError.Wrap(fmt.Errorf("%q: %w", objectName, ErrObjectNotFound))
 	}
-	return out, nil
+
+	cmd = client.cmd(ctx, "meta", "get", "s3://"+bucket+"/"+objectName)
+	jsondata, err := cmd.Output()
+	if err != nil {
+		return ObjectInfo{}, UplinkError.Wrap(fullExitError(err, string(jsondata)))
+	}
+
+	var custom map[string]string
+	if len(bytes.TrimSpace(jsondata)) > 0 {
+		err = json.Unmarshal(jsondata, &custom)
+		if err != nil {
+			return ObjectInfo{}, UplinkError.Wrap(err)
+		}
+	}
+
+	info.Metadata = map[string]string{}
+	for key, value := range custom {
+		if key == uplinkContentTypeKey {
+			info.ContentType = value
+			continue
+		}
+		info.Metadata[key] = value
+	}
+
+	return *info, nil
 }
 
 // Delete deletes object.
 func (client *Uplink) Delete(bucket, objectName string) error {
-	cmd := client.cmd("rm", "s3://"+bucket+"/"+objectName)
+	cmd := client.cmd(context.Background(), "rm", "s3://"+bucket+"/"+objectName)
 	out, err := cmd.Output()
 	if err != nil {
 		return UplinkError.Wrap(fullExitError(err, string(out)))
@@ -118,14 +229,105 @@ func (client *Uplink) Delete(bucket, objectName string) error {
 	return nil
 }
 
-// ListObjects lists objects.
-func (client *Uplink) ListObjects(bucket, prefix string) ([]string, error) {
-	cmd := client.cmd("ls", "s3://"+bucket+"/"+prefix)
+// Copy copies an object.
+//
+// Only newer uplink versions copy objects without downloading them.
+func (client *Uplink) Copy(ctx context.Context, srcBucket, srcKey, dstBucket, dstKey string) error {
+	cmd := client.cmd(ctx, "cp", "s3://"+srcBucket+"/"+srcKey, "s3://"+dstBucket+"/"+dstKey)
+	out, err := cmd.Output()
+	if err != nil {
+		return UplinkError.Wrap(fullExitError(err, string(out)))
+	}
+	return nil
+}
+
+// Move moves an object.
+func (client *Uplink) Move(ctx context.Context, srcBucket, srcKey, dstBucket, dstKey string) error {
+	cmd := client.cmd(ctx, "mv", "s3://"+srcBucket+"/"+srcKey, "s3://"+dstBucket+"/"+dstKey)
+	out, err := cmd.Output()
+	if err != nil {
+		return UplinkError.Wrap(fullExitError(err, string(out)))
+	}
+	return nil
+}
+
+// ListObjects lists objects and prefixes.
+//
+// uplink doesn't support paging, hence all entries are returned in a single page.
+func (client *Uplink) ListObjects(ctx context.Context, bucket string, opts ListOptions) (ListPage, error) {
+	// uplink only accepts prefixes that end with a slash, hence list the
+	// parent prefix and filter the results.
+	parent := opts.Prefix[:strings.LastIndex(opts.Prefix, "/")+1]
+
+	args := []string{"ls"}
+	if opts.Recursive {
+		args = append(args, "--recursive")
+	}
+	args = append(args, "s3://"+bucket+"/"+parent)
+
+	cmd := client.cmd(ctx, args...)
 	data, err := cmd.Output()
 	if err != nil {
-		return nil, UplinkError.Wrap(fullExitError(err, string(data)))
+		return ListPage{}, UplinkError.Wrap(fullExitError(err, string(data)))
 	}
 
-	names := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
-	return names, nil
+	entries, err := parseUplinkListing(data)
+	if err != nil {
+		return ListPage{}, UplinkError.Wrap(err)
+	}
+
+	page := ListPage{}
+	for _, entry := range entries {
+		// older uplink versions print keys relative to the listed prefix
+		if !strings.HasPrefix(entry.Key, parent) {
+			entry.Key = parent + entry.Key
+		}
+		if strings.HasPrefix(entry.Key, opts.Prefix) {
+			page.Entries = append(page.Entries, entry)
+		}
+	}
+
+	return page, nil
+}
+
+var (
+	uplinkObjectLine = regexp.MustCompile(`^OBJ\s+(\S+\s+\S+)\s+(\d+)\s+(.*)$`)
+	uplinkPrefixLine = regexp.MustCompile(`^PRE\s+(.*)$`)
+)
+
+// parseUplinkListing parses "uplink ls" output of objects and prefixes.
+func parseUplinkListing(data []byte) ([]ListEntry, error) {
+	var entries []ListEntry
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+
+		if match := uplinkPrefixLine.FindStringSubmatch(line); match != nil {
+			entries = append(entries, ListEntry{
+				Key:      match[1],
+				IsPrefix: true,
+			})
+			continue
+		}
+
+		if match := uplinkObjectLine.FindStringSubmatch(line); match != nil {
+			created, err := time.ParseInLocation("2006-01-02 15:04:05", match[1], time.Local)
+			if err != nil {
+				return nil, err
+			}
+			size, err := strconv.ParseInt(match[2], 10, 64)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, ListEntry{
+				Key:          match[3],
+				Size:         size,
+				LastModified: created,
+			})
+		}
+		// other lines, such as the header, are ignored
+	}
+
+	return entries, scanner.Err()
 }
@@ -0,0 +1,339 @@
+// Copyright (C) 2021 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package s3client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/zeebo/errs"
+
+	"storj.io/uplink"
+)
+
+// UplinkLibError is class for uplink library errors.
+var UplinkLibError = errs.Class("uplink library error")
+
+// UplinkLib implements basic S3 Client with storj.io/uplink library.
+//
+// Unlike Uplink it opens the project once and reuses it for all requests.
+type UplinkLib struct {
+	project *uplink.Project
+}
+
+func init() { Register("uplink-lib", NewUplinkLib) }
+
+// NewUplinkLib creates new Client.
+func NewUplinkLib(conf Config) (Client, error) {
+	if err := ParseOptions(conf.Options).Err(); err != nil {
+		return nil, uplinkLibError(err)
+	}
+	if conf.Access == "" {
+		return nil, UplinkLibError.New("%s", "access cannot be empty")
+	}
+
+	access, err := uplink.ParseAccess(conf.Access)
+	if err != nil {
+		return nil, uplinkLibError(err)
+	}
+
+	project, err := uplink.OpenProject(context.Background(), access)
+	if err != nil {
+		return nil, uplinkLibError(err)
+	}
+
+	return &UplinkLib{project}, nil
+}
+
+// Close closes the project.
+func (client *UplinkLib) Close() error {
+	return UplinkLibError.Wrap(client.project.Close())
+}
+
+// MakeBucket makes a new bucket.
+func (client *UplinkLib) MakeBucket(bucket, location string) error {
+	_, err := client.project.CreateBucket(context.Background(), bucket)
+	if err != nil {
+		return uplinkLibError(err)
+	}
+	return nil
+}
+
+// RemoveBucket removes a bucket.
+func (client *UplinkLib) RemoveBucket(bucket string) error {
+	_, err := client.project.DeleteBucket(context.Background(), bucket)
+	if err != nil {
+		return uplinkLibError(err)
+	}
+	return nil
+}
+
+// ListBuckets lists all buckets.
+func (client *UplinkLib) ListBuckets() ([]string, error) {
+	names := []string{}
+
+	iterator := client.project.ListBuckets(context.Background(), nil)
+	for iterator.Next() {
+		names = append(names, iterator.Item().Name)
+	}
+	if err := iterator.Err(); err != nil {
+		return nil, uplinkLibError(err)
+	}
+
+	return names, nil
+}
+
+// Upload uploads object data to the specified path.
+func (client *UplinkLib) Upload(bucket, objectName string, data []byte) error {
+	return putBytes(client, bucket, objectName, data)
+}
+
+// Put uploads object data from the reader to the specified path.
+func (client *UplinkLib) Put(ctx context.Context, bucket, objectName string, data io.Reader, size int64, opts PutOptions) error {
+	upload, err := client.project.UploadObject(ctx, bucket, objectName, nil)
+	if err != nil {
+		return uplinkLibError(err)
+	}
+
+	_, err = io.Copy(upload, data)
+	if err != nil {
+		return uplinkLibError(errs.Combine(err, upload.Abort()))
+	}
+
+	err = upload.SetCustomMetadata(ctx, uplinkMetadata(opts))
+	if err != nil {
+		return uplinkLibError(errs.Combine(err, upload.Abort()))
+	}
+
+	err = upload.Commit()
+	if err != nil {
+		return uplinkLibError(err)
+	}
+	return nil
+}
+
+// InitiateMultipart starts a new multipart upload.
+func (client *UplinkLib) InitiateMultipart(ctx context.Context, bucket, objectName string) (string, error) {
+	info, err := client.project.BeginUpload(ctx, bucket, objectName, nil)
+	if err != nil {
+		return "", uplinkLibError(err)
+	}
+	return info.UploadID, nil
+}
+
+// UploadPart uploads a single part of a multipart upload.
+func (client *UplinkLib) UploadPart(ctx context.Context, bucket, objectName, uploadID string, partNumber int, data io.Reader, size int64) (Part, error) {
+	upload, err := client.project.UploadPart(ctx, bucket, objectName, uploadID, uint32(partNumber))
+	if err != nil {
+		return Part{}, uplinkLibError(err)
+	}
+
+	_, err = io.Copy(upload, data)
+	if err != nil {
+		return Part{}, UplinkLibError.Wrap(errs.Combine(err, upload.Abort()))
+	}
+
+	err = upload.Commit()
+	if err != nil {
+		return Part{}, uplinkLibError(err)
+	}
+
+	info := upload.Info()
+	return Part{
+		Number: partNumber,
+		ETag:   string(info.ETag),
+		Size:   info.Size,
+	}, nil
+}
+
+// CompleteMultipart finishes a multipart upload.
+//
+// uplink commits all uploaded parts, hence parts is not used.
+func (client *UplinkLib) CompleteMultipart(ctx context.Context, bucket, objectName, uploadID string, parts []Part) error {
+	_, err := client.project.CommitUpload(ctx, bucket, objectName, uploadID, nil)
+	if err != nil {
+		return uplinkLibError(err)
+	}
+	return nil
+}
+
+// AbortMultipart aborts a multipart upload.
+func (client *UplinkLib) AbortMultipart(ctx context.Context, bucket, objectName, uploadID string) error {
+	err := client.project.AbortUpload(ctx, bucket, objectName, uploadID)
+	if err != nil {
+		return uplinkLibError(err)
+	}
+	return nil
+}
+
+// Download downloads object data.
+func (client *UplinkLib) Download(bucket, objectName string, buffer []byte) ([]byte, error) {
+	return getBytes(client, bucket, objectName, buffer)
+}
+
+// DownloadRange downloads length bytes of object data starting at offset.
+func (client *UplinkLib) DownloadRange(bucket, objectName string, offset, length int64, buffer []byte) ([]byte, error) {
+	return getRangeBytes(client, bucket, objectName, offset, length, buffer)
+}
+
+// Get returns a reader for the object data.
+func (client *UplinkLib) Get(ctx context.Context, bucket, objectName string) (io.ReadCloser, ObjectInfo, error) {
+	return client.get(ctx, bucket, objectName, nil)
+}
+
+// GetRange returns a reader for length bytes of object data starting at offset.
+func (client *UplinkLib) GetRange(ctx context.Context, bucket, objectName string, offset, length int64) (io.ReadCloser, ObjectInfo, error) {
+	return client.get(ctx, bucket, objectName, &uplink.DownloadOptions{
+		Offset: offset,
+		Length: length,
+	})
+}
+
+func (client *UplinkLib) get(ctx context.Context, bucket, objectName string, opts *uplink.DownloadOptions) (io.ReadCloser, ObjectInfo, error) {
+	download, err := client.project.DownloadObject(ctx, bucket, objectName, opts)
+	if err != nil {
+		return nil, ObjectInfo{}, uplinkLibError(err)
+	}
+
+	info := download.Info()
+
+	size := info.System.ContentLength
+	if opts != nil && opts.Length >= 0 && opts.Offset+opts.Length < size {
+		size = opts.Length
+	} else if opts != nil {
+		size -= opts.Offset
+	}
+
+	objectInfo := uplinkObjectInfo(info)
+	objectInfo.Size = size
+	return &classReader{download, &UplinkLibError}, objectInfo, nil
+}
+
+// Stat returns information about the object.
+func (client *UplinkLib) Stat(ctx context.Context, bucket, objectName string) (ObjectInfo, error) {
+	object, err := client.project.StatObject(ctx, bucket, objectName)
+	if err != nil {
+		return ObjectInfo{}, uplinkLibError(err)
+	}
+	return uplinkObjectInfo(object), nil
+}
+
+// Delete deletes object.
+func (client *UplinkLib) Delete(bucket, objectName string) error {
+	_, err := client.project.DeleteObject(context.Background(), bucket, objectName)
+	if err != nil {
+		return uplinkLibError(err)
+	}
+	return nil
+}
+
+// Copy is not supported by the uplink library version in use.
+func (client *UplinkLib) Copy(ctx context.Context, srcBucket, srcKey, dstBucket, dstKey string) error {
+	return UplinkLibError.Wrap(ErrUnsupported)
+}
+
+// Move moves an object.
+func (client *UplinkLib) Move(ctx context.Context, srcBucket, srcKey, dstBucket, dstKey string) error {
+	err := client.project.MoveObject(ctx, srcBucket, srcKey, dstBucket, dstKey, nil)
+	if err != nil {
+		return uplinkLibError(err)
+	}
+	return nil
+}
+
+// ListObjects lists a single page of objects and prefixes.
+//
+// The continuation token is the last key of the previous page.
+func (client *UplinkLib) ListObjects(ctx context.Context, bucket string, opts ListOptions) (ListPage, error) {
+	// uplink only accepts prefixes that end with a slash, hence list the
+	// parent prefix and filter the results.
+	parent := opts.Prefix[:strings.LastIndex(opts.Prefix, "/")+1]
+
+	page := ListPage{}
+
+	iterator := client.project.ListObjects(ctx, bucket, &uplink.ListObjectsOptions{
+		Prefix:    parent,
+		Cursor:    opts.ContinuationToken,
+		Recursive: opts.Recursive,
+		System:    true,
+	})
+	for iterator.Next() {
+		item := iterator.Item()
+		if !strings.HasPrefix(item.Key, opts.Prefix) {
+			continue
+		}
+		if opts.MaxKeys > 0 && len(page.Entries) == opts.MaxKeys {
+			page.NextContinuationToken = page.Entries[len(page.Entries)-1].Key
+			break
+		}
+
+		page.Entries = append(page.Entries, ListEntry{
+			Key:          item.Key,
+			Size:         item.System.ContentLength,
+			LastModified: item.System.Created,
+			IsPrefix:     item.IsPrefix,
+		})
+	}
+	if err := iterator.Err(); err != nil {
+		return ListPage{}, uplinkLibError(err)
+	}
+
+	return page, nil
+}
+
+// uplinkContentTypeKey is the custom metadata key the gateway uses for the content type.
+const uplinkContentTypeKey = "content-type"
+
+// uplinkMetadata returns custom metadata for an upload in the same format as the gateway.
+func uplinkMetadata(opts PutOptions) uplink.CustomMetadata {
+	custom := uplink.CustomMetadata{}
+	for key, value := range opts.Metadata {
+		custom[key] = value
+	}
+	custom[uplinkContentTypeKey] = opts.contentType()
+	return custom
+}
+
+// uplinkObjectInfo converts uplink object into ObjectInfo.
+func uplinkObjectInfo(object *uplink.Object) ObjectInfo {
+	info := ObjectInfo{
+		Key:          object.Key,
+		Size:         object.System.ContentLength,
+		LastModified: object.System.Created,
+		Metadata:     map[string]string{},
+	}
+	for key, value := range object.Custom {
+		if key == uplinkContentTypeKey {
+			info.ContentType = value
+			continue
+		}
+		info.Metadata[key] = value
+	}
+	return info
+}
+
+// uplinkLibKinds maps uplink library errors.
+var uplinkLibKinds = []struct {
+	err  error
+	kind error
+}{
+	{uplink.ErrObjectNotFound, ErrObjectNotFound},
+	{uplink.ErrBucketNotFound, ErrBucketNotFound},
+	{uplink.ErrBucketAlreadyExists, ErrBucketExists},
+	{uplink.ErrPermissionDenied, ErrAccessDenied},
+	{uplink.ErrTooManyRequests, ErrThrottled},
+	{uplink.ErrBandwidthLimitExceeded, ErrThrottled},
+}
+
+// uplinkLibError wraps err into UplinkLibError and marks its kind.
+func uplinkLibError(err error) error {
+	for _, mapping := range uplinkLibKinds {
+		if errors.Is(err, mapping.err) {
+			return UplinkLibError.Wrap(withKind(err, mapping.kind))
+		}
+	}
+	return UplinkLibError.Wrap(withKind(err, netKind(err)))
+}
@@ -0,0 +1,850 @@
+// Copyright (C) 2021 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+// Package s3fake implements an in-memory server for a subset of the S3 API.
+package s3fake
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Server is an in-memory S3 server for testing clients without network access.
+//
+// It supports path-style requests for buckets, objects, listings, ranged
+// reads, copies and multipart uploads. Signatures are not verified.
+//
+// Requests are handled concurrently: only looking up and changing the
+// buckets and uploads is serialized, reading the request bodies and writing
+// the responses is not.
+type Server struct {
+	httpServer *httptest.Server
+
+	mu       sync.Mutex
+	buckets  map[string]*bucket
+	uploads  map[string]*upload
+	uploadID int
+}
+
+type bucket struct {
+	created time.Time
+	objects map[string]*object
+}
+
+type object struct {
+	data        []byte
+	etag        string
+	contentType string
+	metadata    map[string]string
+	modified    time.Time
+}
+
+type upload struct {
+	bucket      string
+	key         string
+	contentType string
+	metadata    map[string]string
+	parts       map[int]*object
+}
+
+// NewServer starts a new server listening on a local address.
+func NewServer() *Server {
+	server := &Server{
+		buckets: map[string]*bucket{},
+		uploads: map[string]*upload{},
+	}
+	server.httpServer = httptest.NewServer(server)
+	return server
+}
+
+// Addr returns the host:port address of the server.
+func (server *Server) Addr() string {
+	return server.httpServer.Listener.Addr().String()
+}
+
+// URL returns the base URL of the server.
+func (server *Server) URL() string {
+	return server.httpServer.URL
+}
+
+// Close shuts down the server.
+func (server *Server) Close() {
+	server.httpServer.Close()
+}
+
+// apiError is an S3 error response.
+type apiError struct {
+	status  int
+	code    string
+	message string
+}
+
+var (
+	errNoSuchBucket        = apiError{http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist."}
+	errNoSuchKey           = apiError{http.StatusNotFound, "NoSuchKey", "The specified key does not exist."}
+	errNoSuchUpload        = apiError{http.StatusNotFound, "NoSuchUpload", "The specified multipart upload does not exist."}
+	errBucketAlreadyExists = apiError{http.StatusConflict, "BucketAlreadyOwnedByYou", "The bucket already exists."}
+	errBucketNotEmpty      = apiError{http.StatusConflict, "BucketNotEmpty", "The bucket you tried to delete is not empty."}
+	errInvalidRange        = apiError{http.StatusRequestedRangeNotSatisfiable, "InvalidRange", "The requested range is not satisfiable."}
+	errInvalidPart         = apiError{http.StatusBadRequest, "InvalidPart", "One or more of the specified parts could not be found."}
+	errInvalidArgument     = apiError{http.StatusBadRequest, "InvalidArgument", "Invalid argument."}
+	errMalformedXML        = apiError{http.StatusBadRequest, "MalformedXML", "The XML you provided was not well-formed."}
+	errIncompleteBody      = apiError{http.StatusBadRequest, "IncompleteBody", "The request body could not be read."}
+	errNotImplemented      = apiError{http.StatusNotImplemented, "NotImplemented", "The request is not supported by the fake server."}
+)
+
+// ServeHTTP handles S3 requests.
+func (server *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	bucketName, key := splitPath(r.URL.Path)
+	query := r.URL.Query()
+
+	// the body is read and the response is sent without holding the lock,
+	// so that a slow client doesn't stall the other requests
+	var body []byte
+	if r.Method == http.MethodPut || r.Method == http.MethodPost {
+		var readErr error
+		body, readErr = readBody(r)
+		if readErr != nil {
+			writeError(w, r, &errIncompleteBody)
+			return
+		}
+	}
+
+	resp := &response{header: http.Header{}}
+	server.mu.Lock()
+	err := server.handle(resp, r, bucketName, key, query, body)
+	server.mu.Unlock()
+
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	resp.send(w)
+}
+
+// handle handles a request with the server locked.
+func (server *Server) handle(w http.ResponseWriter, r *http.Request, bucketName, key string, query url.Values, body []byte) *apiError {
+	_, hasUploads := query["uploads"]
+	_, hasLocation := query["location"]
+	uploadID := query.Get("uploadId")
+
+	var err *apiError
+	switch {
+	case bucketName == "" && r.Method == http.MethodGet:
+		err = server.listBuckets(w)
+
+	case key == "" && r.Method == http.MethodPut:
+		err = server.createBucket(w, bucketName)
+	case key == "" && r.Method == http.MethodDelete:
+		err = server.deleteBucket(w, bucketName)
+	case key == "" && r.Method == http.MethodHead:
+		_, err = server.bucket(bucketName)
+	case key == "" && r.Method == http.MethodGet && hasLocation:
+		err = server.bucketLocation(w, bucketName)
+	case key == "" && r.Method == http.MethodGet:
+		err = server.listObjects(w, bucketName, query)
+
+	case key == "":
+		err = &errNotImplemented
+
+	case r.Method == http.MethodPost && hasUploads:
+		err = server.initiateMultipart(w, r, bucketName, key)
+	case r.Method == http.MethodPost && uploadID != "":
+		err = server.completeMultipart(w, bucketName, key, uploadID, body)
+	case r.Method == http.MethodPut && uploadID != "":
+		err = server.uploadPart(w, r, uploadID, query.Get("partNumber"), body)
+	case r.Method == http.MethodDelete && uploadID != "":
+		err = server.abortMultipart(w, uploadID)
+
+	case r.Method == http.MethodPut && r.Header.Get("X-Amz-Copy-Source") != "":
+		err = server.copyObject(w, r, bucketName, key)
+	case r.Method == http.MethodPut:
+		err = server.putObject(w, r, bucketName, key, body)
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		err = server.getObject(w, r, bucketName, key)
+	case r.Method == http.MethodDelete:
+		err = server.deleteObject(w, bucketName, key)
+
+	default:
+		err = &errNotImplemented
+	}
+	return err
+}
+
+// response collects a response while the server is locked, so that it can
+// be sent afterwards. The written data is referenced instead of copied,
+// which is safe because the data of objects is never modified.
+type response struct {
+	header http.Header
+	status int
+	chunks [][]byte
+}
+
+// Header returns the response headers.
+func (resp *response) Header() http.Header { return resp.header }
+
+// WriteHeader sets the status code.
+func (resp *response) WriteHeader(status int) {
+	if resp.status == 0 {
+		resp.status = status
+	}
+}
+
+// Write adds data to the response body.
+func (resp *response) Write(data []byte) (int, error) {
+	resp.WriteHeader(http.StatusOK)
+	resp.chunks = append(resp.chunks, data)
+	return len(data), nil
+}
+
+// send writes the response to w.
+func (resp *response) send(w http.ResponseWriter) {
+	for name, values := range resp.header {
+		w.Header()[name] = values
+	}
+	if resp.status != 0 {
+		w.WriteHeader(resp.status)
+	}
+	for _, chunk := range resp.chunks {
+		_, _ = w.Write(chunk)
+	}
+}
+
+// splitPath splits path-style request path into bucket and object key.
+func splitPath(path string) (bucketName, key string) {
+	path = strings.TrimPrefix(path, "/")
+	if i := strings.IndexByte(path, '/'); i >= 0 {
+		return path[:i], path[i+1:]
+	}
+	return path, ""
+}
+
+func (server *Server) bucket(name string) (*bucket, *apiError) {
+	b, ok := server.buckets[name]
+	if !ok {
+		return nil, &errNoSuchBucket
+	}
+	return b, nil
+}
+
+func (server *Server) listBuckets(w http.ResponseWriter) *apiError {
+	type bucketEntry struct {
+		Name         string
+		CreationDate string
+	}
+	var response struct {
+		XMLName xml.Name      `xml:"ListAllMyBucketsResult"`
+		Buckets []bucketEntry `xml:"Buckets>Bucket"`
+	}
+
+	for _, name := range server.bucketNames() {
+		response.Buckets = append(response.Buckets, bucketEntry{
+			Name:         name,
+			CreationDate: formatXMLTime(server.buckets[name].created),
+		})
+	}
+
+	writeXML(w, http.StatusOK, response)
+	return nil
+}
+
+func (server *Server) createBucket(w http.ResponseWriter, name string) *apiError {
+	if _, ok := server.buckets[name]; ok {
+		return &errBucketAlreadyExists
+	}
+	server.buckets[name] = &bucket{
+		created: now(),
+		objects: map[string]*object{},
+	}
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+func (server *Server) deleteBucket(w http.ResponseWriter, name string) *apiError {
+	b, err := server.bucket(name)
+	if err != nil {
+		return err
+	}
+	if len(b.objects) > 0 {
+		return &errBucketNotEmpty
+	}
+	delete(server.buckets, name)
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (server *Server) bucketLocation(w http.ResponseWriter, name string) *apiError {
+	if _, err := server.bucket(name); err != nil {
+		return err
+	}
+
+	type locationConstraint struct {
+		XMLName xml.Name `xml:"LocationConstraint"`
+	}
+	writeXML(w, http.StatusOK, locationConstraint{})
+	return nil
+}
+
+// listObjects handles both ListObjects and ListObjectsV2.
+//
+// Continuation tokens and markers are the last returned key.
+func (server *Server) listObjects(w http.ResponseWriter, bucketName string, query url.Values) *apiError {
+	b, err := server.bucket(bucketName)
+	if err != nil {
+		return err
+	}
+
+	v2 := query.Get("list-type") == "2"
+	prefix := query.Get("prefix")
+	delimiter := query.Get("delimiter")
+
+	maxKeys := 1000
+	if value := query.Get("max-keys"); value != "" {
+		n, convErr := strconv.Atoi(value)
+		if convErr != nil || n < 0 {
+			return &errInvalidArgument
+		}
+		maxKeys = n
+	}
+
+	after := query.Get("marker")
+	if v2 {
+		after = query.Get("start-after")
+		if token := query.Get("continuation-token"); token != "" {
+			after = token
+		}
+	}
+
+	type contents struct {
+		Key          string
+		LastModified string
+		ETag         string
+		Size         int64
+		StorageClass string
+	}
+	type commonPrefix struct {
+		Prefix string
+	}
+
+	var objects []contents
+	var prefixes []commonPrefix
+	var last string
+	truncated := false
+
+	for _, key := range b.keys() {
+		if !strings.HasPrefix(key, prefix) || (after != "" && key <= after) {
+			continue
+		}
+
+		entry := key
+		isPrefix := false
+		if delimiter != "" {
+			if i := strings.Index(key[len(prefix):], delimiter); i >= 0 {
+				entry = key[:len(prefix)+i+len(delimiter)]
+				isPrefix = true
+				if entry == last || (after != "" && entry <= after) {
+					continue
+				}
+			}
+		}
+
+		if len(objects)+len(prefixes) >= maxKeys {
+			truncated = true
+			break
+		}
+
+		last = entry
+		if isPrefix {
+			prefixes = append(prefixes, commonPrefix{Prefix: entry})
+			continue
+		}
+
+		obj := b.objects[key]
+		objects = append(objects, contents{
+			Key:          key,
+			LastModified: formatXMLTime(obj.modified),
+			ETag:         quote(obj.etag),
+			Size:         int64(len(obj.data)),
+			StorageClass: "STANDARD",
+		})
+	}
+
+	next := ""
+	if truncated {
+		next = last
+	}
+
+	if v2 {
+		writeXML(w, http.StatusOK, struct {
+			XMLName               xml.Name `xml:"ListBucketResult"`
+			Name                  string
+			Prefix                string
+			Delimiter             string `xml:",omitempty"`
+			MaxKeys               int
+			KeyCount              int
+			IsTruncated           bool
+			ContinuationToken     string `xml:",omitempty"`
+			NextContinuationToken string `xml:",omitempty"`
+			StartAfter            string `xml:",omitempty"`
+			Contents              []contents
+			CommonPrefixes        []commonPrefix
+		}{
+			Name:                  bucketName,
+			Prefix:                prefix,
+			Delimiter:             delimiter,
+			MaxKeys:               maxKeys,
+			KeyCount:              len(objects) + len(prefixes),
+			IsTruncated:           truncated,
+			ContinuationToken:     query.Get("continuation-token"),
+			NextContinuationToken: next,
+			StartAfter:            query.Get("start-after"),
+			Contents:              objects,
+			CommonPrefixes:        prefixes,
+		})
+		return nil
+	}
+
+	writeXML(w, http.StatusOK, struct {
+		XMLName        xml.Name `xml:"ListBucketResult"`
+		Name           string
+		Prefix         string
+		Delimiter      string `xml:",omitempty"`
+		Marker         string
+		NextMarker     string `xml:",omitempty"`
+		MaxKeys        int
+		IsTruncated    bool
+		Contents       []contents
+		CommonPrefixes []commonPrefix
+	}{
+		Name:           bucketName,
+		Prefix:         prefix,
+		Delimiter:      delimiter,
+		Marker:         after,
+		NextMarker:     next,
+		MaxKeys:        maxKeys,
+		IsTruncated:    truncated,
+		Contents:       objects,
+		CommonPrefixes: prefixes,
+	})
+	return nil
+}
+
+func (server *Server) putObject(w http.ResponseWriter, r *http.Request, bucketName, key string, data []byte) *apiError {
+	b, err := server.bucket(bucketName)
+	if err != nil {
+		return err
+	}
+
+	obj := newObject(data, contentType(r.Header), userMetadata(r.Header))
+	b.objects[key] = obj
+
+	w.Header().Set("ETag", quote(obj.etag))
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+func (server *Server) copyObject(w http.ResponseWriter, r *http.Request, bucketName, key string) *apiError {
+	b, err := server.bucket(bucketName)
+	if err != nil {
+		return err
+	}
+
+	source, unescapeErr := url.PathUnescape(r.Header.Get("X-Amz-Copy-Source"))
+	if unescapeErr != nil {
+		return &errInvalidArgument
+	}
+	if i := strings.IndexByte(source, '?'); i >= 0 {
+		source = source[:i]
+	}
+	srcBucketName, srcKey := splitPath(source)
+
+	srcBucket, err := server.bucket(srcBucketName)
+	if err != nil {
+		return err
+	}
+	src, ok := srcBucket.objects[srcKey]
+	if !ok {
+		return &errNoSuchKey
+	}
+
+	copied := *src
+	copied.modified = now()
+	if strings.EqualFold(r.Header.Get("X-Amz-Metadata-Directive"), "REPLACE") {
+		copied.contentType = contentType(r.Header)
+		copied.metadata = userMetadata(r.Header)
+	}
+	b.objects[key] = &copied
+
+	writeXML(w, http.StatusOK, struct {
+		XMLName      xml.Name `xml:"CopyObjectResult"`
+		LastModified string
+		ETag         string
+	}{
+		LastModified: formatXMLTime(copied.modified),
+		ETag:         quote(copied.etag),
+	})
+	return nil
+}
+
+func (server *Server) getObject(w http.ResponseWriter, r *http.Request, bucketName, key string) *apiError {
+	b, err := server.bucket(bucketName)
+	if err != nil {
+		return err
+	}
+	obj, ok := b.objects[key]
+	if !ok {
+		return &errNoSuchKey
+	}
+
+	size := int64(len(obj.data))
+	start, end := int64(0), size
+	status := http.StatusOK
+
+	if value := r.Header.Get("Range"); value != "" {
+		var rangeErr error
+		start, end, rangeErr = parseRange(value, size)
+		if rangeErr != nil {
+			return &errInvalidRange
+		}
+		status = http.StatusPartialContent
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end-1, size))
+	}
+
+	header := w.Header()
+	header.Set("Accept-Ranges", "bytes")
+	header.Set("Content-Length", strconv.FormatInt(end-start, 10))
+	header.Set("Content-Type", obj.contentType)
+	header.Set("ETag", quote(obj.etag))
+	header.Set("Last-Modified", obj.modified.Format(http.TimeFormat))
+	for name, value := range obj.metadata {
+		header.Set("X-Amz-Meta-"+name, value)
+	}
+	w.WriteHeader(status)
+
+	if r.Method != http.MethodHead {
+		_, _ = w.Write(obj.data[start:end])
+	}
+	return nil
+}
+
+func (server *Server) deleteObject(w http.ResponseWriter, bucketName, key string) *apiError {
+	b, err := server.bucket(bucketName)
+	if err != nil {
+		return err
+	}
+	delete(b.objects, key)
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (server *Server) initiateMultipart(w http.ResponseWriter, r *http.Request, bucketName, key string) *apiError {
+	if _, err := server.bucket(bucketName); err != nil {
+		return err
+	}
+
+	server.uploadID++
+	id := strconv.Itoa(server.uploadID)
+	server.uploads[id] = &upload{
+		bucket:      bucketName,
+		key:         key,
+		contentType: contentType(r.Header),
+		metadata:    userMetadata(r.Header),
+		parts:       map[int]*object{},
+	}
+
+	writeXML(w, http.StatusOK, struct {
+		XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+		Bucket   string
+		Key      string
+		UploadID string `xml:"UploadId"`
+	}{
+		Bucket:   bucketName,
+		Key:      key,
+		UploadID: id,
+	})
+	return nil
+}
+
+func (server *Server) uploadPart(w http.ResponseWriter, r *http.Request, uploadID, partNumber string, data []byte) *apiError {
+	up, ok := server.uploads[uploadID]
+	if !ok {
+		return &errNoSuchUpload
+	}
+	if r.Header.Get("X-Amz-Copy-Source") != "" {
+		return &errNotImplemented
+	}
+
+	number, convErr := strconv.Atoi(partNumber)
+	if convErr != nil || number < 1 || number > 10000 {
+		return &errInvalidArgument
+	}
+
+	part := newObject(data, "", nil)
+	up.parts[number] = part
+
+	w.Header().Set("ETag", quote(part.etag))
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+func (server *Server) completeMultipart(w http.ResponseWriter, bucketName, key, uploadID string, body []byte) *apiError {
+	up, ok := server.uploads[uploadID]
+	if !ok || up.bucket != bucketName || up.key != key {
+		return &errNoSuchUpload
+	}
+	b, err := server.bucket(bucketName)
+	if err != nil {
+		return err
+	}
+
+	var request struct {
+		Parts []struct {
+			PartNumber int
+			ETag       string
+		} `xml:"Part"`
+	}
+	if xml.Unmarshal(body, &request) != nil || len(request.Parts) == 0 {
+		return &errMalformedXML
+	}
+
+	var data []byte
+	var digests []byte
+	for i, requested := range request.Parts {
+		part, ok := up.parts[requested.PartNumber]
+		if !ok || part.etag != unquote(requested.ETag) {
+			return &errInvalidPart
+		}
+		if i > 0 && requested.PartNumber <= request.Parts[i-1].PartNumber {
+			return &errInvalidPart
+		}
+
+		data = append(data, part.data...)
+		digest, _ := hex.DecodeString(part.etag)
+		digests = append(digests, digest...)
+	}
+
+	obj := newObject(data, up.contentType, up.metadata)
+	sum := md5.Sum(digests)
+	obj.etag = hex.EncodeToString(sum[:]) + "-" + strconv.Itoa(len(request.Parts))
+
+	b.objects[key] = obj
+	delete(server.uploads, uploadID)
+
+	writeXML(w, http.StatusOK, struct {
+		XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+		Bucket  string
+		Key     string
+		ETag    string
+	}{
+		Bucket: bucketName,
+		Key:    key,
+		ETag:   quote(obj.etag),
+	})
+	return nil
+}
+
+func (server *Server) abortMultipart(w http.ResponseWriter, uploadID string) *apiError {
+	if _, ok := server.uploads[uploadID]; !ok {
+		return &errNoSuchUpload
+	}
+	delete(server.uploads, uploadID)
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func newObject(data []byte, contentType string, metadata map[string]string) *object {
+	sum := md5.Sum(data)
+	return &object{
+		data:        data,
+		etag:        hex.EncodeToString(sum[:]),
+		contentType: contentType,
+		metadata:    metadata,
+		modified:    now(),
+	}
+}
+
+// readBody reads the request body, decoding it when it uses the streaming signature.
+func readBody(r *http.Request) ([]byte, error) {
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > 0 && strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+		return decodeChunked(data)
+	}
+	return data, nil
+}
+
+// decodeChunked decodes aws-chunked content, ignoring the chunk signatures.
+func decodeChunked(data []byte) ([]byte, error) {
+	decoded := []byte{}
+	for {
+		end := bytes.Index(data, []byte("\r\n"))
+		if end < 0 {
+			return nil, errors.New("missing chunk header")
+		}
+		header := string(data[:end])
+		data = data[end+2:]
+
+		if i := strings.IndexByte(header, ';'); i >= 0 {
+			header = header[:i]
+		}
+		size, err := strconv.ParseInt(header, 16, 64)
+		if err != nil {
+			return nil, err
+		}
+		if size == 0 {
+			return decoded, nil
+		}
+		if int64(len(data)) < size+2 {
+			return nil, errors.New("truncated chunk")
+		}
+
+		decoded = append(decoded, data[:size]...)
+		data = data[size+2:]
+	}
+}
+
+// parseRange parses a single byte range and returns the start and the exclusive end.
+func parseRange(value string, size int64) (start, end int64, err error) {
+	spec := strings.TrimPrefix(value, "bytes=")
+	if spec == value || strings.Contains(spec, ",") {
+		return 0, 0, errors.New("unsupported range")
+	}
+
+	dash := strings.IndexByte(spec, '-')
+	if dash < 0 {
+		return 0, 0, errors.New("invalid range")
+	}
+	first, last := spec[:dash], spec[dash+1:]
+
+	if first == "" {
+		suffix, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || suffix <= 0 || size == 0 {
+			return 0, 0, errors.New("invalid suffix range")
+		}
+		if suffix > size {
+			suffix = size
+		}
+		return size - suffix, size, nil
+	}
+
+	start, err = strconv.ParseInt(first, 10, 64)
+	if err != nil || start >= size {
+		return 0, 0, errors.New("range start out of bounds")
+	}
+
+	end = size
+	if last != "" {
+		lastByte, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || lastByte < start {
+			return 0, 0, errors.New("invalid range end")
+		}
+		if lastByte+1 < size {
+			end = lastByte + 1
+		}
+	}
+	return start, end, nil
+}
+
+// contentType returns the content type of an upload.
+func contentType(header http.Header) string {
+	if value := header.Get("Content-Type"); value != "" {
+		return value
+	}
+	return "binary/octet-stream"
+}
+
+// userMetadata returns the user metadata of an upload with lower case keys.
+func userMetadata(header http.Header) map[string]string {
+	const prefix = "x-amz-meta-"
+
+	metadata := map[string]string{}
+	for name, values := range header {
+		name = strings.ToLower(name)
+		if strings.HasPrefix(name, prefix) && len(values) > 0 {
+			metadata[strings.TrimPrefix(name, prefix)] = values[0]
+		}
+	}
+	return metadata
+}
+
+func writeXML(w http.ResponseWriter, status int, value interface{}) {
+	data, err := xml.Marshal(value)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.Header().Set("Content-Length", strconv.Itoa(len(xml.Header)+len(data)))
+	w.WriteHeader(status)
+	_, _ = w.Write([]byte(xml.Header))
+	_, _ = w.Write(data)
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, err *apiError) {
+	if r.Method == http.MethodHead {
+		w.WriteHeader(err.status)
+		return
+	}
+
+	writeXML(w, err.status, struct {
+		XMLName  xml.Name `xml:"Error"`
+		Code     string
+		Message  string
+		Resource string
+	}{
+		Code:     err.code,
+		Message:  err.message,
+		Resource: r.URL.Path,
+	})
+}
+
+func (server *Server) bucketNames() []string {
+	names := make([]string, 0, len(server.buckets))
+	for name := range server.buckets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (b *bucket) keys() []string {
+	keys := make([]string, 0, len(b.objects))
+	for key := range b.objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// now returns the current time with the precision of HTTP headers.
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Second)
+}
+
+func formatXMLTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05.000Z")
+}
+
+func quote(etag string) string {
+	return `"` + etag + `"`
+}
+
+func unquote(etag string) string {
+	return strings.Trim(etag, `"`)
+}
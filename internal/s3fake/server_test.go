@@ -0,0 +1,275 @@
+// Copyright (C) 2021 Storj Labs, Inc.
+// See LICENSE for copying information.
+
+package s3fake_test
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"storj.io/benchmark/internal/s3fake"
+)
+
+func do(t *testing.T, method, url string, header http.Header, body string) (*http.Response, []byte) {
+	t.Helper()
+
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, data
+}
+
+func TestObjects(t *testing.T) {
+	server := s3fake.NewServer()
+	defer server.Close()
+
+	resp, _ := do(t, "PUT", server.URL()+"/bucket", nil, "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("create bucket: %v", resp.Status)
+	}
+
+	resp, _ = do(t, "PUT", server.URL()+"/bucket/key", http.Header{
+		"Content-Type":    {"text/plain"},
+		"X-Amz-Meta-Name": {"value"},
+	}, "0123456789")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("put: %v", resp.Status)
+	}
+
+	resp, data := do(t, "GET", server.URL()+"/bucket/key", nil, "")
+	if resp.StatusCode != http.StatusOK || string(data) != "0123456789" {
+		t.Fatalf("get: %v %q", resp.Status, data)
+	}
+	if resp.Header.Get("Content-Type") != "text/plain" || resp.Header.Get("X-Amz-Meta-Name") != "value" {
+		t.Fatalf("get headers: %v", resp.Header)
+	}
+
+	for _, test := range []struct {
+		header  string
+		data    string
+		content string
+	}{
+		{"bytes=2-4", "234", "bytes 2-4/10"},
+		{"bytes=7-", "789", "bytes 7-9/10"},
+		{"bytes=-2", "89", "bytes 8-9/10"},
+		{"bytes=8-100", "89", "bytes 8-9/10"},
+	} {
+		resp, data := do(t, "GET", server.URL()+"/bucket/key", http.Header{"Range": {test.header}}, "")
+		if resp.StatusCode != http.StatusPartialContent || string(data) != test.data || resp.Header.Get("Content-Range") != test.content {
+			t.Errorf("range %q: %v %q %q", test.header, resp.Status, data, resp.Header.Get("Content-Range"))
+		}
+	}
+
+	resp, _ = do(t, "GET", server.URL()+"/bucket/key", http.Header{"Range": {"bytes=10-"}}, "")
+	if resp.StatusCode != http.StatusRequestedRangeNotSatisfiable {
+		t.Errorf("range past the end: %v", resp.Status)
+	}
+
+	resp, _ = do(t, "DELETE", server.URL()+"/bucket", nil, "")
+	if resp.StatusCode != http.StatusConflict {
+		t.Errorf("delete non-empty bucket: %v", resp.Status)
+	}
+
+	resp, _ = do(t, "DELETE", server.URL()+"/bucket/key", nil, "")
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("delete: %v", resp.Status)
+	}
+
+	resp, _ = do(t, "HEAD", server.URL()+"/bucket/key", nil, "")
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("head deleted: %v", resp.Status)
+	}
+}
+
+func TestConcurrentRequests(t *testing.T) {
+	server := s3fake.NewServer()
+	defer server.Close()
+
+	resp, _ := do(t, "PUT", server.URL()+"/bucket", nil, "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("create bucket: %v", resp.Status)
+	}
+
+	// the upload is still sending its body while the bucket is listed
+	body, sender := io.Pipe()
+	uploaded := make(chan error, 1)
+	go func() {
+		req, err := http.NewRequest("PUT", server.URL()+"/bucket/slow", body)
+		if err == nil {
+			var resp *http.Response
+			resp, err = http.DefaultClient.Do(req)
+			if err == nil {
+				_ = resp.Body.Close()
+			}
+		}
+		uploaded <- err
+	}()
+	if _, err := sender.Write([]byte("01234")); err != nil {
+		t.Fatal(err)
+	}
+
+	listed := make(chan int, 1)
+	go func() {
+		resp, err := http.Get(server.URL() + "/bucket")
+		if err != nil {
+			listed <- 0
+			return
+		}
+		_ = resp.Body.Close()
+		listed <- resp.StatusCode
+	}()
+
+	select {
+	case status := <-listed:
+		if status != http.StatusOK {
+			t.Fatalf("list: %v", status)
+		}
+	case <-time.After(5 * time.Second):
+		// let the upload fail, so that the server can be closed
+		_ = sender.CloseWithError(errors.New("list blocked"))
+		t.Fatal("list blocked by the upload")
+	}
+
+	if _, err := sender.Write([]byte("56789")); err != nil {
+		t.Fatal(err)
+	}
+	_ = sender.Close()
+	if err := <-uploaded; err != nil {
+		t.Fatal(err)
+	}
+
+	resp, data := do(t, "GET", server.URL()+"/bucket/slow", nil, "")
+	if resp.StatusCode != http.StatusOK || string(data) != "0123456789" {
+		t.Fatalf("get: %v %q", resp.Status, data)
+	}
+}
+
+func TestStreamingUpload(t *testing.T) {
+	server := s3fake.NewServer()
+	defer server.Close()
+
+	do(t, "PUT", server.URL()+"/bucket", nil, "")
+
+	body := "5;chunk-signature=aaaa\r\nhello\r\n6;chunk-signature=bbbb\r\n world\r\n0;chunk-signature=cccc\r\n\r\n"
+	resp, _ := do(t, "PUT", server.URL()+"/bucket/key", http.Header{
+		"X-Amz-Content-Sha256": {"STREAMING-AWS4-HMAC-SHA256-PAYLOAD"},
+	}, body)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("put: %v", resp.Status)
+	}
+
+	_, data := do(t, "GET", server.URL()+"/bucket/key", nil, "")
+	if string(data) != "hello world" {
+		t.Fatalf("get: %q", data)
+	}
+}
+
+func TestListPaging(t *testing.T) {
+	server := s3fake.NewServer()
+	defer server.Close()
+
+	do(t, "PUT", server.URL()+"/bucket", nil, "")
+	for _, key := range []string{"a", "b/1", "b/2", "c/1", "d"} {
+		do(t, "PUT", server.URL()+"/bucket/"+key, nil, "x")
+	}
+
+	type result struct {
+		IsTruncated           bool
+		NextContinuationToken string
+		Contents              []struct{ Key string }
+		CommonPrefixes        []struct{ Prefix string }
+	}
+
+	var listed []string
+	token := ""
+	for pages := 0; ; pages++ {
+		if pages > 4 {
+			t.Fatal("too many pages")
+		}
+
+		url := server.URL() + "/bucket?list-type=2&delimiter=%2F&max-keys=2"
+		if token != "" {
+			url += "&continuation-token=" + token
+		}
+		resp, data := do(t, "GET", url, nil, "")
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("list: %v", resp.Status)
+		}
+
+		var page result
+		if err := xml.Unmarshal(data, &page); err != nil {
+			t.Fatal(err)
+		}
+		for _, object := range page.Contents {
+			listed = append(listed, object.Key)
+		}
+		for _, prefix := range page.CommonPrefixes {
+			listed = append(listed, prefix.Prefix)
+		}
+
+		if !page.IsTruncated {
+			break
+		}
+		token = page.NextContinuationToken
+	}
+
+	sort.Strings(listed)
+	expected := "a b/ c/ d"
+	if got := strings.Join(listed, " "); got != expected {
+		t.Fatalf("listed %q, expected %q", got, expected)
+	}
+}
+
+func TestMultipart(t *testing.T) {
+	server := s3fake.NewServer()
+	defer server.Close()
+
+	do(t, "PUT", server.URL()+"/bucket", nil, "")
+
+	var initiated struct {
+		UploadID string `xml:"UploadId"`
+	}
+	_, data := do(t, "POST", server.URL()+"/bucket/key?uploads", nil, "")
+	if err := xml.Unmarshal(data, &initiated); err != nil {
+		t.Fatal(err)
+	}
+
+	part1, _ := do(t, "PUT", server.URL()+"/bucket/key?partNumber=1&uploadId="+initiated.UploadID, nil, "hello ")
+	part2, _ := do(t, "PUT", server.URL()+"/bucket/key?partNumber=2&uploadId="+initiated.UploadID, nil, "world")
+
+	complete := "<CompleteMultipartUpload>" +
+		"<Part><PartNumber>1</PartNumber><ETag>" + part1.Header.Get("ETag") + "</ETag></Part>" +
+		"<Part><PartNumber>2</PartNumber><ETag>" + part2.Header.Get("ETag") + "</ETag></Part>" +
+		"</CompleteMultipartUpload>"
+	resp, _ := do(t, "POST", server.URL()+"/bucket/key?uploadId="+initiated.UploadID, nil, complete)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("complete: %v", resp.Status)
+	}
+
+	resp, data = do(t, "GET", server.URL()+"/bucket/key", nil, "")
+	if string(data) != "hello world" || !strings.HasSuffix(resp.Header.Get("ETag"), `-2"`) {
+		t.Fatalf("get: %q %v", data, resp.Header.Get("ETag"))
+	}
+}
@@ -21,4 +21,5 @@ go test -bench=S3 -benchmem ./cmd/uplink/cmd/
 # run s3-benchmark with aws s3
 echo
 echo "Executing s3-benchmark tests with aws s3 client..."
-s3-benchmark --client=aws-cli --accesskey="$AWS_ACCESS_KEY_ID" --secretkey="$AWS_SECRET_ACCESS_KEY" --location="us-east-1" --s3-gateway="https://s3.amazonaws.com/"
+# the credentials are read from the environment
+s3-benchmark --client=aws-cli --location="us-east-1" --s3-gateway="https://s3.amazonaws.com/"